@@ -34,4 +34,9 @@ func InitDB() {
 	if err = DB.Ping(); err != nil {
 		log.Fatal(err)
 	}
+
+	// Bring the schema up to date
+	if err = Migrate(); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrate applies the SQL files in db/migrations that have not run yet, in filename order.
+// Each file runs in its own transaction and is recorded in schema_migrations. Migrations run in
+// the clinic's time zone (CLINIC_TIMEZONE, default UTC) so local dates and times convert correctly.
+func Migrate() error {
+	_, err := DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+        version    TEXT PRIMARY KEY,
+        applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    )`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	// Always set the zone, so the database server's own default never leaks in, and fall back to UTC
+	// for a zone the application will not load either
+	tz := os.Getenv("CLINIC_TIMEZONE")
+	if _, err := time.LoadLocation(tz); tz == "" || err != nil {
+		tz = "UTC"
+	}
+
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+
+		var applied bool
+		err := DB.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version=$1)", version).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("check migration %s: %w", version, err)
+		}
+		if applied {
+			continue
+		}
+
+		body, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		tx, err := DB.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("SELECT set_config('TimeZone', $1, true)", tz); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("set time zone for migration %s: %w", version, err)
+		}
+		if _, err := tx.Exec(string(body)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration %s: %w", version, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("record migration %s: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration %s: %w", version, err)
+		}
+		log.Printf("Applied migration %s", version)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+-- Tables the service has always relied on. IF NOT EXISTS keeps this a no-op on existing databases.
+CREATE TABLE IF NOT EXISTS users (
+    id       SERIAL PRIMARY KEY,
+    email    TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    role     TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS owners (
+    id      SERIAL PRIMARY KEY,
+    name    TEXT NOT NULL,
+    contact TEXT NOT NULL DEFAULT '',
+    email   TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS pets (
+    id       SERIAL PRIMARY KEY,
+    name     TEXT NOT NULL,
+    species  TEXT NOT NULL,
+    breed    TEXT NOT NULL DEFAULT '',
+    owner_id INTEGER NOT NULL REFERENCES owners (id),
+    history  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS appointments (
+    id       SERIAL PRIMARY KEY,
+    date     DATE NOT NULL,
+    time     TEXT NOT NULL DEFAULT '',
+    pet_id   INTEGER NOT NULL REFERENCES pets (id),
+    reason   TEXT NOT NULL DEFAULT '',
+    owner_id INTEGER
+);
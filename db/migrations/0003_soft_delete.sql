@@ -0,0 +1,11 @@
+-- Soft delete: rows are hidden rather than removed, and purged after the retention period
+ALTER TABLE owners ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE owners ADD COLUMN IF NOT EXISTS deleted_by INTEGER;
+ALTER TABLE pets ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE pets ADD COLUMN IF NOT EXISTS deleted_by INTEGER;
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS deleted_by INTEGER;
+
+CREATE INDEX IF NOT EXISTS owners_deleted_at_idx ON owners (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS pets_deleted_at_idx ON pets (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS appointments_deleted_at_idx ON appointments (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,14 @@
+-- Uploaded files, optionally linked to the owner and/or pet they belong to
+CREATE TABLE IF NOT EXISTS files (
+    id          SERIAL PRIMARY KEY,
+    filename    TEXT NOT NULL,
+    path        TEXT NOT NULL,
+    owner_id    INTEGER REFERENCES owners (id) ON DELETE SET NULL,
+    pet_id      INTEGER REFERENCES pets (id) ON DELETE SET NULL,
+    uploaded_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    deleted_at  TIMESTAMPTZ,
+    deleted_by  INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS files_owner_id_idx ON files (owner_id);
+CREATE INDEX IF NOT EXISTS files_pet_id_idx ON files (pet_id);
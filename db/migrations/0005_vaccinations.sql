@@ -0,0 +1,17 @@
+-- Structured vaccination records per pet
+CREATE TABLE IF NOT EXISTS vaccinations (
+    id              SERIAL PRIMARY KEY,
+    pet_id          INTEGER NOT NULL REFERENCES pets (id) ON DELETE CASCADE,
+    vaccine         TEXT NOT NULL,
+    lot_number      TEXT NOT NULL DEFAULT '',
+    administered_on DATE NOT NULL,
+    administered_by INTEGER REFERENCES users (id),
+    next_due_on     DATE,
+    notes           TEXT NOT NULL DEFAULT '',
+    version         INTEGER NOT NULL DEFAULT 1,
+    deleted_at      TIMESTAMPTZ,
+    deleted_by      INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS vaccinations_pet_id_idx ON vaccinations (pet_id);
+CREATE INDEX IF NOT EXISTS vaccinations_next_due_on_idx ON vaccinations (next_due_on) WHERE deleted_at IS NULL;
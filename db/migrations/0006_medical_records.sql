@@ -0,0 +1,40 @@
+-- Append-only medical record entries (SOAP notes) replacing the single pets.history column
+CREATE TABLE IF NOT EXISTS medical_records (
+    id             SERIAL PRIMARY KEY,
+    pet_id         INTEGER NOT NULL REFERENCES pets (id) ON DELETE CASCADE,
+    appointment_id INTEGER REFERENCES appointments (id) ON DELETE SET NULL,
+    author_id      INTEGER REFERENCES users (id),
+    subjective     TEXT NOT NULL DEFAULT '',
+    objective      TEXT NOT NULL DEFAULT '',
+    assessment     TEXT NOT NULL DEFAULT '',
+    plan           TEXT NOT NULL DEFAULT '',
+    amends_id      INTEGER REFERENCES medical_records (id) ON DELETE CASCADE,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS medical_records_pet_id_idx ON medical_records (pet_id, created_at);
+-- Each entry can be amended once; further corrections amend the amendment
+CREATE UNIQUE INDEX IF NOT EXISTS medical_records_amends_id_idx ON medical_records (amends_id);
+
+-- Entries are never edited in place; corrections are new rows that amend the original.
+-- Only appointment_id may change, so ON DELETE SET NULL still works when an appointment is purged.
+CREATE OR REPLACE FUNCTION medical_records_append_only() RETURNS trigger AS $$
+BEGIN
+    IF ROW(NEW.id, NEW.pet_id, NEW.author_id, NEW.subjective, NEW.objective, NEW.assessment, NEW.plan, NEW.amends_id, NEW.created_at)
+       IS DISTINCT FROM
+       ROW(OLD.id, OLD.pet_id, OLD.author_id, OLD.subjective, OLD.objective, OLD.assessment, OLD.plan, OLD.amends_id, OLD.created_at) THEN
+        RAISE EXCEPTION 'medical_records entries cannot be modified; add an amendment instead';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS medical_records_no_update ON medical_records;
+CREATE TRIGGER medical_records_no_update BEFORE UPDATE ON medical_records
+    FOR EACH ROW EXECUTE FUNCTION medical_records_append_only();
+
+-- Carry the old free-text history over as each pet's first entry, then retire the column
+INSERT INTO medical_records (pet_id, subjective)
+SELECT id, history FROM pets WHERE history <> '';
+
+ALTER TABLE pets DROP COLUMN IF EXISTS history;
@@ -0,0 +1,21 @@
+-- Medication prescribed to a pet, optionally during an appointment
+CREATE TABLE IF NOT EXISTS prescriptions (
+    id                 SERIAL PRIMARY KEY,
+    pet_id             INTEGER NOT NULL REFERENCES pets (id) ON DELETE CASCADE,
+    appointment_id     INTEGER REFERENCES appointments (id) ON DELETE SET NULL,
+    prescribed_by      INTEGER REFERENCES users (id),
+    drug               TEXT NOT NULL,
+    dose               TEXT NOT NULL,
+    frequency          TEXT NOT NULL,
+    duration_days      INTEGER NOT NULL DEFAULT 0 CHECK (duration_days >= 0),
+    refills            INTEGER NOT NULL DEFAULT 0 CHECK (refills >= 0),
+    instructions       TEXT NOT NULL DEFAULT '',
+    status             TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'discontinued', 'renewed')),
+    prescribed_on      DATE NOT NULL DEFAULT CURRENT_DATE,
+    renewed_from_id    INTEGER REFERENCES prescriptions (id) ON DELETE SET NULL,
+    discontinued_at    TIMESTAMPTZ,
+    discontinued_by    INTEGER REFERENCES users (id),
+    discontinue_reason TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS prescriptions_pet_id_idx ON prescriptions (pet_id, status);
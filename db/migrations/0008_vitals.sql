@@ -0,0 +1,15 @@
+-- Weight and vital signs measured for a pet; stored in kg and degrees Celsius
+CREATE TABLE IF NOT EXISTS vitals (
+    id                   SERIAL PRIMARY KEY,
+    pet_id               INTEGER NOT NULL REFERENCES pets (id) ON DELETE CASCADE,
+    measured_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    weight_kg            NUMERIC(7, 3) CHECK (weight_kg > 0),
+    temperature_c        NUMERIC(4, 1),
+    heart_rate           INTEGER CHECK (heart_rate > 0),
+    respiratory_rate     INTEGER CHECK (respiratory_rate > 0),
+    body_condition_score INTEGER CHECK (body_condition_score BETWEEN 1 AND 9),
+    recorded_by          INTEGER REFERENCES users (id),
+    notes                TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS vitals_pet_id_idx ON vitals (pet_id, measured_at);
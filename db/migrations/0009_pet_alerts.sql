@@ -0,0 +1,13 @@
+-- Clinical and handling alerts shown to staff before they see a pet
+CREATE TABLE IF NOT EXISTS pet_alerts (
+    id         SERIAL PRIMARY KEY,
+    pet_id     INTEGER NOT NULL REFERENCES pets (id) ON DELETE CASCADE,
+    category   TEXT NOT NULL DEFAULT 'other' CHECK (category IN ('allergy', 'behavior', 'condition', 'other')),
+    label      TEXT NOT NULL,
+    severity   TEXT NOT NULL DEFAULT 'warning' CHECK (severity IN ('info', 'warning', 'critical')),
+    notes      TEXT NOT NULL DEFAULT '',
+    created_by INTEGER REFERENCES users (id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS pet_alerts_pet_id_idx ON pet_alerts (pet_id);
@@ -0,0 +1,26 @@
+-- Appointments get a duration and an assigned vet and room, and the database refuses overlapping
+-- bookings for the same vet or the same room.
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS vet_id INTEGER REFERENCES users (id);
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS room TEXT NOT NULL DEFAULT '';
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS duration_minutes INTEGER NOT NULL DEFAULT 30 CHECK (duration_minutes > 0);
+
+-- appointment_slot is the time range an appointment occupies, or NULL when its time is not an HH:MM
+-- clock time (older rows hold free text there). Those rows are never considered to overlap.
+CREATE OR REPLACE FUNCTION appointment_slot(d DATE, t TEXT, minutes INTEGER) RETURNS tsrange AS $$
+    SELECT CASE WHEN t ~ '^([01]?[0-9]|2[0-3]):[0-5][0-9](:[0-5][0-9])?$'
+                THEN tsrange(d + t::time, d + t::time + minutes * interval '1 minute')
+           END
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS slot tsrange
+    GENERATED ALWAYS AS (appointment_slot(date, time, duration_minutes)) STORED;
+
+ALTER TABLE appointments ADD CONSTRAINT appointments_vet_overlap
+    EXCLUDE USING gist (vet_id WITH =, slot WITH &&)
+    WHERE (deleted_at IS NULL AND vet_id IS NOT NULL);
+
+ALTER TABLE appointments ADD CONSTRAINT appointments_room_overlap
+    EXCLUDE USING gist (room WITH =, slot WITH &&)
+    WHERE (deleted_at IS NULL AND room <> '');
@@ -0,0 +1,35 @@
+-- Appointment types, the vets who offer them, and each vet's weekly hours, breaks and days off
+CREATE TABLE IF NOT EXISTS appointment_types (
+    id               SERIAL PRIMARY KEY,
+    name             TEXT NOT NULL UNIQUE,
+    duration_minutes INTEGER NOT NULL CHECK (duration_minutes > 0)
+);
+
+CREATE TABLE IF NOT EXISTS vet_appointment_types (
+    vet_id              INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    appointment_type_id INTEGER NOT NULL REFERENCES appointment_types (id) ON DELETE CASCADE,
+    PRIMARY KEY (vet_id, appointment_type_id)
+);
+
+-- Recurring weekly blocks; weekday follows Go's time.Weekday (0 = Sunday)
+CREATE TABLE IF NOT EXISTS vet_hours (
+    id      SERIAL PRIMARY KEY,
+    vet_id  INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    kind    TEXT NOT NULL CHECK (kind IN ('working', 'break')),
+    starts  TIME NOT NULL,
+    ends    TIME NOT NULL,
+    CHECK (starts < ends)
+);
+
+CREATE INDEX IF NOT EXISTS vet_hours_vet_id_idx ON vet_hours (vet_id, weekday);
+
+CREATE TABLE IF NOT EXISTS vet_days_off (
+    id     SERIAL PRIMARY KEY,
+    vet_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    day    DATE NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    UNIQUE (vet_id, day)
+);
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS appointment_type_id INTEGER REFERENCES appointment_types (id);
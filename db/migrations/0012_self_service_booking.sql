@@ -0,0 +1,8 @@
+-- Owners can book online. Types that need a staff member to approve the booking leave it as requested
+-- until approved; everything else is scheduled straight away.
+ALTER TABLE appointment_types ADD COLUMN IF NOT EXISTS requires_approval BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'scheduled'
+    CONSTRAINT appointments_status_check CHECK (status IN ('requested', 'scheduled'));
+
+CREATE INDEX IF NOT EXISTS appointments_requested_idx ON appointments (date) WHERE status = 'requested' AND deleted_at IS NULL;
@@ -0,0 +1,29 @@
+-- Full appointment lifecycle. "scheduled" becomes "confirmed", every status change is recorded, and
+-- cancelled or no-show appointments no longer hold their vet or room.
+ALTER TABLE appointments DROP CONSTRAINT appointments_status_check;
+UPDATE appointments SET status = 'confirmed' WHERE status = 'scheduled';
+ALTER TABLE appointments ALTER COLUMN status SET DEFAULT 'confirmed';
+ALTER TABLE appointments ADD CONSTRAINT appointments_status_check
+    CHECK (status IN ('requested', 'confirmed', 'checked_in', 'in_progress', 'completed', 'cancelled', 'no_show'));
+
+CREATE TABLE IF NOT EXISTS appointment_status_changes (
+    id             SERIAL PRIMARY KEY,
+    appointment_id INTEGER NOT NULL REFERENCES appointments (id) ON DELETE CASCADE,
+    from_status    TEXT, -- NULL for the status the appointment was created with
+    to_status      TEXT NOT NULL,
+    changed_by     INTEGER REFERENCES users (id),
+    note           TEXT NOT NULL DEFAULT '',
+    changed_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS appointment_status_changes_appointment_id_idx ON appointment_status_changes (appointment_id, changed_at);
+
+ALTER TABLE appointments DROP CONSTRAINT appointments_vet_overlap;
+ALTER TABLE appointments ADD CONSTRAINT appointments_vet_overlap
+    EXCLUDE USING gist (vet_id WITH =, slot WITH &&)
+    WHERE (deleted_at IS NULL AND vet_id IS NOT NULL AND status NOT IN ('cancelled', 'no_show'));
+
+ALTER TABLE appointments DROP CONSTRAINT appointments_room_overlap;
+ALTER TABLE appointments ADD CONSTRAINT appointments_room_overlap
+    EXCLUDE USING gist (room WITH =, slot WITH &&)
+    WHERE (deleted_at IS NULL AND room <> '' AND status NOT IN ('cancelled', 'no_show'));
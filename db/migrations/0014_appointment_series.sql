@@ -0,0 +1,13 @@
+-- Recurring appointments: a series records the recurrence rule, and each occurrence is an ordinary
+-- appointment pointing back at it so it can be changed or cancelled on its own
+CREATE TABLE IF NOT EXISTS appointment_series (
+    id         SERIAL PRIMARY KEY,
+    rrule      TEXT NOT NULL,
+    pet_id     INTEGER NOT NULL REFERENCES pets (id),
+    created_by INTEGER REFERENCES users (id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS series_id INTEGER REFERENCES appointment_series (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS appointments_series_id_idx ON appointments (series_id) WHERE series_id IS NOT NULL;
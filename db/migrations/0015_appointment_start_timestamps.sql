@@ -0,0 +1,84 @@
+-- Appointments move from a DATE plus free-text time to starts_at/ends_at timestamps. Legacy times such as
+-- "9am", "09:00" and "9:00 AM" are parsed in the clinic's time zone (the session TimeZone, set by the
+-- migrator from CLINIC_TIMEZONE). Rows whose time cannot be parsed start at midnight and are listed in
+-- appointment_time_migration_issues for staff to correct. Until then they have no slot, as before, so
+-- placeholders on the same day do not collide in the overlap constraints.
+CREATE FUNCTION pg_temp.parse_legacy_clock_time(t TEXT) RETURNS time AS $$
+DECLARE
+    s TEXT := regexp_replace(lower(trim(t)), '\s+', ' ', 'g');
+    m TEXT[];
+    h INTEGER;
+    mi INTEGER;
+BEGIN
+    IF s IN ('noon', 'midday', '12 noon') THEN
+        RETURN '12:00'::time;
+    END IF;
+    m := regexp_match(s, '^(\d{1,2})(?:[:.](\d{2}))?(?::(\d{2}))?(?: ?([ap])\.? ?m\.?)?$');
+    IF m IS NULL THEN
+        RETURN NULL;
+    END IF;
+    h := m[1]::int;
+    mi := COALESCE(m[2], '0')::int;
+    IF m[4] IS NOT NULL THEN
+        IF h < 1 OR h > 12 THEN
+            RETURN NULL;
+        END IF;
+        IF m[4] = 'p' AND h < 12 THEN
+            h := h + 12;
+        ELSIF m[4] = 'a' AND h = 12 THEN
+            h := 0;
+        END IF;
+    END IF;
+    -- Seconds are checked but dropped, as models.ParseClock does
+    IF h > 23 OR mi > 59 OR COALESCE(m[3], '0')::int > 59 THEN
+        RETURN NULL;
+    END IF;
+    RETURN make_time(h, mi, 0);
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+CREATE TABLE IF NOT EXISTS appointment_time_migration_issues (
+    appointment_id INTEGER PRIMARY KEY REFERENCES appointments (id) ON DELETE CASCADE,
+    legacy_date    DATE NOT NULL,
+    legacy_time    TEXT NOT NULL,
+    problem        TEXT NOT NULL,
+    reported_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO appointment_time_migration_issues (appointment_id, legacy_date, legacy_time, problem)
+SELECT id, date, time, CASE WHEN trim(time) = '' THEN 'no time given' ELSE 'unrecognised time' END
+FROM appointments
+WHERE pg_temp.parse_legacy_clock_time(time) IS NULL;
+
+ALTER TABLE appointments ADD COLUMN starts_at TIMESTAMPTZ;
+ALTER TABLE appointments ADD COLUMN ends_at TIMESTAMPTZ;
+ALTER TABLE appointments ADD COLUMN time_unresolved BOOLEAN NOT NULL DEFAULT false;
+UPDATE appointments SET time_unresolved = true WHERE id IN (SELECT appointment_id FROM appointment_time_migration_issues);
+UPDATE appointments SET starts_at = (date + COALESCE(pg_temp.parse_legacy_clock_time(time), '00:00'::time))::timestamptz;
+UPDATE appointments SET ends_at = starts_at + duration_minutes * interval '1 minute';
+ALTER TABLE appointments ALTER COLUMN starts_at SET NOT NULL;
+ALTER TABLE appointments ALTER COLUMN ends_at SET NOT NULL;
+ALTER TABLE appointments ADD CONSTRAINT appointments_ends_after_start CHECK (ends_at > starts_at);
+
+-- Rebuild the overlap constraints on the new columns
+ALTER TABLE appointments DROP CONSTRAINT appointments_vet_overlap;
+ALTER TABLE appointments DROP CONSTRAINT appointments_room_overlap;
+ALTER TABLE appointments DROP COLUMN slot;
+DROP FUNCTION appointment_slot(DATE, TEXT, INTEGER);
+ALTER TABLE appointments DROP COLUMN date;
+ALTER TABLE appointments DROP COLUMN time;
+ALTER TABLE appointments DROP COLUMN duration_minutes;
+
+ALTER TABLE appointments ADD COLUMN slot tstzrange GENERATED ALWAYS AS
+    (CASE WHEN time_unresolved THEN NULL ELSE tstzrange(starts_at, ends_at) END) STORED;
+
+ALTER TABLE appointments ADD CONSTRAINT appointments_vet_overlap
+    EXCLUDE USING gist (vet_id WITH =, slot WITH &&)
+    WHERE (deleted_at IS NULL AND vet_id IS NOT NULL AND status NOT IN ('cancelled', 'no_show'));
+
+ALTER TABLE appointments ADD CONSTRAINT appointments_room_overlap
+    EXCLUDE USING gist (room WITH =, slot WITH &&)
+    WHERE (deleted_at IS NULL AND room <> '' AND status NOT IN ('cancelled', 'no_show'));
+
+CREATE INDEX IF NOT EXISTS appointments_starts_at_idx ON appointments (starts_at);
+CREATE INDEX IF NOT EXISTS appointments_requested_idx ON appointments (starts_at) WHERE status = 'requested' AND deleted_at IS NULL;
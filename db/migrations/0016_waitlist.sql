@@ -0,0 +1,45 @@
+-- Waitlist: pets waiting for a slot of some appointment type within a date window, optionally with
+-- particular vets. When a booked slot is freed it is offered to the oldest matching entry.
+CREATE TABLE IF NOT EXISTS waitlist_entries (
+    id                  SERIAL PRIMARY KEY,
+    pet_id              INTEGER NOT NULL REFERENCES pets (id) ON DELETE CASCADE,
+    appointment_type_id INTEGER NOT NULL REFERENCES appointment_types (id),
+    from_date           DATE NOT NULL,
+    to_date             DATE NOT NULL,
+    notes               TEXT NOT NULL DEFAULT '',
+    status              TEXT NOT NULL DEFAULT 'waiting'
+        CONSTRAINT waitlist_entries_status_check CHECK (status IN ('waiting', 'offered', 'booked', 'withdrawn', 'expired')),
+    appointment_id      INTEGER REFERENCES appointments (id) ON DELETE SET NULL,
+    created_by          INTEGER REFERENCES users (id),
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT waitlist_entries_window_check CHECK (to_date >= from_date)
+);
+
+CREATE INDEX IF NOT EXISTS waitlist_entries_waiting_idx ON waitlist_entries (created_at, id) WHERE status = 'waiting';
+
+-- Preferred vets; an entry without any accepts every vet offering the type
+CREATE TABLE IF NOT EXISTS waitlist_preferred_vets (
+    entry_id INTEGER NOT NULL REFERENCES waitlist_entries (id) ON DELETE CASCADE,
+    vet_id   INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    PRIMARY KEY (entry_id, vet_id)
+);
+
+-- An offer holds a freed slot for one entry until it is accepted, declined or expires
+CREATE TABLE IF NOT EXISTS waitlist_offers (
+    id                   SERIAL PRIMARY KEY,
+    entry_id             INTEGER NOT NULL REFERENCES waitlist_entries (id) ON DELETE CASCADE,
+    freed_appointment_id INTEGER REFERENCES appointments (id) ON DELETE SET NULL,
+    vet_id               INTEGER NOT NULL REFERENCES users (id),
+    starts_at            TIMESTAMPTZ NOT NULL,
+    ends_at              TIMESTAMPTZ NOT NULL,
+    status               TEXT NOT NULL DEFAULT 'pending'
+        CONSTRAINT waitlist_offers_status_check CHECK (status IN ('pending', 'accepted', 'declined', 'expired')),
+    offered_at           TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at           TIMESTAMPTZ NOT NULL,
+    responded_at         TIMESTAMPTZ
+);
+
+-- One open offer per entry and per freed slot
+CREATE UNIQUE INDEX IF NOT EXISTS waitlist_offers_pending_entry_idx ON waitlist_offers (entry_id) WHERE status = 'pending';
+CREATE UNIQUE INDEX IF NOT EXISTS waitlist_offers_pending_slot_idx ON waitlist_offers (freed_appointment_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS waitlist_offers_freed_idx ON waitlist_offers (freed_appointment_id);
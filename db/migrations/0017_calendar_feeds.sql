@@ -0,0 +1,7 @@
+-- Calendar feeds: each user can have one secret feed URL. Only a hash of the token is stored, so the
+-- URL cannot be recovered from the database; issuing a new one replaces the old.
+CREATE TABLE IF NOT EXISTS calendar_feed_tokens (
+    user_id    INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,28 @@
+-- How owners want to be reminded of appointments. Owners without a row get email reminders only.
+CREATE TABLE IF NOT EXISTS owner_contact_preferences (
+    owner_id INTEGER PRIMARY KEY REFERENCES owners (id) ON DELETE CASCADE,
+    email    BOOLEAN NOT NULL DEFAULT true,
+    sms      BOOLEAN NOT NULL DEFAULT false,
+    phone    TEXT NOT NULL DEFAULT ''
+);
+
+-- One row per reminder due for an appointment, per channel and offset before the start. The start is part
+-- of the key so a rescheduled appointment is reminded again.
+CREATE TABLE IF NOT EXISTS appointment_reminders (
+    id                    SERIAL PRIMARY KEY,
+    appointment_id        INTEGER NOT NULL REFERENCES appointments (id) ON DELETE CASCADE,
+    channel               TEXT NOT NULL CONSTRAINT appointment_reminders_channel_check CHECK (channel IN ('email', 'sms')),
+    recipient             TEXT NOT NULL,
+    offset_minutes        INTEGER NOT NULL,
+    appointment_starts_at TIMESTAMPTZ NOT NULL,
+    due_at                TIMESTAMPTZ NOT NULL,
+    status                TEXT NOT NULL DEFAULT 'pending'
+        CONSTRAINT appointment_reminders_status_check CHECK (status IN ('pending', 'sent', 'failed', 'skipped')),
+    attempts              INTEGER NOT NULL DEFAULT 0,
+    last_error            TEXT NOT NULL DEFAULT '',
+    sent_at               TIMESTAMPTZ,
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT appointment_reminders_unique UNIQUE (appointment_id, channel, offset_minutes, appointment_starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS appointment_reminders_pending_idx ON appointment_reminders (due_at) WHERE status = 'pending';
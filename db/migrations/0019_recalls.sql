@@ -0,0 +1,35 @@
+-- Recall rules: when pets are due back, either for a vaccine (from their latest dose's next_due_on) or for
+-- a periodic visit (months after their last completed appointment of a type)
+CREATE TABLE IF NOT EXISTS recall_rules (
+    id                  SERIAL PRIMARY KEY,
+    name                TEXT NOT NULL,
+    kind                TEXT NOT NULL CONSTRAINT recall_rules_kind_check CHECK (kind IN ('vaccination', 'checkup')),
+    vaccine             TEXT NOT NULL DEFAULT '',            -- vaccination rules; empty matches every vaccine
+    appointment_type_id INTEGER REFERENCES appointment_types (id), -- what to book; for checkup rules also the visit counted
+    interval_months     INTEGER NOT NULL DEFAULT 12,         -- checkup rules
+    lead_days           INTEGER NOT NULL DEFAULT 14,         -- how long before the due date the notice goes out
+    active              BOOLEAN NOT NULL DEFAULT true,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT recall_rules_checkup_type CHECK (kind <> 'checkup' OR appointment_type_id IS NOT NULL)
+);
+
+-- One recall per rule, pet and due date: the recall list, with delivery and whether it led to a booking
+CREATE TABLE IF NOT EXISTS recalls (
+    id                    SERIAL PRIMARY KEY,
+    rule_id               INTEGER NOT NULL REFERENCES recall_rules (id) ON DELETE CASCADE,
+    pet_id                INTEGER NOT NULL REFERENCES pets (id) ON DELETE CASCADE,
+    due_on                DATE NOT NULL,
+    status                TEXT NOT NULL DEFAULT 'pending'
+        CONSTRAINT recalls_status_check CHECK (status IN ('pending', 'sent', 'failed', 'no_contact', 'skipped')),
+    sent_via              TEXT NOT NULL DEFAULT '',
+    attempts              INTEGER NOT NULL DEFAULT 0,
+    last_error            TEXT NOT NULL DEFAULT '',
+    sent_at               TIMESTAMPTZ,
+    booked_appointment_id INTEGER REFERENCES appointments (id) ON DELETE SET NULL,
+    booked_at             TIMESTAMPTZ,
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT recalls_unique UNIQUE (rule_id, pet_id, due_on)
+);
+
+CREATE INDEX IF NOT EXISTS recalls_pending_idx ON recalls (created_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS recalls_open_idx ON recalls (pet_id) WHERE status = 'sent' AND booked_at IS NULL;
@@ -0,0 +1,20 @@
+-- Admin-edited wording of notifications, per kind, channel and locale. Every edit adds a version and the
+-- highest version is the one in use, so rolling back adds a copy of an earlier one. Kinds, channels and
+-- locales without a row use the wording built into the application.
+CREATE TABLE IF NOT EXISTS notification_templates (
+    id                SERIAL PRIMARY KEY,
+    kind              TEXT NOT NULL,
+    channel           TEXT NOT NULL CONSTRAINT notification_templates_channel_check CHECK (channel IN ('email', 'sms')),
+    locale            TEXT NOT NULL,
+    version           INTEGER NOT NULL,
+    subject           TEXT NOT NULL DEFAULT '',
+    text_body         TEXT NOT NULL,
+    html_body         TEXT NOT NULL DEFAULT '',
+    rolled_back_from  INTEGER,
+    created_by        INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT notification_templates_version_unique UNIQUE (kind, channel, locale, version)
+);
+
+-- The language owners are written to in; empty means the clinic's default
+ALTER TABLE owner_contact_preferences ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
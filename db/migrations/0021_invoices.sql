@@ -0,0 +1,52 @@
+-- Invoices billed to owners, optionally for an appointment. Amounts are in minor units (cents) of the
+-- clinic's currency. Drafts can be edited or deleted; issuing one gives it the next number of its year and
+-- freezes it, after which it can only be paid or voided.
+CREATE TABLE IF NOT EXISTS invoices (
+    id                SERIAL PRIMARY KEY,
+    number            TEXT UNIQUE,
+    owner_id          INTEGER NOT NULL REFERENCES owners (id),
+    appointment_id    INTEGER REFERENCES appointments (id) ON DELETE SET NULL,
+    status            TEXT NOT NULL DEFAULT 'draft'
+        CONSTRAINT invoices_status_check CHECK (status IN ('draft', 'issued', 'paid', 'void')),
+    notes             TEXT NOT NULL DEFAULT '',
+    issued_on         DATE,
+    due_on            DATE,
+    paid_at           TIMESTAMPTZ,
+    payment_method    TEXT NOT NULL DEFAULT '',
+    payment_reference TEXT NOT NULL DEFAULT '',
+    voided_at         TIMESTAMPTZ,
+    void_reason       TEXT NOT NULL DEFAULT '',
+    created_by        INTEGER REFERENCES users (id),
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    version           INTEGER NOT NULL DEFAULT 1,
+    CONSTRAINT invoices_number_check CHECK (status = 'draft' OR number IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS invoices_owner_idx ON invoices (owner_id, created_at);
+
+-- An appointment is billed at most once, unless its invoice is voided
+CREATE UNIQUE INDEX IF NOT EXISTS invoices_appointment_idx ON invoices (appointment_id) WHERE status <> 'void';
+
+CREATE TABLE IF NOT EXISTS invoice_lines (
+    id               SERIAL PRIMARY KEY,
+    invoice_id       INTEGER NOT NULL REFERENCES invoices (id) ON DELETE CASCADE,
+    position         INTEGER NOT NULL,
+    kind             TEXT NOT NULL
+        CONSTRAINT invoice_lines_kind_check CHECK (kind IN ('service', 'medication', 'discount', 'other')),
+    description      TEXT NOT NULL,
+    quantity         INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price_cents BIGINT NOT NULL CHECK (unit_price_cents >= 0),
+    tax_rate         NUMERIC(5, 2) NOT NULL DEFAULT 0 CHECK (tax_rate >= 0 AND tax_rate <= 100),
+    prescription_id  INTEGER REFERENCES prescriptions (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS invoice_lines_invoice_idx ON invoice_lines (invoice_id, position);
+
+-- The last invoice number given out each year, so numbers run without gaps
+CREATE TABLE IF NOT EXISTS invoice_counters (
+    year INTEGER PRIMARY KEY,
+    last INTEGER NOT NULL
+);
+
+-- The usual price of each appointment type, used for the service line of an appointment's invoice
+ALTER TABLE appointment_types ADD COLUMN IF NOT EXISTS price_cents BIGINT NOT NULL DEFAULT 0 CHECK (price_cents >= 0);
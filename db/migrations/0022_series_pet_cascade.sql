@@ -0,0 +1,4 @@
+-- A series goes with its pet, so purging a deleted pet does not trip over the series' foreign key
+ALTER TABLE appointment_series DROP CONSTRAINT IF EXISTS appointment_series_pet_id_fkey;
+ALTER TABLE appointment_series ADD CONSTRAINT appointment_series_pet_id_fkey
+    FOREIGN KEY (pet_id) REFERENCES pets (id) ON DELETE CASCADE;
@@ -0,0 +1,12 @@
+-- Owners are told when a freed slot is offered to their pet. notified_at is set once the notice is sent, or
+-- once it cannot be, so the waitlist job sends each offer's notice once.
+ALTER TABLE waitlist_offers ADD COLUMN IF NOT EXISTS notified_at TIMESTAMPTZ;
+ALTER TABLE waitlist_offers ADD COLUMN IF NOT EXISTS notified_via TEXT NOT NULL DEFAULT '';
+ALTER TABLE waitlist_offers ADD COLUMN IF NOT EXISTS notify_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE waitlist_offers ADD COLUMN IF NOT EXISTS notify_error TEXT NOT NULL DEFAULT '';
+
+-- Offers made before notices existed are not announced after the fact
+UPDATE waitlist_offers SET notified_at = offered_at WHERE notified_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS waitlist_offers_unnotified_idx ON waitlist_offers (offered_at, id)
+    WHERE status = 'pending' AND notified_at IS NULL;
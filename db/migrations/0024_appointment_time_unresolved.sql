@@ -0,0 +1,3 @@
+-- Databases that applied 0015 before placeholder starts were kept out of the overlap constraints get the
+-- flag too. Every row there already has a slot, so it stays false.
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS time_unresolved BOOLEAN NOT NULL DEFAULT false;
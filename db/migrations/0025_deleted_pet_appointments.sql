@@ -0,0 +1,9 @@
+-- Deleting a pet now deletes its appointments and files too. Bring pets deleted before then in line, so
+-- their appointments stop holding vets and rooms and the pets can be purged.
+UPDATE appointments a SET deleted_at = p.deleted_at, deleted_by = p.deleted_by, version = a.version + 1
+FROM pets p
+WHERE p.id = a.pet_id AND p.deleted_at IS NOT NULL AND a.deleted_at IS NULL;
+
+UPDATE files f SET deleted_at = p.deleted_at, deleted_by = p.deleted_by
+FROM pets p
+WHERE p.id = f.pet_id AND p.deleted_at IS NOT NULL AND f.deleted_at IS NULL;
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// Querier is satisfied by both *sql.DB and *sql.Tx, so model functions that accept one
+// can run on their own or as part of a larger transaction.
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// WithTx runs fn inside a transaction, committing if it returns nil and rolling back otherwise.
+// If fn panics the transaction is rolled back before the panic carries on, so the connection is not
+// left holding locks.
+func WithTx(fn func(tx *sql.Tx) error) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
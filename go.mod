@@ -2,9 +2,8 @@ module petclinic
 
 go 1.25.1
 
-require github.com/dgrijalva/jwt-go v3.2.0+incompatible
-
 require (
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/lib/pq v1.10.9 // indirect
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/joho/godotenv v1.5.1
+	github.com/lib/pq v1.10.9
 )
@@ -2,124 +2,476 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"petclinic/models"
 	"petclinic/utils"
-	"strconv"
+	"time"
 )
 
-func AppointmentsHandler(w http.ResponseWriter, r *http.Request) {
-	utils.Info("Received %s request at %s", r.Method, r.URL.Path)
+// loadAppointment fetches the appointment named by the {id} path segment and checks the caller may access it.
+// Staff and admin can access any appointment; owners only those for their own pets.
+func loadAppointment(w http.ResponseWriter, r *http.Request, claims *utils.Claims) (*models.Appointment, bool) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return nil, false
+	}
+	apt := models.GetAppointmentByID(id)
+	if apt == nil {
+		http.Error(w, "Appointment not found", http.StatusNotFound)
+		return nil, false
+	}
+	if !isStaff(claims) && apt.OwnerID != claims.UserID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return apt, true
+}
 
-	claimsVal := r.Context().Value("userClaims")
-	claims, ok := claimsVal.(*utils.Claims)
-	if !ok || claims == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+// resolveTimes defaults the appointment's duration from its type and settles its start and end from the
+// fields the client sent (prev is the stored appointment on update), writing a 422 for an unknown type
+// or an unusable time
+func resolveTimes(w http.ResponseWriter, appointment *models.Appointment, prev *models.Appointment) bool {
+	err := models.FillDuration(appointment)
+	if err == nil {
+		err = appointment.ResolveTimes(prev)
+	}
+	if err == nil {
+		return true
 	}
+	var verr *models.ValidationError
+	if errors.As(err, &verr) {
+		writeValidationError(w, verr)
+		return false
+	}
+	http.Error(w, "Failed to look up appointment type", http.StatusInternalServerError)
+	return false
+}
 
-	switch r.Method {
-	case http.MethodGet:
-		if claims.Role == "owner" {
-			apts := models.GetAppointmentsByOwnerID(claims.UserID)
-			json.NewEncoder(w).Encode(apts)
-		} else {
-			apts := models.GetAllAppointments()
-			if apts == nil {
-				utils.Warn("No appointments found")
-			}
-			json.NewEncoder(w).Encode(apts)
-		}
+// prepareOwnerBooking applies the clinic's booking rules and vet availability to an owner's booking,
+// writing a 422 if the requested slot cannot be booked
+func prepareOwnerBooking(w http.ResponseWriter, appointment *models.Appointment, excludeID int) bool {
+	err := models.Rules.PrepareOwnerBooking(appointment, excludeID)
+	if err == nil {
+		return true
+	}
+	var verr *models.ValidationError
+	if errors.As(err, &verr) {
+		writeValidationError(w, verr)
+		return false
+	}
+	http.Error(w, "Failed to check availability", http.StatusInternalServerError)
+	return false
+}
 
-	case http.MethodPost:
-		if claims.Role != "staff" && claims.Role != "admin" {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
+// checkVet writes a 422 unless the appointment's vet, if any, is a staff member who offers its type
+func checkVet(w http.ResponseWriter, appointment models.Appointment) bool {
+	if appointment.VetID == 0 {
+		return true
+	}
+	vet, err := models.GetUserByID(appointment.VetID)
+	if err != nil {
+		http.Error(w, "Failed to look up vet", http.StatusInternalServerError)
+		return false
+	}
+	if vet == nil || (vet.Role != "staff" && vet.Role != "admin") {
+		writeValidationError(w, &models.ValidationError{Fields: map[string]string{"vet_id": "must be a staff member"}})
+		return false
+	}
+	if appointment.TypeID == 0 {
+		return true
+	}
+	offers, err := models.VetOffersType(appointment.VetID, appointment.TypeID)
+	if err != nil {
+		http.Error(w, "Failed to look up vet", http.StatusInternalServerError)
+		return false
+	}
+	if !offers {
+		writeValidationError(w, &models.ValidationError{Fields: map[string]string{"vet_id": "does not offer this appointment type"}})
+		return false
+	}
+	return true
+}
 
-		var appointment models.Appointment
-		err := json.NewDecoder(r.Body).Decode(&appointment)
-		if err != nil {
-			utils.Error("Failed to decode POST body: %v", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-		// Set OwnerID to logged in user if you want owners to create own appointments, adjust as needed
-		if claims.Role == "owner" {
-			appointment.OwnerID = claims.UserID
-		}
+// writeScheduleConflict responds 409 with the booking already holding the slot if err is a
+// *models.ScheduleConflictError, and reports whether it did
+func writeScheduleConflict(w http.ResponseWriter, err error) bool {
+	var conflict *models.ScheduleConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+	writeJSON(w, http.StatusConflict, map[string]interface{}{
+		"error":    conflict.Error(),
+		"conflict": conflict.Conflict,
+	})
+	return true
+}
 
-		err = models.AddAppointment(appointment)
-		if err != nil {
-			utils.Error("Database error: %v", err)
-			http.Error(w, "Failed to create appointment", http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusCreated)
+// ListAppointments handles GET /appointments. Supports pet_id, owner_id, vet_id, from/to date range and
+// reason filters plus paging and sorting; owners only ever see appointments for their own pets.
+func ListAppointments(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	petID, ok := queryInt(w, r, "pet_id")
+	if !ok {
+		return
+	}
+	ownerID, ok := queryInt(w, r, "owner_id")
+	if !ok {
+		return
+	}
+	vetID, ok := queryInt(w, r, "vet_id")
+	if !ok {
+		return
+	}
+	if claims.Role == "owner" {
+		ownerID = claims.UserID
+	}
+	listAppointments(w, r, models.AppointmentFilter{PetID: petID, OwnerID: ownerID, VetID: vetID, Status: r.URL.Query().Get("status")})
+}
 
-	case http.MethodPut:
-		id, err := strconv.Atoi(r.URL.Query().Get("id"))
-		if err != nil {
-			utils.Warn("Invalid appointment ID provided for update")
-			http.Error(w, "Invalid ID", http.StatusBadRequest)
-			return
-		}
+// listAppointments adds the request's date range, reason and paging parameters to filter and writes the page
+func listAppointments(w http.ResponseWriter, r *http.Request, filter models.AppointmentFilter) {
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+	if filter.From, ok = queryDate(w, r, "from"); !ok {
+		return
+	}
+	if filter.To, ok = queryDate(w, r, "to"); !ok {
+		return
+	}
+	filter.Reason = r.URL.Query().Get("reason")
+
+	page, err := models.ListAppointments(filter, opts)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	models.AttachAppointmentAlerts(page.Items)
+	writeJSON(w, http.StatusOK, page)
+}
 
-		// Authorization check: staff/admin or owner of appointment
-		existingAppointment := models.GetAppointmentByID(id)
-		if existingAppointment == nil {
-			http.Error(w, "Appointment not found", http.StatusNotFound)
+// CreateAppointment handles POST /appointments. Staff can book any slot; owners can book their own pets
+// into an open slot within the clinic's booking rules.
+func CreateAppointment(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+
+	var appointment models.Appointment
+	err := json.NewDecoder(r.Body).Decode(&appointment)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if isStaff(claims) {
+		appointment.Status = models.StatusConfirmed
+		if !resolveTimes(w, &appointment, nil) || !validate(w, appointment) || !checkVet(w, appointment) {
 			return
 		}
-		if claims.Role != "staff" && claims.Role != "admin" && existingAppointment.OwnerID != claims.UserID {
+	} else {
+		pet, err := models.GetPetByID(appointment.PetID)
+		if err != nil || pet == nil || pet.OwnerID != claims.UserID {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
-
-		var appointment models.Appointment
-		err = json.NewDecoder(r.Body).Decode(&appointment)
-		if err != nil {
-			utils.Error("Failed to decode PUT body: %v", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		if !resolveTimes(w, &appointment, nil) || !prepareOwnerBooking(w, &appointment, 0) || !validate(w, appointment) {
 			return
 		}
+	}
 
-		err = models.UpdateAppointment(id, appointment)
-		if err != nil {
-			utils.Error("Failed to update appointment: %v", err)
-			http.Error(w, "Update failed", http.StatusInternalServerError)
+	created, err := models.AddAppointment(appointment)
+	if writeScheduleConflict(w, err) {
+		return
+	}
+	if err != nil {
+		utils.Error("Database error: %v", err)
+		http.Error(w, "Failed to create appointment", http.StatusInternalServerError)
+		return
+	}
+	setETag(w, created.Version)
+	writeCreated(w, fmt.Sprintf("/appointments/%d", created.ID), created)
+}
+
+// GetAppointment handles GET /appointments/{id}
+func GetAppointment(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	apt, ok := loadAppointment(w, r, claims)
+	if !ok {
+		return
+	}
+	apts := []models.Appointment{*apt}
+	models.AttachAppointmentAlerts(apts)
+	setETag(w, apt.Version)
+	writeJSON(w, http.StatusOK, apts[0])
+}
+
+// UpdateAppointment handles PUT /appointments/{id}, replacing every field of the appointment
+func UpdateAppointment(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	existing, ok := loadAppointment(w, r, claims)
+	if !ok || !checkIfMatch(w, r, existing.Version) {
+		return
+	}
+
+	var appointment models.Appointment
+	err := json.NewDecoder(r.Body).Decode(&appointment)
+	if err != nil {
+		utils.Error("Failed to decode PUT body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	saveAppointment(w, claims, existing, appointment)
+}
+
+// PatchAppointment handles PATCH /appointments/{id}, applying the body as a JSON merge patch (RFC 7396)
+func PatchAppointment(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	existing, ok := loadAppointment(w, r, claims)
+	if !ok || !checkIfMatch(w, r, existing.Version) {
+		return
+	}
+
+	var appointment models.Appointment
+	if !decodeMergePatch(w, r, existing, &appointment) {
+		return
+	}
+	saveAppointment(w, claims, existing, appointment)
+}
+
+// saveAppointment writes appointment over existing and responds with the stored result
+func saveAppointment(w http.ResponseWriter, claims *utils.Claims, existing *models.Appointment, appointment models.Appointment) {
+	// Owners may only move an appointment to another of their own pets
+	if !isStaff(claims) && appointment.PetID != existing.PetID {
+		pet, err := models.GetPetByID(appointment.PetID)
+		if err != nil || pet == nil || pet.OwnerID != claims.UserID {
+			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+	}
+	appointment.ID = existing.ID
+	appointment.OwnerID = existing.OwnerID
+	appointment.Version = existing.Version
+	appointment.Status = existing.Status
+	appointment.SeriesID = existing.SeriesID
+	appointment.PetAlerts = nil
 
-	case http.MethodDelete:
-		id, err := strconv.Atoi(r.URL.Query().Get("id"))
-		if err != nil {
-			utils.Warn("Invalid appointment ID for deletion")
-			http.Error(w, "Invalid ID", http.StatusBadRequest)
+	if !resolveTimes(w, &appointment, existing) {
+		return
+	}
+	if isStaff(claims) {
+		if !validate(w, appointment) || !checkVet(w, appointment) {
 			return
 		}
-
-		existingAppointment := models.GetAppointmentByID(id)
-		if existingAppointment == nil {
-			http.Error(w, "Appointment not found", http.StatusNotFound)
+	} else {
+		rescheduled := !appointment.StartsAt.Equal(existing.StartsAt) ||
+			appointment.VetID != existing.VetID || appointment.TypeID != existing.TypeID
+		if rescheduled {
+			if !models.IsUpcoming(existing.Status) {
+				http.Error(w, "Only upcoming appointments can be rescheduled", http.StatusConflict)
+				return
+			}
+			if !models.Rules.CanChange(*existing) {
+				http.Error(w, "Too late to reschedule online; please call the clinic", http.StatusForbidden)
+				return
+			}
+			if !prepareOwnerBooking(w, &appointment, existing.ID) {
+				return
+			}
+		} else {
+			// Owners cannot change how long a visit takes or where it happens
+			appointment.StartsAt = existing.StartsAt
+			appointment.EndsAt = existing.EndsAt
+			appointment.Date = existing.Date
+			appointment.Time = existing.Time
+			appointment.DurationMinutes = existing.DurationMinutes
+			appointment.Room = existing.Room
+		}
+		if !validate(w, appointment) {
 			return
 		}
-		if claims.Role != "staff" && claims.Role != "admin" && existingAppointment.OwnerID != claims.UserID {
+	}
+
+	updated, err := models.UpdateAppointment(existing.ID, appointment, claims.UserID)
+	if writeScheduleConflict(w, err) {
+		return
+	}
+	if err != nil {
+		utils.Error("Failed to update appointment: %v", err)
+		writeSaveError(w, err, "Update failed")
+		return
+	}
+	setETag(w, updated.Version)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteAppointment handles DELETE /appointments/{id}
+func DeleteAppointment(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	apt, ok := loadAppointment(w, r, claims)
+	if !ok || !checkIfMatch(w, r, apt.Version) {
+		return
+	}
+	if !isStaff(claims) && !models.Rules.CanChange(*apt) {
+		http.Error(w, "Too late to cancel online; please call the clinic", http.StatusForbidden)
+		return
+	}
+
+	err := models.DeleteAppointment(apt.ID, apt.Version, claims.UserID)
+	if err != nil {
+		utils.Error("Failed to delete appointment: %v", err)
+		writeSaveError(w, err, "Delete failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// transitionAppointment moves the appointment to a new status and responds with the updated appointment.
+// Disallowed changes get a 409.
+func transitionAppointment(w http.ResponseWriter, claims *utils.Claims, apt *models.Appointment, to, note string) {
+	version, err := models.TransitionAppointment(apt.ID, to, claims.UserID, note)
+	var terr *models.TransitionError
+	if errors.As(err, &terr) {
+		http.Error(w, terr.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeSaveError(w, err, "Failed to change appointment status")
+		return
+	}
+	utils.Info("User %d moved appointment %d from %s to %s", claims.UserID, apt.ID, apt.Status, to)
+	apt.Status = to
+	apt.Version = version
+	setETag(w, apt.Version)
+	writeJSON(w, http.StatusOK, apt)
+}
+
+// ChangeAppointmentStatus handles POST /appointments/{id}/status with {"status": "...", "note": "..."}.
+// Staff can make any change the lifecycle allows; owners can only cancel, and not within the cancellation cutoff.
+func ChangeAppointmentStatus(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	apt, ok := loadAppointment(w, r, claims)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !models.IsStatus(body.Status) {
+		writeValidationError(w, &models.ValidationError{Fields: map[string]string{"status": "is not a known status"}})
+		return
+	}
+	if !isStaff(claims) {
+		if body.Status != models.StatusCancelled {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
-
-		err = models.DeleteAppointment(id)
-		if err != nil {
-			utils.Error("Failed to delete appointment: %v", err)
-			http.Error(w, "Delete failed", http.StatusInternalServerError)
+		if !models.Rules.CanChange(*apt) {
+			http.Error(w, "Too late to cancel online; please call the clinic", http.StatusForbidden)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+	}
+	transitionAppointment(w, claims, apt, body.Status, body.Note)
+}
+
+// ApproveAppointment handles POST /appointments/{id}/approve, confirming an owner's booking that was
+// waiting for staff approval. Staff only.
+func ApproveAppointment(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	apt, ok := loadAppointment(w, r, claims)
+	if !ok {
+		return
+	}
+	transitionAppointment(w, claims, apt, models.StatusConfirmed, "approved")
+}
 
-	default:
-		utils.Warn("Unsupported method: %s", r.Method)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// GetAppointmentHistory handles GET /appointments/{id}/history, listing its status changes oldest first
+func GetAppointmentHistory(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	apt, ok := loadAppointment(w, r, claims)
+	if !ok {
+		return
+	}
+
+	history, err := models.GetStatusHistory(apt.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch status history", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// GetQueue handles GET /queue[?date=YYYY-MM-DD], the front desk's list of the day's appointments still
+// in progress, waiting or expected. Defaults to today in the clinic's time zone.
+func GetQueue(w http.ResponseWriter, r *http.Request) {
+	day, ok := queryDate(w, r, "date")
+	if !ok {
+		return
+	}
+	if day.IsZero() {
+		day = time.Now().In(models.ClinicLocation)
+	}
+
+	queue, err := models.GetQueue(day)
+	if err != nil {
+		http.Error(w, "Failed to fetch queue", http.StatusInternalServerError)
+		return
+	}
+	apts := make([]models.Appointment, len(queue))
+	for i, e := range queue {
+		apts[i] = e.Appointment
+	}
+	models.AttachAppointmentAlerts(apts)
+	for i := range queue {
+		queue[i].PetAlerts = apts[i].PetAlerts
+	}
+	writeJSON(w, http.StatusOK, queue)
+}
+
+// ListAppointmentTimeIssues handles GET /admin/appointment-time-issues, the appointments whose old free-text
+// time could not be converted to a start timestamp and need correcting by hand
+func ListAppointmentTimeIssues(w http.ResponseWriter, r *http.Request) {
+	issues, err := models.ListTimeMigrationIssues()
+	if err != nil {
+		http.Error(w, "Failed to fetch appointment time issues", http.StatusInternalServerError)
+		return
 	}
+	writeJSON(w, http.StatusOK, issues)
 }
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// feedURL is the absolute URL of the calendar feed for token, as seen by the client that asked for it
+func feedURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/calendar/%s.ics", scheme, r.Host, token)
+}
+
+// IssueCalendarFeed handles POST /me/calendar-feed, creating a secret iCalendar feed URL for the caller.
+// Any earlier URL stops working.
+func IssueCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	token, err := models.IssueFeedToken(claims.UserID)
+	if err != nil {
+		http.Error(w, "Failed to create calendar feed", http.StatusInternalServerError)
+		return
+	}
+	utils.Info("User %d issued a new calendar feed URL", claims.UserID)
+	writeCreated(w, "/me/calendar-feed", map[string]string{"url": feedURL(r, token)})
+}
+
+// RevokeCalendarFeed handles DELETE /me/calendar-feed, disabling the caller's feed URL
+func RevokeCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	if err := models.RevokeFeedToken(claims.UserID); err != nil {
+		http.Error(w, "Failed to revoke calendar feed", http.StatusInternalServerError)
+		return
+	}
+	utils.Info("User %d revoked their calendar feed URL", claims.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CalendarFeed handles GET /calendar/{token}.ics. The secret token stands in for a login, since calendar
+// apps cannot send one. Owners get their pets' appointments; staff and admins get every appointment.
+func CalendarFeed(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(r.PathValue("file"), ".ics")
+	user, err := models.GetUserByFeedToken(token)
+	if err != nil {
+		http.Error(w, "Failed to fetch calendar feed", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "Calendar feed not found", http.StatusNotFound)
+		return
+	}
+
+	ownerID := 0
+	if user.Role != "staff" && user.Role != "admin" {
+		ownerID = user.ID
+	}
+	events, err := models.ListFeedEvents(ownerID)
+	if err != nil {
+		http.Error(w, "Failed to fetch calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(renderCalendar(events, ownerID != 0)))
+}
+
+// renderCalendar writes the events as an RFC 5545 calendar. Each appointment keeps its UID across fetches
+// and its version is the SEQUENCE, so calendar apps apply changes; cancelled ones are sent as CANCELLED.
+// Owner feeds carry a reminder the day before.
+func renderCalendar(events []models.FeedEvent, remind bool) string {
+	var b strings.Builder
+	line := func(name, value string) { writeICSLine(&b, name+":"+value) }
+	const stamp = "20060102T150405Z"
+	now := time.Now().UTC().Format(stamp)
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//petclinic//appointments//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", icsText(utils.ClinicName()+" appointments"))
+	for _, e := range events {
+		summary := e.TypeName
+		if summary == "" {
+			summary = e.Reason
+		}
+		if summary == "" {
+			summary = "Appointment"
+		}
+		status := "CONFIRMED"
+		switch {
+		case e.Cancelled:
+			status = "CANCELLED"
+		case e.Status == models.StatusRequested:
+			status = "TENTATIVE"
+		}
+
+		line("BEGIN", "VEVENT")
+		line("UID", fmt.Sprintf("appointment-%d@petclinic", e.ID))
+		line("DTSTAMP", now)
+		line("DTSTART", e.StartsAt.UTC().Format(stamp))
+		line("DTEND", e.EndsAt.UTC().Format(stamp))
+		line("SEQUENCE", fmt.Sprint(e.Version))
+		line("STATUS", status)
+		line("SUMMARY", icsText(e.PetName+": "+summary))
+		if e.Reason != "" {
+			line("DESCRIPTION", icsText(e.Reason))
+		}
+		location := utils.ClinicName()
+		if e.Room != "" {
+			location += ", " + e.Room
+		}
+		line("LOCATION", icsText(location))
+		if remind && !e.Cancelled {
+			line("BEGIN", "VALARM")
+			line("ACTION", "DISPLAY")
+			line("DESCRIPTION", icsText(e.PetName+": "+summary+" tomorrow"))
+			line("TRIGGER", "-P1D")
+			line("END", "VALARM")
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return b.String()
+}
+
+// icsText escapes a value for an iCalendar TEXT property
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writeICSLine writes one content line, folded at 75 octets without splitting a UTF-8 character
+func writeICSLine(b *strings.Builder, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74 // continuation lines start with a space
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
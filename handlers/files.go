@@ -2,14 +2,27 @@
 package handlers
 
 import (
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"petclinic/models"
+	"petclinic/utils"
+	"strconv"
+	"strings"
 )
 
+// UploadFileHandler handles POST /upload. The file may be linked to an owner and/or pet with the owner_id
+// and pet_id form fields; owners can only link files to themselves and their own pets.
 func UploadFileHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -22,6 +35,11 @@ func UploadFileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ownerID, petID, ok := fileLinks(w, r, claims)
+	if !ok {
+		return
+	}
+
 	// Retrieve the file from the form-data
 	file, handler, err := r.FormFile("file")
 	if err != nil {
@@ -30,15 +48,13 @@ func UploadFileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// to  sanitize and generate a unique file name
-	filename := filepath.Base(handler.Filename)    // simple sanitize
-	destPath := filepath.Join("uploads", filename) // save in uploads/
-
-	// Create des directory if doesnt exist
+	// Store under a generated name so uploads with the same name do not overwrite each other; the
+	// original name is kept in the record
+	filename := filepath.Base(handler.Filename)
 	os.MkdirAll("uploads", os.ModePerm)
-
-	dest, err := os.Create(destPath)
+	dest, destPath, err := createUpload(filename)
 	if err != nil {
+		utils.Error("Failed to create upload for %s: %v", filename, err)
 		http.Error(w, "Unable to save file", http.StatusInternalServerError)
 		return
 	}
@@ -46,16 +62,126 @@ func UploadFileHandler(w http.ResponseWriter, r *http.Request) {
 
 	_, err = io.Copy(dest, file)
 	if err != nil {
+		os.Remove(destPath)
 		http.Error(w, "Failed to save file", http.StatusInternalServerError)
 		return
 	}
 
-	fmt.Fprintf(w, "File uploaded successfully: %s", destPath)
+	record, err := models.AddFile(models.File{Filename: filename, Path: destPath, OwnerID: ownerID, PetID: petID})
+	if err != nil {
+		utils.Error("Failed to record uploaded file %s: %v", destPath, err)
+		os.Remove(destPath)
+		http.Error(w, "Failed to record file", http.StatusInternalServerError)
+		return
+	}
+
+	writeCreated(w, "/download?filename="+url.QueryEscape(filepath.Base(destPath)), record)
 }
 
+// DownloadFileHandler handles GET /download?filename=, where filename is the name the upload was stored
+// under (the last part of its path), and sends it with its original name. Files linked to an owner or pet
+// can only be downloaded by staff or that owner, and deleted files only by staff.
 func DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
-	filename := r.URL.Query().Get("filename")
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	filename := filepath.Base(r.URL.Query().Get("filename"))
 	filePath := filepath.Join("uploads", filename)
 
+	record, err := models.GetFileByPath(filePath)
+	if err != nil {
+		http.Error(w, "Failed to look up file", http.StatusInternalServerError)
+		return
+	}
+	if !isStaff(claims) {
+		// Files whose record was deleted, along with their owner or pet, are for staff only
+		if record == nil {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if !ownsFileLinks(claims, record.OwnerID, record.PetID) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	if record != nil {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": record.Filename}))
+	}
 	http.ServeFile(w, r, filePath)
 }
+
+// createUpload creates a new file in uploads/ with a random name, keeping the extension of filename
+func createUpload(filename string) (*os.File, string, error) {
+	for {
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, "", err
+		}
+		path := filepath.Join("uploads", hex.EncodeToString(buf)+strings.ToLower(filepath.Ext(filename)))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, path, err
+	}
+}
+
+// fileLinks reads the optional owner_id and pet_id form fields of an upload, writing a 400 if they are
+// malformed, a 422 if they name records that do not exist or do not belong together, and a 403 if an
+// owner names someone else's records
+func fileLinks(w http.ResponseWriter, r *http.Request, claims *utils.Claims) (int, int, bool) {
+	var ids [2]int
+	for i, name := range []string{"owner_id", "pet_id"} {
+		raw := r.FormValue(name)
+		if raw == "" {
+			continue
+		}
+		id, err := strconv.Atoi(raw)
+		if err != nil || id < 1 {
+			http.Error(w, "Invalid "+name, http.StatusBadRequest)
+			return 0, 0, false
+		}
+		ids[i] = id
+	}
+	ownerID, petID := ids[0], ids[1]
+
+	if ownerID != 0 {
+		owner, err := models.GetOwnerByID(ownerID)
+		if err != nil || owner == nil {
+			writeValidationError(w, &models.ValidationError{Fields: map[string]string{"owner_id": "does not exist"}})
+			return 0, 0, false
+		}
+	}
+	if petID != 0 {
+		pet, err := models.GetPetByID(petID)
+		if err != nil || pet == nil {
+			writeValidationError(w, &models.ValidationError{Fields: map[string]string{"pet_id": "does not exist"}})
+			return 0, 0, false
+		}
+		if ownerID != 0 && pet.OwnerID != ownerID {
+			writeValidationError(w, &models.ValidationError{Fields: map[string]string{"pet_id": "does not belong to the owner"}})
+			return 0, 0, false
+		}
+	}
+	if !isStaff(claims) && !ownsFileLinks(claims, ownerID, petID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return 0, 0, false
+	}
+	return ownerID, petID, true
+}
+
+// ownsFileLinks reports whether the owner and pet a file is linked to, where set, are the caller's
+func ownsFileLinks(claims *utils.Claims, ownerID, petID int) bool {
+	if ownerID != 0 && ownerID != claims.UserID {
+		return false
+	}
+	if petID != 0 {
+		pet, err := models.GetPetByID(petID)
+		if err != nil || pet == nil || pet.OwnerID != claims.UserID {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+)
+
+// CreateIntake handles POST /intake, registering a new client's owner record, first pet and
+// optional first appointment atomically.
+func CreateIntake(w http.ResponseWriter, r *http.Request) {
+	var in models.Intake
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if in.Appointment != nil && !checkVet(w, *in.Appointment) {
+		return
+	}
+
+	created, err := models.CreateIntake(in)
+	if err != nil {
+		var verr *models.ValidationError
+		if errors.As(err, &verr) {
+			writeValidationError(w, verr)
+			return
+		}
+		if writeScheduleConflict(w, err) {
+			return
+		}
+		http.Error(w, "Failed to register client", http.StatusInternalServerError)
+		return
+	}
+	writeCreated(w, fmt.Sprintf("/owners/%d", created.Owner.ID), created)
+}
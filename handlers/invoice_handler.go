@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"petclinic/models"
+	"petclinic/utils"
+)
+
+// loadInvoice fetches the invoice named by {id} and checks the caller may see it.
+// Staff and admin see every invoice; owners only their own once issued.
+func loadInvoice(w http.ResponseWriter, r *http.Request, claims *utils.Claims) (*models.Invoice, bool) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return nil, false
+	}
+	inv, err := models.GetInvoice(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch invoice", http.StatusInternalServerError)
+		return nil, false
+	}
+	if inv == nil {
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return nil, false
+	}
+	if !isStaff(claims) && (inv.OwnerID != claims.UserID || inv.Status == models.InvoiceDraft) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return inv, true
+}
+
+// checkInvoiceLinks writes a 422 unless the owner exists and the appointment, if any, is for one of their pets
+func checkInvoiceLinks(w http.ResponseWriter, inv models.Invoice) bool {
+	owner, err := models.GetOwnerByID(inv.OwnerID)
+	if err != nil || owner == nil {
+		writeValidationError(w, &models.ValidationError{Fields: map[string]string{"owner_id": "does not exist"}})
+		return false
+	}
+	if inv.AppointmentID != 0 {
+		apt := models.GetAppointmentByID(inv.AppointmentID)
+		if apt == nil || apt.OwnerID != inv.OwnerID {
+			writeValidationError(w, &models.ValidationError{Fields: map[string]string{
+				"appointment_id": "must be an appointment for one of the owner's pets",
+			}})
+			return false
+		}
+	}
+	return true
+}
+
+// writeInvoiceError maps an invoice save or status change error onto a response
+func writeInvoiceError(w http.ResponseWriter, err error, msg string) {
+	var verr *models.ValidationError
+	switch {
+	case errors.Is(err, models.ErrInvoiceNotDraft), errors.Is(err, models.ErrInvoiceNotIssued), errors.Is(err, models.ErrAppointmentInvoiced):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.As(err, &verr):
+		writeValidationError(w, verr)
+	default:
+		writeSaveError(w, err, msg)
+	}
+}
+
+// ListInvoices handles GET /invoices[?owner_id=&appointment_id=&status=]. Owners only see their own issued,
+// paid and void invoices.
+func ListInvoices(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+	ownerID, ok := queryInt(w, r, "owner_id")
+	if !ok {
+		return
+	}
+	appointmentID, ok := queryInt(w, r, "appointment_id")
+	if !ok {
+		return
+	}
+	filter := models.InvoiceFilter{OwnerID: ownerID, AppointmentID: appointmentID, Status: r.URL.Query().Get("status")}
+	if !isStaff(claims) {
+		filter.OwnerID = claims.UserID
+		filter.ExcludeDrafts = true
+	}
+
+	page, err := models.ListInvoices(filter, opts)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// CreateInvoice handles POST /invoices, starting a draft invoice for an owner
+func CreateInvoice(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+
+	var inv models.Invoice
+	err := json.NewDecoder(r.Body).Decode(&inv)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if inv.Lines == nil {
+		inv.Lines = []models.InvoiceLine{}
+	}
+	if !validate(w, inv) || !checkInvoiceLinks(w, inv) {
+		return
+	}
+
+	created, err := models.AddInvoice(inv, claims.UserID)
+	if err != nil {
+		writeInvoiceError(w, err, "Failed to add invoice")
+		return
+	}
+	setETag(w, created.Version)
+	writeCreated(w, fmt.Sprintf("/invoices/%d", created.ID), created)
+}
+
+// InvoiceAppointment handles POST /appointments/{id}/invoice, drafting an invoice for a completed appointment
+// from its type's price and the prescriptions written during it. Responds 409 if it is not completed or
+// already invoiced.
+func InvoiceAppointment(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	apt, ok := loadAppointment(w, r, claims)
+	if !ok {
+		return
+	}
+	if apt.Status != models.StatusCompleted {
+		http.Error(w, "Only completed appointments can be invoiced", http.StatusConflict)
+		return
+	}
+
+	inv, err := models.InvoiceForAppointment(*apt)
+	if err != nil {
+		http.Error(w, "Failed to draft invoice", http.StatusInternalServerError)
+		return
+	}
+	created, err := models.AddInvoice(inv, claims.UserID)
+	if err != nil {
+		writeInvoiceError(w, err, "Failed to add invoice")
+		return
+	}
+	utils.Info("User %d drafted invoice %d for appointment %d", claims.UserID, created.ID, apt.ID)
+	setETag(w, created.Version)
+	writeCreated(w, fmt.Sprintf("/invoices/%d", created.ID), created)
+}
+
+// GetInvoice handles GET /invoices/{id}
+func GetInvoice(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	inv, ok := loadInvoice(w, r, claims)
+	if !ok {
+		return
+	}
+	setETag(w, inv.Version)
+	writeJSON(w, http.StatusOK, inv)
+}
+
+// UpdateInvoice handles PUT /invoices/{id}, replacing a draft's owner, appointment, notes and lines.
+// Requires If-Match; responds 409 once the invoice has been issued.
+func UpdateInvoice(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	existing, ok := loadInvoice(w, r, claims)
+	if !ok {
+		return
+	}
+	if existing.Status != models.InvoiceDraft {
+		http.Error(w, models.ErrInvoiceNotDraft.Error(), http.StatusConflict)
+		return
+	}
+	if !checkIfMatch(w, r, existing.Version) {
+		return
+	}
+
+	var inv models.Invoice
+	err := json.NewDecoder(r.Body).Decode(&inv)
+	if err != nil {
+		utils.Error("Failed to decode PUT body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	inv.ID = existing.ID
+	inv.Version = existing.Version
+	if inv.Lines == nil {
+		inv.Lines = []models.InvoiceLine{}
+	}
+	if !validate(w, inv) || !checkInvoiceLinks(w, inv) {
+		return
+	}
+
+	updated, err := models.UpdateInvoice(inv)
+	if err != nil {
+		writeInvoiceError(w, err, "Failed to update invoice")
+		return
+	}
+	setETag(w, updated.Version)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteInvoice handles DELETE /invoices/{id}, discarding a draft. Requires If-Match; issued invoices are voided instead.
+func DeleteInvoice(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	inv, ok := loadInvoice(w, r, claims)
+	if !ok {
+		return
+	}
+	if inv.Status != models.InvoiceDraft {
+		http.Error(w, models.ErrInvoiceNotDraft.Error(), http.StatusConflict)
+		return
+	}
+	if !checkIfMatch(w, r, inv.Version) {
+		return
+	}
+
+	if err := models.DeleteInvoice(inv.ID, inv.Version); err != nil {
+		writeSaveError(w, err, "Failed to delete invoice")
+		return
+	}
+	utils.Info("User %d deleted draft invoice %d", claims.UserID, inv.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// IssueInvoice handles POST /invoices/{id}/issue, numbering a draft and making it visible to the owner
+func IssueInvoice(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	inv, ok := loadInvoice(w, r, claims)
+	if !ok {
+		return
+	}
+
+	issued, err := models.IssueInvoice(inv.ID)
+	if err != nil {
+		writeInvoiceError(w, err, "Failed to issue invoice")
+		return
+	}
+	utils.Info("User %d issued invoice %s", claims.UserID, issued.Number)
+	setETag(w, issued.Version)
+	writeJSON(w, http.StatusOK, issued)
+}
+
+// PayInvoice handles POST /invoices/{id}/pay with an optional {"method": "card", "reference": "..."}
+func PayInvoice(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	inv, ok := loadInvoice(w, r, claims)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Method    string `json:"method"`
+		Reference string `json:"reference"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	paid, err := models.PayInvoice(inv.ID, body.Method, body.Reference)
+	if err != nil {
+		writeInvoiceError(w, err, "Failed to record payment")
+		return
+	}
+	utils.Info("User %d recorded payment of invoice %s", claims.UserID, paid.Number)
+	setETag(w, paid.Version)
+	writeJSON(w, http.StatusOK, paid)
+}
+
+// VoidInvoice handles POST /invoices/{id}/void with an optional {"reason": "..."}
+func VoidInvoice(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	inv, ok := loadInvoice(w, r, claims)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	voided, err := models.VoidInvoice(inv.ID, body.Reason)
+	if err != nil {
+		writeInvoiceError(w, err, "Failed to void invoice")
+		return
+	}
+	utils.Info("User %d voided invoice %s", claims.UserID, voided.Number)
+	setETag(w, voided.Version)
+	writeJSON(w, http.StatusOK, voided)
+}
+
+// formatCents writes an amount in minor units as a decimal, e.g. -1250 as -12.50
+func formatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+var invoicePrintTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{"money": formatCents}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Invoice {{or .Invoice.Number "(draft)"}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; }
+table { border-collapse: collapse; width: 100%; }
+th { text-align: left; }
+th, td { padding: 0.3em; border-bottom: 1px solid #ccc; }
+.amount { text-align: right; }
+.status { text-transform: uppercase; font-weight: bold; }
+@media print { .noprint { display: none; } }
+</style>
+</head>
+<body>
+<h1>{{.Clinic}}</h1>
+<h2>Invoice {{or .Invoice.Number "(draft)"}} <span class="status">{{.Invoice.Status}}</span></h2>
+<p>
+{{if .Owner}}Bill to: {{.Owner.Name}}{{if .Owner.Contact}}, {{.Owner.Contact}}{{end}}<br>{{end}}
+{{if .Invoice.IssuedOn}}Issued: {{.Invoice.IssuedOn.Format "2006-01-02"}}<br>{{end}}
+{{if .Invoice.DueOn}}Due: {{.Invoice.DueOn.Format "2006-01-02"}}<br>{{end}}
+{{if .Invoice.PaidAt}}Paid: {{.Invoice.PaidAt.Format "2006-01-02"}}{{if .Invoice.PaymentMethod}} by {{.Invoice.PaymentMethod}}{{end}}<br>{{end}}
+{{if .Invoice.VoidedAt}}Voided: {{.Invoice.VoidedAt.Format "2006-01-02"}}{{if .Invoice.VoidReason}} ({{.Invoice.VoidReason}}){{end}}<br>{{end}}
+</p>
+<table>
+<tr><th>Description</th><th class="amount">Qty</th><th class="amount">Unit price</th><th class="amount">Tax</th><th class="amount">Amount</th></tr>
+{{range .Invoice.Lines}}<tr><td>{{.Description}}</td><td class="amount">{{.Quantity}}</td><td class="amount">{{money .UnitPriceCents}}</td><td class="amount">{{.TaxRate}}%</td><td class="amount">{{money .NetCents}}</td></tr>
+{{end}}<tr><th colspan="4" class="amount">Subtotal</th><td class="amount">{{money .Invoice.SubtotalCents}}</td></tr>
+{{if .Invoice.DiscountCents}}<tr><th colspan="4" class="amount">Discount</th><td class="amount">-{{money .Invoice.DiscountCents}}</td></tr>{{end}}
+<tr><th colspan="4" class="amount">Tax</th><td class="amount">{{money .Invoice.TaxCents}}</td></tr>
+<tr><th colspan="4" class="amount">Total{{if .Currency}} ({{.Currency}}){{end}}</th><td class="amount"><strong>{{money .Invoice.TotalCents}}</strong></td></tr>
+</table>
+{{if .Invoice.Notes}}<p>{{.Invoice.Notes}}</p>{{end}}
+<button class="noprint" onclick="window.print()">Print</button>
+</body>
+</html>
+`))
+
+// PrintInvoice handles GET /invoices/{id}/print, rendering a printable HTML page
+func PrintInvoice(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	inv, ok := loadInvoice(w, r, claims)
+	if !ok {
+		return
+	}
+	owner, _ := models.GetOwnerByID(inv.OwnerID)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := invoicePrintTemplate.Execute(w, map[string]interface{}{
+		"Clinic":   utils.ClinicName(),
+		"Currency": os.Getenv("CURRENCY"),
+		"Invoice":  inv,
+		"Owner":    owner,
+	})
+	if err != nil {
+		utils.Error("Failed to render invoice %d: %v", inv.ID, err)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+)
+
+// ListPetRecords handles GET /pets/{id}/records. Pass current=true to hide entries that were amended.
+func ListPetRecords(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := models.ListMedicalRecords(pet.ID, r.URL.Query().Get("current") == "true", opts)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// GetPetRecord handles GET /pets/{id}/records/{rid}
+func GetPetRecord(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	rid, ok := pathID(w, r, "rid")
+	if !ok {
+		return
+	}
+
+	record, err := models.GetMedicalRecordByID(pet.ID, rid)
+	if err != nil || record == nil {
+		http.Error(w, "Record not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
+
+// CreatePetRecord handles POST /pets/{id}/records, appending a new entry authored by the logged in user
+func CreatePetRecord(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	addPetRecord(w, r, claims, pet, 0)
+}
+
+// AmendPetRecord handles POST /pets/{id}/records/{rid}/amendments. The original entry is kept and
+// marked as superseded by the new one.
+func AmendPetRecord(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	rid, ok := pathID(w, r, "rid")
+	if !ok {
+		return
+	}
+
+	original, err := models.GetMedicalRecordByID(pet.ID, rid)
+	if err != nil || original == nil {
+		http.Error(w, "Record not found", http.StatusNotFound)
+		return
+	}
+	if original.SupersededBy != 0 {
+		http.Error(w, models.ErrAlreadyAmended.Error(), http.StatusConflict)
+		return
+	}
+	addPetRecord(w, r, claims, pet, original.ID)
+}
+
+// addPetRecord decodes a record entry from the body and appends it to the pet's record
+func addPetRecord(w http.ResponseWriter, r *http.Request, claims *utils.Claims, pet *models.Pet, amendsID int) {
+	var record models.MedicalRecord
+	err := json.NewDecoder(r.Body).Decode(&record)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	record.PetID = pet.ID
+	record.AuthorID = claims.UserID
+	record.AmendsID = amendsID
+	record.SupersededBy = 0
+	if !validate(w, record) {
+		return
+	}
+	if record.AppointmentID != 0 {
+		apt := models.GetAppointmentByID(record.AppointmentID)
+		if apt == nil || apt.PetID != pet.ID {
+			writeValidationError(w, &models.ValidationError{Fields: map[string]string{
+				"appointment_id": "must be an appointment for this pet",
+			}})
+			return
+		}
+	}
+
+	created, err := models.AddMedicalRecord(record)
+	if errors.Is(err, models.ErrAlreadyAmended) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to add record", http.StatusInternalServerError)
+		return
+	}
+	writeCreated(w, fmt.Sprintf("/pets/%d/records/%d", pet.ID, created.ID), created)
+}
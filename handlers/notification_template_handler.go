@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"petclinic/models"
+	"petclinic/notify"
+	"petclinic/utils"
+	"strconv"
+)
+
+// loadNotificationTemplate fetches the version in use for the {kind}/{channel}/{locale} path segments.
+// A locale without a saved version yet comes back as an empty version 0, so admins can add one.
+func loadNotificationTemplate(w http.ResponseWriter, r *http.Request) (*models.NotificationTemplate, bool) {
+	kind, channel, locale := r.PathValue("kind"), r.PathValue("channel"), r.PathValue("locale")
+	if _, ok := notify.Default(kind, channel); !ok {
+		http.Error(w, "Notification template not found", http.StatusNotFound)
+		return nil, false
+	}
+	t, err := models.GetNotificationTemplate(kind, channel, locale)
+	if err != nil {
+		http.Error(w, "Failed to fetch notification template", http.StatusInternalServerError)
+		return nil, false
+	}
+	if t == nil {
+		t = &models.NotificationTemplate{Kind: kind, Channel: channel, Locale: locale}
+	}
+	return t, true
+}
+
+// writeTemplateError responds 422 for a template that does not render, and reports whether it did
+func writeTemplateError(w http.ResponseWriter, err error) bool {
+	var terr *notify.TemplateError
+	if !errors.As(err, &terr) {
+		return false
+	}
+	writeValidationError(w, &models.ValidationError{Fields: map[string]string{terr.Field: terr.Err.Error()}})
+	return true
+}
+
+// ListNotificationTemplates handles GET /notification-templates, the version in use of every template
+func ListNotificationTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := models.ListNotificationTemplates()
+	if err != nil {
+		http.Error(w, "Failed to fetch notification templates", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, templates)
+}
+
+// GetNotificationTemplate handles GET /notification-templates/{kind}/{channel}/{locale}. The ETag is the version.
+func GetNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := loadNotificationTemplate(w, r)
+	if !ok {
+		return
+	}
+	if t.Text == "" {
+		http.Error(w, "Notification template not found", http.StatusNotFound)
+		return
+	}
+	setETag(w, t.Version)
+	writeJSON(w, http.StatusOK, t)
+}
+
+// UpdateNotificationTemplate handles PUT /notification-templates/{kind}/{channel}/{locale} with
+// {"subject": "...", "text": "...", "html": "..."}, saving a new version. Requires If-Match with the
+// version edited ("0" for the built-in wording or a new locale). Responds 422 if the template does not
+// render against sample data.
+func UpdateNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	current, ok := loadNotificationTemplate(w, r)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, current.Version) {
+		return
+	}
+
+	var src notify.Template
+	if err := json.NewDecoder(r.Body).Decode(&src); err != nil {
+		utils.Error("Failed to decode PUT body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	t := models.NotificationTemplate{Kind: current.Kind, Channel: current.Channel, Locale: current.Locale, Template: src}
+	if !validate(w, t) {
+		return
+	}
+
+	saved, err := models.SaveNotificationTemplate(t, current.Version, claims.UserID)
+	if err != nil {
+		writeSaveError(w, err, "Failed to save notification template")
+		return
+	}
+	utils.Info("User %d saved notification template %s/%s/%s version %d", claims.UserID, saved.Kind, saved.Channel, saved.Locale, saved.Version)
+	setETag(w, saved.Version)
+	writeJSON(w, http.StatusOK, saved)
+}
+
+// ListNotificationTemplateVersions handles GET /notification-templates/{kind}/{channel}/{locale}/versions,
+// every saved version newest first
+func ListNotificationTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	current, ok := loadNotificationTemplate(w, r)
+	if !ok {
+		return
+	}
+	versions, err := models.ListNotificationTemplateVersions(current.Kind, current.Channel, current.Locale)
+	if err != nil {
+		http.Error(w, "Failed to fetch notification template versions", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// RollbackNotificationTemplate handles POST /notification-templates/{kind}/{channel}/{locale}/rollback with
+// {"version": N}, saving a copy of version N (0 for the built-in wording) as the newest version. Requires
+// If-Match with the version in use.
+func RollbackNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	current, ok := loadNotificationTemplate(w, r)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, current.Version) {
+		return
+	}
+
+	var body struct {
+		Version *int `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Version == nil {
+		http.Error(w, "Invalid request body: version is required", http.StatusBadRequest)
+		return
+	}
+	target, err := models.GetNotificationTemplateVersion(current.Kind, current.Channel, current.Locale, *body.Version)
+	if err != nil {
+		http.Error(w, "Failed to fetch notification template version", http.StatusInternalServerError)
+		return
+	}
+	if target == nil {
+		http.Error(w, "Notification template version not found", http.StatusNotFound)
+		return
+	}
+
+	t := models.NotificationTemplate{Kind: current.Kind, Channel: current.Channel, Locale: current.Locale,
+		Template: target.Template, RolledBackFrom: body.Version}
+	saved, err := models.SaveNotificationTemplate(t, current.Version, claims.UserID)
+	if err != nil {
+		writeSaveError(w, err, "Failed to roll back notification template")
+		return
+	}
+	utils.Info("User %d rolled notification template %s/%s/%s back to version %d as version %d",
+		claims.UserID, saved.Kind, saved.Channel, saved.Locale, *body.Version, saved.Version)
+	setETag(w, saved.Version)
+	writeJSON(w, http.StatusOK, saved)
+}
+
+// PreviewNotificationTemplate handles POST /notification-templates/{kind}/{channel}/{locale}/preview[?version=N],
+// rendering the template in the body against sample data without saving it. With an empty body it renders
+// version N, or the version in use.
+func PreviewNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	current, ok := loadNotificationTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	var src notify.Template
+	if err := json.NewDecoder(r.Body).Decode(&src); err != nil && err != io.EOF {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if src.Text == "" {
+		src = current.Template
+		if raw := r.URL.Query().Get("version"); raw != "" {
+			version, err := strconv.Atoi(raw)
+			if err != nil {
+				http.Error(w, "Invalid version", http.StatusBadRequest)
+				return
+			}
+			t, err := models.GetNotificationTemplateVersion(current.Kind, current.Channel, current.Locale, version)
+			if err != nil {
+				http.Error(w, "Failed to fetch notification template version", http.StatusInternalServerError)
+				return
+			}
+			if t == nil {
+				http.Error(w, fmt.Sprintf("Notification template version %d not found", version), http.StatusNotFound)
+				return
+			}
+			src = t.Template
+		}
+	}
+	if src.Text == "" {
+		http.Error(w, "Notification template not found", http.StatusNotFound)
+		return
+	}
+
+	msg, err := src.Render("", notify.SampleData(current.Kind))
+	if writeTemplateError(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to render notification template", http.StatusInternalServerError)
+		return
+	}
+	preview := map[string]string{"text": msg.Body}
+	if current.Channel == models.ChannelEmail {
+		preview["subject"] = msg.Subject
+		preview["html"] = msg.HTML
+	}
+	writeJSON(w, http.StatusOK, preview)
+}
@@ -2,109 +2,262 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"petclinic/models"
 	"petclinic/utils"
-	"strconv"
 )
 
-func OwnersHandler(w http.ResponseWriter, r *http.Request) {
-	utils.Info("Received %s request at %s", r.Method, r.URL.Path)
-
-	claimsVal := r.Context().Value("userClaims")
-	claims, ok := claimsVal.(*utils.Claims)
-	if !ok || claims == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	switch r.Method {
-	case http.MethodGet:
-		// Staff/admin see all; owner sees only self
-		if claims.Role == "owner" {
-			owner, err := models.GetOwnerByID(claims.UserID)
-			if err != nil || owner == nil {
-				http.Error(w, "Owner not found", http.StatusNotFound)
-				return
-			}
-			json.NewEncoder(w).Encode([]*models.Owner{owner})
-		} else {
-			owners := models.GetAllOwners()
-			if owners == nil {
-				utils.Warn("No owners found in database")
-			}
-			json.NewEncoder(w).Encode(owners)
-		}
+// loadOwner fetches the owner named by the {id} path segment and checks the caller may access it.
+// Staff and admin can access any owner; owners only themselves.
+func loadOwner(w http.ResponseWriter, r *http.Request, claims *utils.Claims) (*models.Owner, bool) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return nil, false
+	}
+	if !isStaff(claims) && claims.UserID != id {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	owner, err := models.GetOwnerByID(id)
+	if err != nil || owner == nil {
+		http.Error(w, "Owner not found", http.StatusNotFound)
+		return nil, false
+	}
+	return owner, true
+}
 
-	case http.MethodPost:
-		if claims.Role != "staff" && claims.Role != "admin" {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-		var owner models.Owner
-		err := json.NewDecoder(r.Body).Decode(&owner)
-		if err != nil {
-			utils.Error("Failed to decode POST body: %v", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-		err = models.AddOwner(owner)
-		if err != nil {
-			utils.Error("Error adding owner in DB: %v", err)
-			http.Error(w, "Failed to add owner", http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusCreated)
+// ListOwners handles GET /owners. Staff/admin see all owners, filtered by name and email;
+// an owner sees only themselves.
+func ListOwners(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	filter := models.OwnerFilter{Name: q.Get("name"), Email: q.Get("email")}
+	if claims.Role == "owner" {
+		filter.ID = claims.UserID
+	}
 
-	case http.MethodPut:
-		id, err := strconv.Atoi(r.URL.Query().Get("id"))
-		if err != nil {
-			utils.Warn("Invalid owner ID provided for update")
-			http.Error(w, "Invalid ID", http.StatusBadRequest)
-			return
-		}
-		// Only staff/admin or owner themselves can update
-		if claims.Role != "staff" && claims.Role != "admin" && claims.UserID != id {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-		var owner models.Owner
-		err = json.NewDecoder(r.Body).Decode(&owner)
-		if err != nil {
-			utils.Error("Failed to decode PUT body: %v", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-		err = models.UpdateOwner(id, owner)
-		if err != nil {
-			utils.Error("Error updating owner in DB: %v", err)
-			http.Error(w, "Failed to update owner", http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
+	page, err := models.ListOwners(filter, opts)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
 
-	case http.MethodDelete:
-		id, err := strconv.Atoi(r.URL.Query().Get("id"))
-		if err != nil {
-			utils.Warn("Invalid owner ID for deletion")
-			http.Error(w, "Invalid ID", http.StatusBadRequest)
-			return
-		}
-		// Only staff/admin can delete
-		if claims.Role != "staff" && claims.Role != "admin" {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-		err = models.DeleteOwner(id)
-		if err != nil {
-			utils.Error("Error deleting owner in DB: %v", err)
-			http.Error(w, "Failed to delete owner", http.StatusInternalServerError)
+// CreateOwner handles POST /owners
+func CreateOwner(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	if !isStaff(claims) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var owner models.Owner
+	err := json.NewDecoder(r.Body).Decode(&owner)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validate(w, owner) {
+		return
+	}
+	created, err := models.AddOwner(owner)
+	if err != nil {
+		utils.Error("Error adding owner in DB: %v", err)
+		http.Error(w, "Failed to add owner", http.StatusInternalServerError)
+		return
+	}
+	setETag(w, created.Version)
+	writeCreated(w, fmt.Sprintf("/owners/%d", created.ID), created)
+}
+
+// GetOwner handles GET /owners/{id}
+func GetOwner(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	owner, ok := loadOwner(w, r, claims)
+	if !ok {
+		return
+	}
+	setETag(w, owner.Version)
+	writeJSON(w, http.StatusOK, owner)
+}
+
+// UpdateOwner handles PUT /owners/{id}, replacing every field of the owner
+func UpdateOwner(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	existing, ok := loadOwner(w, r, claims)
+	if !ok || !checkIfMatch(w, r, existing.Version) {
+		return
+	}
+
+	var owner models.Owner
+	err := json.NewDecoder(r.Body).Decode(&owner)
+	if err != nil {
+		utils.Error("Failed to decode PUT body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	saveOwner(w, existing, owner)
+}
+
+// PatchOwner handles PATCH /owners/{id}, applying the body as a JSON merge patch (RFC 7396)
+func PatchOwner(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	existing, ok := loadOwner(w, r, claims)
+	if !ok || !checkIfMatch(w, r, existing.Version) {
+		return
+	}
+
+	var owner models.Owner
+	if !decodeMergePatch(w, r, existing, &owner) {
+		return
+	}
+	saveOwner(w, existing, owner)
+}
+
+// saveOwner writes owner over existing and responds with the stored result
+func saveOwner(w http.ResponseWriter, existing *models.Owner, owner models.Owner) {
+	owner.ID = existing.ID
+	owner.Version = existing.Version
+	if !validate(w, owner) {
+		return
+	}
+	updated, err := models.UpdateOwner(existing.ID, owner)
+	if err != nil {
+		utils.Error("Error updating owner in DB: %v", err)
+		writeSaveError(w, err, "Failed to update owner")
+		return
+	}
+	setETag(w, updated.Version)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// GetOwnerDependencies handles GET /owners/{id}/dependencies, previewing what deleting the owner would affect.
+func GetOwnerDependencies(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	if !isStaff(claims) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	owner, ok := loadOwner(w, r, claims)
+	if !ok {
+		return
+	}
+
+	deps, err := models.GetOwnerDependencies(owner.ID)
+	if err != nil {
+		http.Error(w, "Failed to count dependencies", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, deps)
+}
+
+// DeleteOwner handles DELETE /owners/{id}. Only staff/admin can delete.
+// The strategy query parameter chooses what happens to the owner's pets, appointments and files:
+// block (default) refuses with 409 if any exist, cascade deletes them too, and reassign moves them
+// to the owner given by reassign_to.
+func DeleteOwner(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	if !isStaff(claims) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	owner, ok := loadOwner(w, r, claims)
+	if !ok || !checkIfMatch(w, r, owner.Version) {
+		return
+	}
+
+	reassignTo, ok := queryInt(w, r, "reassign_to")
+	if !ok {
+		return
+	}
+	strategy := r.URL.Query().Get("strategy")
+	switch strategy {
+	case "", models.DeleteBlock, models.DeleteCascade:
+	case models.DeleteReassign:
+		if reassignTo == 0 {
+			http.Error(w, "reassign_to is required for the reassign strategy", http.StatusBadRequest)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
-
 	default:
-		utils.Warn("Unsupported method: %s", r.Method)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		http.Error(w, "strategy must be block, cascade or reassign", http.StatusBadRequest)
+		return
+	}
+
+	_, err := models.DeleteOwner(owner.ID, owner.Version, models.OwnerDeletion{
+		Strategy:   strategy,
+		ReassignTo: reassignTo,
+		DeletedBy:  claims.UserID,
+	})
+	var depErr *models.DependentsError
+	switch {
+	case errors.As(err, &depErr):
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":        "owner has dependent records; choose strategy=cascade or strategy=reassign",
+			"dependencies": depErr.Dependencies,
+		})
+		return
+	case errors.Is(err, models.ErrInvalidReassignTarget):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		utils.Error("Error deleting owner in DB: %v", err)
+		writeSaveError(w, err, "Failed to delete owner")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListOwnerPets handles GET /owners/{id}/pets
+func ListOwnerPets(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	owner, ok := loadOwner(w, r, claims)
+	if !ok {
+		return
+	}
+	listPets(w, r, owner.ID)
+}
+
+// ListOwnerAppointments handles GET /owners/{id}/appointments
+func ListOwnerAppointments(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	owner, ok := loadOwner(w, r, claims)
+	if !ok {
+		return
 	}
+	listAppointments(w, r, models.AppointmentFilter{OwnerID: owner.ID})
 }
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+)
+
+// loadPetAlert fetches the alert named by {aid} on the given pet
+func loadPetAlert(w http.ResponseWriter, r *http.Request, pet *models.Pet) (*models.PetAlert, bool) {
+	id, ok := pathID(w, r, "aid")
+	if !ok {
+		return nil, false
+	}
+	alert, err := models.GetPetAlertByID(pet.ID, id)
+	if err != nil || alert == nil {
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return nil, false
+	}
+	return alert, true
+}
+
+// ListPetAlerts handles GET /pets/{id}/alerts
+func ListPetAlerts(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+
+	alerts, err := models.GetAlertsForPets([]int{pet.ID})
+	if err != nil {
+		http.Error(w, "Failed to fetch alerts", http.StatusInternalServerError)
+		return
+	}
+	list := alerts[pet.ID]
+	if list == nil {
+		list = []models.PetAlert{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// CreatePetAlert handles POST /pets/{id}/alerts. Staff only.
+func CreatePetAlert(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+
+	alert := models.PetAlert{Category: "other", Severity: models.SeverityWarning}
+	err := json.NewDecoder(r.Body).Decode(&alert)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	alert.PetID = pet.ID
+	alert.CreatedBy = claims.UserID
+	if !validate(w, alert) {
+		return
+	}
+
+	created, err := models.AddPetAlert(alert)
+	if err != nil {
+		http.Error(w, "Failed to add alert", http.StatusInternalServerError)
+		return
+	}
+	writeCreated(w, fmt.Sprintf("/pets/%d/alerts/%d", pet.ID, created.ID), created)
+}
+
+// PatchPetAlert handles PATCH /pets/{id}/alerts/{aid} with a JSON merge patch. Staff only.
+func PatchPetAlert(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	existing, ok := loadPetAlert(w, r, pet)
+	if !ok {
+		return
+	}
+
+	var alert models.PetAlert
+	if !decodeMergePatch(w, r, existing, &alert) {
+		return
+	}
+	alert.ID, alert.PetID = existing.ID, existing.PetID
+	alert.CreatedBy, alert.CreatedAt = existing.CreatedBy, existing.CreatedAt
+	if !validate(w, alert) {
+		return
+	}
+
+	if err := models.UpdatePetAlert(alert); err != nil {
+		http.Error(w, "Failed to update alert", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, alert)
+}
+
+// DeletePetAlert handles DELETE /pets/{id}/alerts/{aid}. Staff only.
+func DeletePetAlert(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	alert, ok := loadPetAlert(w, r, pet)
+	if !ok {
+		return
+	}
+
+	if err := models.DeletePetAlert(alert.ID); err != nil {
+		http.Error(w, "Failed to delete alert", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,131 +2,216 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"petclinic/models"
 	"petclinic/utils"
-	"strconv"
 )
 
-func PetsHandler(w http.ResponseWriter, r *http.Request) {
-	utils.Info("Received %s request at %s", r.Method, r.URL.Path)
-
-	claimsVal := r.Context().Value("userClaims")
-	claims, ok := claimsVal.(*utils.Claims)
-	if !ok || claims == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	switch r.Method {
-	case http.MethodGet:
-		if claims.Role == "owner" {
-			pets := models.GetPetsByOwnerID(claims.UserID)
-			if pets == nil {
-				utils.Warn("No pets found for owner")
-				pets = []models.Pet{}
-			}
-			json.NewEncoder(w).Encode(pets)
-		} else {
-			pets := models.GetAllPets()
-			if pets == nil {
-				utils.Warn("No pets found in database")
-				pets = []models.Pet{}
-			}
-			json.NewEncoder(w).Encode(pets)
-		}
-
-	case http.MethodPost:
-		var pet models.Pet
-		err := json.NewDecoder(r.Body).Decode(&pet)
-		if err != nil {
-			utils.Error("Failed to decode POST body: %v", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-
-		// Owner role: always set owner_id to claims.UserID
-		if claims.Role == "owner" {
-			pet.OwnerID = claims.UserID
-		} else if claims.Role != "staff" && claims.Role != "admin" {
-			// If not owner, staff, or admin, forbid
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-		// For staff and admin, owner_id from body is used
-
-		err = models.AddPet(pet)
-		if err != nil {
-			utils.Error("Error adding pet in DB: %v", err)
-			http.Error(w, "Failed to add pet", http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusCreated)
-
-	case http.MethodPut:
-		id, err := strconv.Atoi(r.URL.Query().Get("id"))
-		if err != nil {
-			utils.Warn("Invalid pet ID provided for update")
-			http.Error(w, "Invalid ID", http.StatusBadRequest)
-			return
-		}
-
-		existingPet, err := models.GetPetByID(id)
-		if err != nil || existingPet == nil {
-			http.Error(w, "Pet not found", http.StatusNotFound)
-			return
-		}
-		// Only staff, admin, or owner of pet can update
-		if claims.Role != "staff" && claims.Role != "admin" && existingPet.OwnerID != claims.UserID {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-
-		var pet models.Pet
-		err = json.NewDecoder(r.Body).Decode(&pet)
-		if err != nil {
-			utils.Error("Failed to decode PUT body: %v", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-
-		err = models.UpdatePet(id, pet)
-		if err != nil {
-			utils.Error("Error updating pet in DB: %v", err)
-			http.Error(w, "Failed to update pet", http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-
-	case http.MethodDelete:
-		id, err := strconv.Atoi(r.URL.Query().Get("id"))
-		if err != nil {
-			utils.Warn("Invalid pet ID for deletion")
-			http.Error(w, "Invalid ID", http.StatusBadRequest)
-			return
-		}
-
-		existingPet, err := models.GetPetByID(id)
-		if err != nil || existingPet == nil {
-			http.Error(w, "Pet not found", http.StatusNotFound)
-			return
-		}
-		// Only staff, admin, or owner of pet can delete
-		if claims.Role != "staff" && claims.Role != "admin" && existingPet.OwnerID != claims.UserID {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-
-		err = models.DeletePet(id)
-		if err != nil {
-			utils.Error("Error deleting pet in DB: %v", err)
-			http.Error(w, "Failed to delete pet", http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-
-	default:
-		utils.Warn("Unsupported method: %s", r.Method)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// loadPet fetches the pet named by the {id} path segment and checks the caller may access it.
+// Staff and admin can access any pet; owners only their own.
+func loadPet(w http.ResponseWriter, r *http.Request, claims *utils.Claims) (*models.Pet, bool) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return nil, false
 	}
+	pet, err := models.GetPetByID(id)
+	if err != nil || pet == nil {
+		http.Error(w, "Pet not found", http.StatusNotFound)
+		return nil, false
+	}
+	if !isStaff(claims) && pet.OwnerID != claims.UserID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return pet, true
+}
+
+// ListPets handles GET /pets. Supports species, breed, name and owner_id filters plus paging and sorting;
+// owners only ever see their own pets.
+func ListPets(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	ownerID, ok := queryInt(w, r, "owner_id")
+	if !ok {
+		return
+	}
+	if claims.Role == "owner" {
+		ownerID = claims.UserID
+	}
+	listPets(w, r, ownerID)
+}
+
+// listPets writes the page of pets selected by the request's query parameters, scoped to ownerID if non-zero
+func listPets(w http.ResponseWriter, r *http.Request, ownerID int) {
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	filter := models.PetFilter{
+		OwnerID: ownerID,
+		Species: q.Get("species"),
+		Breed:   q.Get("breed"),
+		Name:    q.Get("name"),
+	}
+
+	page, err := models.ListPets(filter, opts)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	models.AttachPetAlerts(page.Items)
+	writeJSON(w, http.StatusOK, page)
+}
+
+// CreatePet handles POST /pets
+func CreatePet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+
+	var pet models.Pet
+	err := json.NewDecoder(r.Body).Decode(&pet)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Owner role: always set owner_id to claims.UserID
+	if claims.Role == "owner" {
+		pet.OwnerID = claims.UserID
+	} else if !isStaff(claims) {
+		// If not owner, staff, or admin, forbid
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	// For staff and admin, owner_id from body is used
+	if !validate(w, pet) {
+		return
+	}
+
+	created, err := models.AddPet(pet)
+	if err != nil {
+		utils.Error("Error adding pet in DB: %v", err)
+		http.Error(w, "Failed to add pet", http.StatusInternalServerError)
+		return
+	}
+	setETag(w, created.Version)
+	writeCreated(w, fmt.Sprintf("/pets/%d", created.ID), created)
+}
+
+// GetPet handles GET /pets/{id}
+func GetPet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	pets := []models.Pet{*pet}
+	models.AttachPetAlerts(pets)
+	setETag(w, pet.Version)
+	writeJSON(w, http.StatusOK, pets[0])
+}
+
+// UpdatePet handles PUT /pets/{id}, replacing every field of the pet
+func UpdatePet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	existing, ok := loadPet(w, r, claims)
+	if !ok || !checkIfMatch(w, r, existing.Version) {
+		return
+	}
+
+	var pet models.Pet
+	err := json.NewDecoder(r.Body).Decode(&pet)
+	if err != nil {
+		utils.Error("Failed to decode PUT body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	savePet(w, claims, existing, pet)
+}
+
+// PatchPet handles PATCH /pets/{id}, applying the body as a JSON merge patch (RFC 7396)
+func PatchPet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	existing, ok := loadPet(w, r, claims)
+	if !ok || !checkIfMatch(w, r, existing.Version) {
+		return
+	}
+
+	var pet models.Pet
+	if !decodeMergePatch(w, r, existing, &pet) {
+		return
+	}
+	savePet(w, claims, existing, pet)
+}
+
+// savePet writes pet over existing and responds with the stored result
+func savePet(w http.ResponseWriter, claims *utils.Claims, existing *models.Pet, pet models.Pet) {
+	// Owners cannot hand their pets over to someone else
+	if !isStaff(claims) {
+		pet.OwnerID = existing.OwnerID
+	}
+	pet.ID = existing.ID
+	pet.Version = existing.Version
+	pet.Alerts = nil
+	if !validate(w, pet) {
+		return
+	}
+
+	updated, err := models.UpdatePet(existing.ID, pet)
+	if err != nil {
+		utils.Error("Error updating pet in DB: %v", err)
+		writeSaveError(w, err, "Failed to update pet")
+		return
+	}
+	setETag(w, updated.Version)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeletePet handles DELETE /pets/{id}
+func DeletePet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok || !checkIfMatch(w, r, pet.Version) {
+		return
+	}
+
+	err := models.DeletePet(pet.ID, pet.Version, claims.UserID)
+	if err != nil {
+		utils.Error("Error deleting pet in DB: %v", err)
+		writeSaveError(w, err, "Failed to delete pet")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListPetAppointments handles GET /pets/{id}/appointments
+func ListPetAppointments(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	listAppointments(w, r, models.AppointmentFilter{PetID: pet.ID})
 }
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+	"time"
+)
+
+// loadPrescription fetches the prescription named by {id} and checks the caller may see it.
+// Staff and admin see every prescription; owners only current ones for their own pets.
+func loadPrescription(w http.ResponseWriter, r *http.Request, claims *utils.Claims) (*models.Prescription, *models.Pet, bool) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return nil, nil, false
+	}
+	p, err := models.GetPrescriptionByID(id)
+	if err != nil || p == nil {
+		http.Error(w, "Prescription not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	pet, err := models.GetPetByID(p.PetID)
+	if err != nil || pet == nil {
+		http.Error(w, "Prescription not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if !isStaff(claims) && (pet.OwnerID != claims.UserID || !p.IsCurrent(time.Now())) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, nil, false
+	}
+	return p, pet, true
+}
+
+// ListPetPrescriptions handles GET /pets/{id}/prescriptions. Staff can filter by status or
+// current=true; owners always get only their pet's current prescriptions.
+func ListPetPrescriptions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	filter := models.PrescriptionFilter{
+		PetID:       pet.ID,
+		Status:      q.Get("status"),
+		CurrentOnly: q.Get("current") == "true",
+	}
+	if !isStaff(claims) {
+		filter.Status = ""
+		filter.CurrentOnly = true
+	}
+
+	page, err := models.ListPrescriptions(filter, opts)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// CreatePetPrescription handles POST /pets/{id}/prescriptions, prescribed by the logged in vet
+func CreatePetPrescription(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+
+	var p models.Prescription
+	err := json.NewDecoder(r.Body).Decode(&p)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	p.PetID = pet.ID
+	p.PrescribedBy = claims.UserID
+	p.RenewedFromID = 0
+	if !validate(w, p) {
+		return
+	}
+	if p.AppointmentID != 0 {
+		apt := models.GetAppointmentByID(p.AppointmentID)
+		if apt == nil || apt.PetID != pet.ID {
+			writeValidationError(w, &models.ValidationError{Fields: map[string]string{
+				"appointment_id": "must be an appointment for this pet",
+			}})
+			return
+		}
+	}
+
+	created, err := models.AddPrescription(p)
+	if err != nil {
+		http.Error(w, "Failed to add prescription", http.StatusInternalServerError)
+		return
+	}
+	writeCreated(w, fmt.Sprintf("/prescriptions/%d", created.ID), created)
+}
+
+// GetPrescription handles GET /prescriptions/{id}
+func GetPrescription(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	p, _, ok := loadPrescription(w, r, claims)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// RenewPrescription handles POST /prescriptions/{id}/renew. The body may override dose, frequency,
+// duration_days, refills or instructions; everything else carries over.
+func RenewPrescription(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	p, _, ok := loadPrescription(w, r, claims)
+	if !ok {
+		return
+	}
+
+	var changes models.Prescription
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil && err != io.EOF {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	changes.PrescribedBy = claims.UserID
+
+	renewed, err := models.RenewPrescription(p.ID, changes)
+	var verr *models.ValidationError
+	switch {
+	case errors.Is(err, models.ErrPrescriptionNotActive):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.As(err, &verr):
+		writeValidationError(w, verr)
+		return
+	case err != nil:
+		http.Error(w, "Failed to renew prescription", http.StatusInternalServerError)
+		return
+	}
+	writeCreated(w, fmt.Sprintf("/prescriptions/%d", renewed.ID), renewed)
+}
+
+// DiscontinuePrescription handles POST /prescriptions/{id}/discontinue with an optional {"reason": "..."}
+func DiscontinuePrescription(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	p, _, ok := loadPrescription(w, r, claims)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	stopped, err := models.DiscontinuePrescription(p.ID, claims.UserID, body.Reason)
+	if errors.Is(err, models.ErrPrescriptionNotActive) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to discontinue prescription", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, stopped)
+}
+
+var prescriptionPrintTemplate = template.Must(template.New("prescription").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Prescription #{{.Prescription.ID}}</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; }
+table { border-collapse: collapse; width: 100%; }
+th { text-align: left; width: 12em; }
+th, td { padding: 0.3em; border-bottom: 1px solid #ccc; }
+.signature { margin-top: 4em; border-top: 1px solid #000; width: 20em; }
+@media print { .noprint { display: none; } }
+</style>
+</head>
+<body>
+<h1>{{.Clinic}}</h1>
+<h2>Prescription #{{.Prescription.ID}}</h2>
+<table>
+<tr><th>Date</th><td>{{.Prescription.PrescribedOn.Format "2006-01-02"}}</td></tr>
+<tr><th>Patient</th><td>{{.Pet.Name}} ({{.Pet.Species}}{{if .Pet.Breed}}, {{.Pet.Breed}}{{end}})</td></tr>
+{{if .Owner}}<tr><th>Owner</th><td>{{.Owner.Name}}{{if .Owner.Contact}}, {{.Owner.Contact}}{{end}}</td></tr>{{end}}
+<tr><th>Drug</th><td>{{.Prescription.Drug}}</td></tr>
+<tr><th>Dose</th><td>{{.Prescription.Dose}}</td></tr>
+<tr><th>Frequency</th><td>{{.Prescription.Frequency}}</td></tr>
+{{if .Prescription.DurationDays}}<tr><th>Duration</th><td>{{.Prescription.DurationDays}} days{{if .Prescription.EndsOn}} (until {{.Prescription.EndsOn.Format "2006-01-02"}}){{end}}</td></tr>{{end}}
+<tr><th>Refills</th><td>{{.Prescription.Refills}}</td></tr>
+{{if .Prescription.Instructions}}<tr><th>Instructions</th><td>{{.Prescription.Instructions}}</td></tr>{{end}}
+<tr><th>Status</th><td>{{.Prescription.Status}}</td></tr>
+</table>
+<p class="signature">{{if .Vet}}{{.Vet.Email}}{{else}}Prescribing veterinarian{{end}}</p>
+<button class="noprint" onclick="window.print()">Print</button>
+</body>
+</html>
+`))
+
+// PrintPrescription handles GET /prescriptions/{id}/print, rendering a printable HTML page
+func PrintPrescription(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	p, pet, ok := loadPrescription(w, r, claims)
+	if !ok {
+		return
+	}
+
+	owner, _ := models.GetOwnerByID(pet.OwnerID)
+	vet, _ := models.GetUserByID(p.PrescribedBy)
+	clinic := utils.ClinicName()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := prescriptionPrintTemplate.Execute(w, map[string]interface{}{
+		"Clinic":       clinic,
+		"Prescription": p,
+		"Pet":          pet,
+		"Owner":        owner,
+		"Vet":          vet,
+	})
+	if err != nil {
+		utils.Error("Failed to render prescription %d: %v", p.ID, err)
+	}
+}
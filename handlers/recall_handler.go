@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+	"strconv"
+)
+
+// writeRecallRuleError maps a recall rule save error onto a response
+func writeRecallRuleError(w http.ResponseWriter, err error, msg string) {
+	if errors.Is(err, models.ErrUnknownAppointmentType) {
+		writeValidationError(w, &models.ValidationError{Fields: map[string]string{"appointment_type_id": "does not exist"}})
+		return
+	}
+	http.Error(w, msg, http.StatusInternalServerError)
+}
+
+// ListRecallRules handles GET /recall-rules, with how many notices each sent and how many led to a booking
+func ListRecallRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := models.ListRecallRules()
+	if err != nil {
+		http.Error(w, "Failed to fetch recall rules", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// CreateRecallRule handles POST /recall-rules. Admin only.
+func CreateRecallRule(w http.ResponseWriter, r *http.Request) {
+	rule := models.RecallRule{IntervalMonths: 12, LeadDays: 14, Active: true}
+	err := json.NewDecoder(r.Body).Decode(&rule)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validate(w, rule) {
+		return
+	}
+
+	created, err := models.AddRecallRule(rule)
+	if err != nil {
+		writeRecallRuleError(w, err, "Failed to add recall rule")
+		return
+	}
+	writeCreated(w, fmt.Sprintf("/recall-rules/%d", created.ID), created)
+}
+
+// UpdateRecallRule handles PUT /recall-rules/{id}; set "active" to false to pause a campaign. Admin only.
+func UpdateRecallRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	existing, err := models.GetRecallRule(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch recall rule", http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		http.Error(w, "Recall rule not found", http.StatusNotFound)
+		return
+	}
+
+	var rule models.RecallRule
+	err = json.NewDecoder(r.Body).Decode(&rule)
+	if err != nil {
+		utils.Error("Failed to decode PUT body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	rule.ID = existing.ID
+	if !validate(w, rule) {
+		return
+	}
+
+	if err := models.UpdateRecallRule(rule); err != nil {
+		writeRecallRuleError(w, err, "Failed to update recall rule")
+		return
+	}
+	updated, err := models.GetRecallRule(id)
+	if err != nil || updated == nil {
+		http.Error(w, "Failed to fetch recall rule", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// ListRecalls handles GET /recalls[?rule_id=&pet_id=&status=&booked=true|false], the recall list
+func ListRecalls(w http.ResponseWriter, r *http.Request) {
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+	ruleID, ok := queryInt(w, r, "rule_id")
+	if !ok {
+		return
+	}
+	petID, ok := queryInt(w, r, "pet_id")
+	if !ok {
+		return
+	}
+	filter := models.RecallFilter{RuleID: ruleID, PetID: petID, Status: r.URL.Query().Get("status")}
+	if raw := r.URL.Query().Get("booked"); raw != "" {
+		booked, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, "Invalid booked", http.StatusBadRequest)
+			return
+		}
+		filter.Booked = &booked
+	}
+
+	page, err := models.ListRecalls(filter, opts)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+)
+
+// GetContactPreferences handles GET /owners/{id}/contact-preferences
+func GetContactPreferences(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	owner, ok := loadOwner(w, r, claims)
+	if !ok {
+		return
+	}
+	prefs, err := models.GetContactPreferences(owner.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch contact preferences", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// UpdateContactPreferences handles PUT /owners/{id}/contact-preferences with {"email": true, "sms": false, "phone": "..."}
+func UpdateContactPreferences(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	owner, ok := loadOwner(w, r, claims)
+	if !ok {
+		return
+	}
+
+	var prefs models.ContactPreferences
+	if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+		utils.Error("Failed to decode PUT body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	prefs.OwnerID = owner.ID
+	if !validate(w, prefs) {
+		return
+	}
+
+	if err := models.SaveContactPreferences(prefs); err != nil {
+		http.Error(w, "Failed to save contact preferences", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// ListAppointmentReminders handles GET /appointments/{id}/reminders, the reminders sent or due for one appointment
+func ListAppointmentReminders(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	apt, ok := loadAppointment(w, r, claims)
+	if !ok {
+		return
+	}
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+	page, err := models.ListReminders(models.ReminderFilter{AppointmentID: apt.ID}, opts)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// ListReminders handles GET /reminders[?status=&channel=&appointment_id=], for staff to follow deliveries
+func ListReminders(w http.ResponseWriter, r *http.Request) {
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+	appointmentID, ok := queryInt(w, r, "appointment_id")
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	page, err := models.ListReminders(models.ReminderFilter{
+		AppointmentID: appointmentID,
+		Status:        q.Get("status"),
+		Channel:       q.Get("channel"),
+	}, opts)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
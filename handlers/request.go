@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requireClaims returns the JWT claims stored by AuthMiddleware, writing a 401 if they are missing
+func requireClaims(w http.ResponseWriter, r *http.Request) (*utils.Claims, bool) {
+	claims, ok := r.Context().Value("userClaims").(*utils.Claims)
+	if !ok || claims == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	return claims, true
+}
+
+// isStaff reports whether the user is clinic staff or an admin
+func isStaff(claims *utils.Claims) bool {
+	return claims.Role == "staff" || claims.Role == "admin"
+}
+
+// pathID parses the named path wildcard (e.g. {id}) as an integer, writing a 400 if it is invalid
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		utils.Warn("Invalid %s in path: %q", name, r.PathValue(name))
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// queryInt parses an optional integer query parameter, writing a 400 if it is malformed
+func queryInt(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		http.Error(w, "Invalid "+name, http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// queryDate parses an optional YYYY-MM-DD query parameter, writing a 400 if it is malformed
+func queryDate(w http.ResponseWriter, r *http.Request, name string) (time.Time, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return time.Time{}, true
+	}
+	d, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		http.Error(w, "Invalid "+name+", expected YYYY-MM-DD", http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	return d, true
+}
+
+// parseListOptions reads the limit, offset and sort query parameters shared by list endpoints
+func parseListOptions(w http.ResponseWriter, r *http.Request) (models.ListOptions, bool) {
+	limit, ok := queryInt(w, r, "limit")
+	if !ok {
+		return models.ListOptions{}, false
+	}
+	offset, ok := queryInt(w, r, "offset")
+	if !ok {
+		return models.ListOptions{}, false
+	}
+	return models.ListOptions{Limit: limit, Offset: offset, Sort: r.URL.Query().Get("sort")}, true
+}
+
+// writeListError maps a list query error onto a response
+func writeListError(w http.ResponseWriter, err error) {
+	var sortErr *models.InvalidSortError
+	if errors.As(err, &sortErr) {
+		http.Error(w, sortErr.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "Failed to fetch results", http.StatusInternalServerError)
+}
+
+// decodeMergePatch applies the request body as an RFC 7396 JSON merge patch to current and
+// decodes the merged document into dst. Writes an error response and returns false on failure.
+func decodeMergePatch(w http.ResponseWriter, r *http.Request, current, dst interface{}) bool {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, _ := mime.ParseMediaType(ct)
+		if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+			http.Error(w, "PATCH requires application/merge-patch+json", http.StatusUnsupportedMediaType)
+			return false
+		}
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.Error("Failed to read PATCH body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	doc, err := json.Marshal(current)
+	if err != nil {
+		utils.Error("Failed to encode resource for PATCH: %v", err)
+		http.Error(w, "Failed to apply patch", http.StatusInternalServerError)
+		return false
+	}
+	merged, err := utils.MergePatch(doc, patch)
+	if err != nil {
+		utils.Error("Failed to apply PATCH body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	if err := json.Unmarshal(merged, dst); err != nil {
+		utils.Warn("Merged PATCH document does not fit resource: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// validate runs v.Validate, writing a 422 with the offending fields if it fails
+func validate(w http.ResponseWriter, v interface{ Validate() error }) bool {
+	err := v.Validate()
+	if err == nil {
+		return true
+	}
+	writeValidationError(w, err)
+	return false
+}
+
+// writeValidationError responds 422, listing the offending fields when err is a *models.ValidationError
+func writeValidationError(w http.ResponseWriter, err error) {
+	var verr *models.ValidationError
+	if errors.As(err, &verr) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  "validation failed",
+			"fields": verr.Fields,
+		})
+		return
+	}
+	http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+}
+
+// setETag exposes a resource's row version as its entity tag
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, version))
+}
+
+// checkIfMatch requires the request's If-Match header to name the resource's current version.
+// Writes 428 if the header is missing and 412 if it does not match.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, version int) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		http.Error(w, "If-Match header required", http.StatusPreconditionRequired)
+		return false
+	}
+	current := fmt.Sprintf(`"%d"`, version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	setETag(w, version)
+	http.Error(w, "Precondition Failed: resource has been modified", http.StatusPreconditionFailed)
+	return false
+}
+
+// writeSaveError maps an update/delete error onto a response, reporting lost races as 412
+func writeSaveError(w http.ResponseWriter, err error, msg string) {
+	if errors.Is(err, models.ErrVersionConflict) {
+		http.Error(w, "Precondition Failed: resource has been modified", http.StatusPreconditionFailed)
+		return
+	}
+	http.Error(w, msg, http.StatusInternalServerError)
+}
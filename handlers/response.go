@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"petclinic/utils"
+)
+
+// writeJSON encodes v as the JSON response body with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		utils.Error("Failed to encode response: %v", err)
+	}
+}
+
+// writeCreated responds with 201, a Location header pointing at the new resource and the resource itself
+func writeCreated(w http.ResponseWriter, location string, v interface{}) {
+	w.Header().Set("Location", location)
+	writeJSON(w, http.StatusCreated, v)
+}
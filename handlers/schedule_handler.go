@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+)
+
+// loadVet fetches the staff user named by the {id} path segment
+func loadVet(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return nil, false
+	}
+	vet, err := models.GetUserByID(id)
+	if err != nil || vet == nil || (vet.Role != "staff" && vet.Role != "admin") {
+		http.Error(w, "Vet not found", http.StatusNotFound)
+		return nil, false
+	}
+	return vet, true
+}
+
+// ListAppointmentTypes handles GET /appointment-types
+func ListAppointmentTypes(w http.ResponseWriter, r *http.Request) {
+	types, err := models.ListAppointmentTypes()
+	if err != nil {
+		http.Error(w, "Failed to fetch appointment types", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, types)
+}
+
+// CreateAppointmentType handles POST /appointment-types. Admin only.
+func CreateAppointmentType(w http.ResponseWriter, r *http.Request) {
+	var t models.AppointmentType
+	err := json.NewDecoder(r.Body).Decode(&t)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validate(w, t) {
+		return
+	}
+
+	created, err := models.AddAppointmentType(t)
+	if err != nil {
+		http.Error(w, "Failed to add appointment type", http.StatusInternalServerError)
+		return
+	}
+	writeCreated(w, fmt.Sprintf("/appointment-types/%d", created.ID), created)
+}
+
+// UpdateAppointmentType handles PUT /appointment-types/{id}. Admin only.
+func UpdateAppointmentType(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	existing, err := models.GetAppointmentTypeByID(id)
+	if err != nil || existing == nil {
+		http.Error(w, "Appointment type not found", http.StatusNotFound)
+		return
+	}
+
+	var t models.AppointmentType
+	err = json.NewDecoder(r.Body).Decode(&t)
+	if err != nil {
+		utils.Error("Failed to decode PUT body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	t.ID = existing.ID
+	if !validate(w, t) {
+		return
+	}
+
+	if err := models.UpdateAppointmentType(t); err != nil {
+		http.Error(w, "Failed to update appointment type", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// GetVetSchedule handles GET /vets/{id}/schedule
+func GetVetSchedule(w http.ResponseWriter, r *http.Request) {
+	vet, ok := loadVet(w, r)
+	if !ok {
+		return
+	}
+	schedule, err := models.GetSchedule(vet.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch schedule", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, schedule)
+}
+
+// UpdateVetSchedule handles PUT /vets/{id}/schedule, replacing the vet's weekly blocks and appointment types
+func UpdateVetSchedule(w http.ResponseWriter, r *http.Request) {
+	vet, ok := loadVet(w, r)
+	if !ok {
+		return
+	}
+
+	var schedule models.Schedule
+	err := json.NewDecoder(r.Body).Decode(&schedule)
+	if err != nil {
+		utils.Error("Failed to decode PUT body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	schedule.VetID = vet.ID
+	if !validate(w, schedule) {
+		return
+	}
+
+	err = models.ReplaceSchedule(schedule)
+	if errors.Is(err, models.ErrUnknownAppointmentType) {
+		writeValidationError(w, &models.ValidationError{Fields: map[string]string{"appointment_type_ids": "contains an unknown appointment type"}})
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update schedule", http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := models.GetSchedule(vet.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch schedule", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// CreateVetDayOff handles POST /vets/{id}/days-off
+func CreateVetDayOff(w http.ResponseWriter, r *http.Request) {
+	vet, ok := loadVet(w, r)
+	if !ok {
+		return
+	}
+
+	var day models.DayOff
+	err := json.NewDecoder(r.Body).Decode(&day)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	day.VetID = vet.ID
+	if !validate(w, day) {
+		return
+	}
+
+	created, err := models.AddDayOff(day)
+	if errors.Is(err, models.ErrDuplicateDayOff) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to add day off", http.StatusInternalServerError)
+		return
+	}
+	writeCreated(w, fmt.Sprintf("/vets/%d/days-off/%d", vet.ID, created.ID), created)
+}
+
+// DeleteVetDayOff handles DELETE /vets/{id}/days-off/{did}
+func DeleteVetDayOff(w http.ResponseWriter, r *http.Request) {
+	vet, ok := loadVet(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathID(w, r, "did")
+	if !ok {
+		return
+	}
+
+	deleted, err := models.DeleteDayOff(vet.ID, id)
+	if err != nil {
+		http.Error(w, "Failed to delete day off", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Day off not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAvailability handles GET /availability?type_id=&from=&to=[&vet_id=], listing open slots for an
+// appointment type between two dates inclusive
+func GetAvailability(w http.ResponseWriter, r *http.Request) {
+	var q models.AvailabilityQuery
+	var ok bool
+	if q.AppointmentTypeID, ok = queryInt(w, r, "type_id"); !ok {
+		return
+	}
+	if q.VetID, ok = queryInt(w, r, "vet_id"); !ok {
+		return
+	}
+	if q.From, ok = queryDate(w, r, "from"); !ok {
+		return
+	}
+	if q.To, ok = queryDate(w, r, "to"); !ok {
+		return
+	}
+	if !validate(w, q) {
+		return
+	}
+
+	slots, err := models.FindAvailability(q)
+	if errors.Is(err, models.ErrUnknownAppointmentType) {
+		http.Error(w, "Appointment type not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to compute availability", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, slots)
+}
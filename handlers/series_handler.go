@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+)
+
+// writeSeriesError maps a series error onto a response: 422 for validation failures, 409 listing the
+// occurrences that overlap existing bookings, and 500 otherwise
+func writeSeriesError(w http.ResponseWriter, err error, msg string) {
+	var verr *models.ValidationError
+	if errors.As(err, &verr) {
+		writeValidationError(w, verr)
+		return
+	}
+	var serr *models.SeriesConflictError
+	if errors.As(err, &serr) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     serr.Error(),
+			"conflicts": serr.Conflicts,
+		})
+		return
+	}
+	http.Error(w, msg, http.StatusInternalServerError)
+}
+
+// loadSeries fetches the series named by the {id} path segment
+func loadSeries(w http.ResponseWriter, r *http.Request) (*models.Series, bool) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return nil, false
+	}
+	series, err := models.GetSeries(id)
+	if err != nil || series == nil {
+		http.Error(w, "Series not found", http.StatusNotFound)
+		return nil, false
+	}
+	return series, true
+}
+
+// CreateAppointmentSeries handles POST /appointment-series with
+// {"rrule": "FREQ=WEEKLY;COUNT=6", "appointment": {...first occurrence...}, "skip_conflicts": false}.
+// Staff only.
+func CreateAppointmentSeries(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		RRule         string             `json:"rrule"`
+		Appointment   models.Appointment `json:"appointment"`
+		SkipConflicts bool               `json:"skip_conflicts"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	first := body.Appointment
+	first.Status = models.StatusConfirmed
+	if !resolveTimes(w, &first, nil) || !validate(w, first) || !checkVet(w, first) {
+		return
+	}
+
+	series, err := models.CreateSeries(first, body.RRule, claims.UserID, body.SkipConflicts)
+	if err != nil {
+		writeSeriesError(w, err, "Failed to create series")
+		return
+	}
+	utils.Info("User %d created appointment series %d with %d occurrences", claims.UserID, series.ID, len(series.Appointments))
+	writeCreated(w, fmt.Sprintf("/appointment-series/%d", series.ID), series)
+}
+
+// GetAppointmentSeries handles GET /appointment-series/{id}
+func GetAppointmentSeries(w http.ResponseWriter, r *http.Request) {
+	series, ok := loadSeries(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, series)
+}
+
+// PatchAppointmentSeries handles PATCH /appointment-series/{id}, changing the time, duration, vet, room
+// or reason of every upcoming occurrence. Single occurrences are changed through /appointments/{id}.
+func PatchAppointmentSeries(w http.ResponseWriter, r *http.Request) {
+	series, ok := loadSeries(w, r)
+	if !ok {
+		return
+	}
+
+	var changes models.SeriesChanges
+	err := json.NewDecoder(r.Body).Decode(&changes)
+	if err != nil {
+		utils.Error("Failed to decode PATCH body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if changes.VetID != nil && !checkSeriesVet(w, series, *changes.VetID) {
+		return
+	}
+
+	updated, err := models.UpdateSeries(series.ID, changes)
+	if err != nil {
+		writeSeriesError(w, err, "Failed to update series")
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// checkSeriesVet checks that vetID is a staff member who offers the type of every open occurrence of the
+// series, as checkVet does for a single appointment
+func checkSeriesVet(w http.ResponseWriter, series *models.Series, vetID int) bool {
+	typeIDs := []int{}
+	seen := map[int]bool{}
+	for _, a := range series.Appointments {
+		if (a.Status == models.StatusRequested || a.Status == models.StatusConfirmed) && !seen[a.TypeID] {
+			seen[a.TypeID] = true
+			typeIDs = append(typeIDs, a.TypeID)
+		}
+	}
+	if len(typeIDs) == 0 {
+		typeIDs = append(typeIDs, 0)
+	}
+	for _, typeID := range typeIDs {
+		if !checkVet(w, models.Appointment{VetID: vetID, TypeID: typeID}) {
+			return false
+		}
+	}
+	return true
+}
+
+// CancelAppointmentSeries handles POST /appointment-series/{id}/cancel, cancelling every upcoming
+// occurrence. Single occurrences are cancelled through /appointments/{id}/status.
+func CancelAppointmentSeries(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	series, ok := loadSeries(w, r)
+	if !ok {
+		return
+	}
+
+	cancelled, err := models.CancelSeries(series.ID, claims.UserID, "series cancelled")
+	if err != nil {
+		http.Error(w, "Failed to cancel series", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"cancelled": cancelled})
+}
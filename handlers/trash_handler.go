@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+)
+
+// writeTrashError maps a trash error onto a response
+func writeTrashError(w http.ResponseWriter, err error) {
+	var kindErr *models.UnknownKindError
+	if errors.As(err, &kindErr) {
+		http.Error(w, kindErr.Error(), http.StatusNotFound)
+		return
+	}
+	var parentErr *models.ParentDeletedError
+	if errors.As(err, &parentErr) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":  parentErr.Error(),
+			"parent": parentErr,
+		})
+		return
+	}
+	if writeScheduleConflict(w, err) {
+		return
+	}
+	writeListError(w, err)
+}
+
+// ListTrash handles GET /admin/trash/{kind}, listing soft-deleted owners, pets or appointments
+func ListTrash(w http.ResponseWriter, r *http.Request) {
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+	page, err := models.ListTrash(r.PathValue("kind"), opts)
+	if err != nil {
+		writeTrashError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// RestoreFromTrash handles POST /admin/trash/{kind}/{id}/restore
+func RestoreFromTrash(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	kind := r.PathValue("kind")
+
+	restored, err := models.Restore(kind, id)
+	if err != nil {
+		utils.Error("Failed to restore %s %d: %v", kind, id, err)
+		writeTrashError(w, err)
+		return
+	}
+	if !restored {
+		http.Error(w, "Not found in trash", http.StatusNotFound)
+		return
+	}
+	utils.Info("User %d restored %s %d", claims.UserID, kind, id)
+	w.WriteHeader(http.StatusNoContent)
+}
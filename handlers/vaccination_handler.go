@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+	"time"
+)
+
+// loadVaccination fetches the vaccination named by {vid} for a pet the caller may access
+func loadVaccination(w http.ResponseWriter, r *http.Request, pet *models.Pet) (*models.Vaccination, bool) {
+	id, ok := pathID(w, r, "vid")
+	if !ok {
+		return nil, false
+	}
+	v, err := models.GetVaccinationByID(pet.ID, id)
+	if err != nil || v == nil {
+		http.Error(w, "Vaccination not found", http.StatusNotFound)
+		return nil, false
+	}
+	return v, true
+}
+
+// ListPetVaccinations handles GET /pets/{id}/vaccinations
+func ListPetVaccinations(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := models.ListVaccinations(pet.ID, opts)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// GetPetVaccination handles GET /pets/{id}/vaccinations/{vid}
+func GetPetVaccination(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	v, ok := loadVaccination(w, r, pet)
+	if !ok {
+		return
+	}
+	setETag(w, v.Version)
+	writeJSON(w, http.StatusOK, v)
+}
+
+// CreatePetVaccination handles POST /pets/{id}/vaccinations. Staff only; the administering vet
+// defaults to the logged in user.
+func CreatePetVaccination(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+
+	var v models.Vaccination
+	err := json.NewDecoder(r.Body).Decode(&v)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	v.PetID = pet.ID
+	if v.AdministeredBy == 0 {
+		v.AdministeredBy = claims.UserID
+	}
+	if !validate(w, v) {
+		return
+	}
+
+	created, err := models.AddVaccination(v)
+	if err != nil {
+		http.Error(w, "Failed to add vaccination", http.StatusInternalServerError)
+		return
+	}
+	setETag(w, created.Version)
+	writeCreated(w, fmt.Sprintf("/pets/%d/vaccinations/%d", pet.ID, created.ID), created)
+}
+
+// UpdatePetVaccination handles PUT /pets/{id}/vaccinations/{vid}
+func UpdatePetVaccination(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	existing, ok := loadVaccination(w, r, pet)
+	if !ok || !checkIfMatch(w, r, existing.Version) {
+		return
+	}
+
+	var v models.Vaccination
+	err := json.NewDecoder(r.Body).Decode(&v)
+	if err != nil {
+		utils.Error("Failed to decode PUT body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	saveVaccination(w, existing, v)
+}
+
+// PatchPetVaccination handles PATCH /pets/{id}/vaccinations/{vid} with a JSON merge patch
+func PatchPetVaccination(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	existing, ok := loadVaccination(w, r, pet)
+	if !ok || !checkIfMatch(w, r, existing.Version) {
+		return
+	}
+
+	var v models.Vaccination
+	if !decodeMergePatch(w, r, existing, &v) {
+		return
+	}
+	saveVaccination(w, existing, v)
+}
+
+// saveVaccination writes v over existing and responds with the stored result
+func saveVaccination(w http.ResponseWriter, existing *models.Vaccination, v models.Vaccination) {
+	v.ID = existing.ID
+	v.PetID = existing.PetID
+	v.Version = existing.Version
+	if !validate(w, v) {
+		return
+	}
+
+	updated, err := models.UpdateVaccination(existing.ID, v)
+	if err != nil {
+		writeSaveError(w, err, "Failed to update vaccination")
+		return
+	}
+	setETag(w, updated.Version)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeletePetVaccination handles DELETE /pets/{id}/vaccinations/{vid}
+func DeletePetVaccination(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	v, ok := loadVaccination(w, r, pet)
+	if !ok || !checkIfMatch(w, r, v.Version) {
+		return
+	}
+
+	err := models.DeleteVaccination(v.ID, v.Version, claims.UserID)
+	if err != nil {
+		writeSaveError(w, err, "Failed to delete vaccination")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDueVaccinations handles GET /vaccinations/due?days=N, listing pets whose vaccinations are
+// overdue or fall due within the next N days (default 30).
+func ListDueVaccinations(w http.ResponseWriter, r *http.Request) {
+	days, ok := queryInt(w, r, "days")
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("days") == "" {
+		days = 30
+	}
+	if days < 0 {
+		http.Error(w, "days must not be negative", http.StatusBadRequest)
+		return
+	}
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := models.ListDueVaccinations(time.Now().AddDate(0, 0, days), opts)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+)
+
+// parseVitalsFilter reads the from/to date range (inclusive) for a pet's vitals
+func parseVitalsFilter(w http.ResponseWriter, r *http.Request, petID int) (models.VitalsFilter, bool) {
+	f := models.VitalsFilter{PetID: petID}
+	var ok bool
+	if f.From, ok = queryDate(w, r, "from"); !ok {
+		return f, false
+	}
+	if f.To, ok = queryDate(w, r, "to"); !ok {
+		return f, false
+	}
+	if !f.To.IsZero() {
+		f.To = f.To.AddDate(0, 0, 1)
+	}
+	return f, true
+}
+
+// ListPetVitals handles GET /pets/{id}/vitals. weight_unit (kg|lb) and temperature_unit (C|F)
+// choose the units of the response.
+func ListPetVitals(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	weightUnit, tempUnit := q.Get("weight_unit"), q.Get("temperature_unit")
+	if err := models.ValidUnits(weightUnit, tempUnit); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, ok := parseVitalsFilter(w, r, pet.ID)
+	if !ok {
+		return
+	}
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := models.ListVitals(filter, opts)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	for i, v := range page.Items {
+		page.Items[i] = v.InUnits(weightUnit, tempUnit)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// GetPetVitals handles GET /pets/{id}/vitals/{vid}, one measurement in the units chosen by weight_unit
+// and temperature_unit
+func GetPetVitals(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	vid, ok := pathID(w, r, "vid")
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	weightUnit, tempUnit := q.Get("weight_unit"), q.Get("temperature_unit")
+	if err := models.ValidUnits(weightUnit, tempUnit); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	v, err := models.GetVitalsByID(pet.ID, vid)
+	if err != nil {
+		http.Error(w, "Failed to fetch vitals", http.StatusInternalServerError)
+		return
+	}
+	if v == nil {
+		http.Error(w, "Vitals not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, v.InUnits(weightUnit, tempUnit))
+}
+
+// CreatePetVitals handles POST /pets/{id}/vitals. Weight and temperature may be sent in kg or lb
+// and C or F via weight_unit and temperature_unit (default kg and C).
+func CreatePetVitals(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+
+	var v models.Vitals
+	err := json.NewDecoder(r.Body).Decode(&v)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	v.PetID = pet.ID
+	v.RecordedBy = claims.UserID
+	if !validate(w, v) {
+		return
+	}
+
+	created, err := models.AddVitals(v)
+	if err != nil {
+		http.Error(w, "Failed to record vitals", http.StatusInternalServerError)
+		return
+	}
+	// Answer in the units the client used
+	writeCreated(w, fmt.Sprintf("/pets/%d/vitals/%d", pet.ID, created.ID), created.InUnits(v.WeightUnit, v.TemperatureUnit))
+}
+
+// GetPetVitalsTrend handles GET /pets/{id}/vitals/trend?metric=weight&unit=lb, returning the
+// metric's values over time (oldest first) with min, max and overall change.
+func GetPetVitalsTrend(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	pet, ok := loadPet(w, r, claims)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	metric, unit := q.Get("metric"), q.Get("unit")
+	if metric == "" {
+		metric = "weight"
+	}
+	switch metric {
+	case "weight":
+		if err := models.ValidUnits(unit, ""); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "temperature":
+		if err := models.ValidUnits("", unit); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	filter, ok := parseVitalsFilter(w, r, pet.ID)
+	if !ok {
+		return
+	}
+
+	trend, err := models.GetVitalsTrend(filter, metric, unit)
+	var metricErr *models.UnknownMetricError
+	if errors.As(err, &metricErr) {
+		http.Error(w, metricErr.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch trend", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, trend)
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"petclinic/models"
+	"petclinic/utils"
+)
+
+// loadWaitlistEntry fetches the waitlist entry named by the {id} path segment and checks the caller may access it.
+// Staff and admin can access any entry; owners only those for their own pets.
+func loadWaitlistEntry(w http.ResponseWriter, r *http.Request, claims *utils.Claims) (*models.WaitlistEntry, bool) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return nil, false
+	}
+	entry, err := models.GetWaitlistEntry(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch waitlist entry", http.StatusInternalServerError)
+		return nil, false
+	}
+	if entry == nil {
+		http.Error(w, "Waitlist entry not found", http.StatusNotFound)
+		return nil, false
+	}
+	if !isStaff(claims) && entry.OwnerID != claims.UserID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return entry, true
+}
+
+// checkPreferredVets writes a 422 unless every preferred vet is a staff member who offers the entry's type
+func checkPreferredVets(w http.ResponseWriter, entry models.WaitlistEntry) bool {
+	for _, vetID := range entry.VetIDs {
+		vet, err := models.GetUserByID(vetID)
+		if err != nil {
+			http.Error(w, "Failed to look up vet", http.StatusInternalServerError)
+			return false
+		}
+		if vet == nil || (vet.Role != "staff" && vet.Role != "admin") {
+			writeValidationError(w, &models.ValidationError{Fields: map[string]string{"vet_ids": fmt.Sprintf("%d is not a staff member", vetID)}})
+			return false
+		}
+		offers, err := models.VetOffersType(vetID, entry.TypeID)
+		if err != nil {
+			http.Error(w, "Failed to look up vet", http.StatusInternalServerError)
+			return false
+		}
+		if !offers {
+			writeValidationError(w, &models.ValidationError{Fields: map[string]string{"vet_ids": fmt.Sprintf("%d does not offer this appointment type", vetID)}})
+			return false
+		}
+	}
+	return true
+}
+
+// writeWaitlistClosed responds 409 if err is models.ErrWaitlistClosed, and reports whether it did
+func writeWaitlistClosed(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, models.ErrWaitlistClosed) {
+		return false
+	}
+	http.Error(w, err.Error(), http.StatusConflict)
+	return true
+}
+
+// ListWaitlist handles GET /waitlist[?pet_id=&status=]. Owners only see entries for their own pets.
+func ListWaitlist(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	opts, ok := parseListOptions(w, r)
+	if !ok {
+		return
+	}
+	petID, ok := queryInt(w, r, "pet_id")
+	if !ok {
+		return
+	}
+	filter := models.WaitlistFilter{PetID: petID, Status: r.URL.Query().Get("status")}
+	if !isStaff(claims) {
+		filter.OwnerID = claims.UserID
+	}
+
+	page, err := models.ListWaitlist(filter, opts)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// CreateWaitlistEntry handles POST /waitlist. Staff can add any pet; owners can add their own.
+func CreateWaitlistEntry(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+
+	var entry models.WaitlistEntry
+	err := json.NewDecoder(r.Body).Decode(&entry)
+	if err != nil {
+		utils.Error("Failed to decode POST body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validate(w, entry) {
+		return
+	}
+
+	pet, err := models.GetPetByID(entry.PetID)
+	if err != nil || pet == nil {
+		writeValidationError(w, &models.ValidationError{Fields: map[string]string{"pet_id": "does not exist"}})
+		return
+	}
+	if !isStaff(claims) && pet.OwnerID != claims.UserID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	apptType, err := models.GetAppointmentTypeByID(entry.TypeID)
+	if err != nil {
+		http.Error(w, "Failed to look up appointment type", http.StatusInternalServerError)
+		return
+	}
+	if apptType == nil {
+		writeValidationError(w, &models.ValidationError{Fields: map[string]string{"appointment_type_id": "does not exist"}})
+		return
+	}
+	if !checkPreferredVets(w, entry) {
+		return
+	}
+
+	created, err := models.AddWaitlistEntry(entry, claims.UserID)
+	if err != nil {
+		http.Error(w, "Failed to add waitlist entry", http.StatusInternalServerError)
+		return
+	}
+	utils.Info("User %d put pet %d on the waitlist (entry %d)", claims.UserID, created.PetID, created.ID)
+	writeCreated(w, fmt.Sprintf("/waitlist/%d", created.ID), created)
+}
+
+// GetWaitlistEntry handles GET /waitlist/{id}, including any open offer
+func GetWaitlistEntry(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	entry, ok := loadWaitlistEntry(w, r, claims)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// WithdrawWaitlistEntry handles DELETE /waitlist/{id}, taking the pet off the waitlist
+func WithdrawWaitlistEntry(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	entry, ok := loadWaitlistEntry(w, r, claims)
+	if !ok {
+		return
+	}
+
+	err := models.WithdrawWaitlistEntry(entry.ID)
+	if writeWaitlistClosed(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to withdraw waitlist entry", http.StatusInternalServerError)
+		return
+	}
+	utils.Info("User %d withdrew waitlist entry %d", claims.UserID, entry.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AcceptWaitlistOffer handles POST /waitlist/{id}/offer/accept, booking the offered slot.
+// Responds 409 if the offer has closed or the slot was taken in the meantime.
+func AcceptWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	entry, ok := loadWaitlistEntry(w, r, claims)
+	if !ok {
+		return
+	}
+
+	apt, err := models.AcceptOffer(entry.ID)
+	if writeWaitlistClosed(w, err) || writeScheduleConflict(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to book offered slot", http.StatusInternalServerError)
+		return
+	}
+	utils.Info("User %d accepted the offer on waitlist entry %d as appointment %d", claims.UserID, entry.ID, apt.ID)
+	setETag(w, apt.Version)
+	writeCreated(w, fmt.Sprintf("/appointments/%d", apt.ID), apt)
+}
+
+// DeclineWaitlistOffer handles POST /waitlist/{id}/offer/decline. The entry keeps its place in line
+// and the slot passes to the next matching entry.
+func DeclineWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r)
+	if !ok {
+		return
+	}
+	entry, ok := loadWaitlistEntry(w, r, claims)
+	if !ok {
+		return
+	}
+
+	err := models.DeclineOffer(entry.ID)
+	if writeWaitlistClosed(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to decline offer", http.StatusInternalServerError)
+		return
+	}
+	utils.Info("User %d declined the offer on waitlist entry %d", claims.UserID, entry.ID)
+	entry, err = models.GetWaitlistEntry(entry.ID)
+	if err != nil || entry == nil {
+		http.Error(w, "Failed to fetch waitlist entry", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
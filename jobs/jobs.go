@@ -0,0 +1,21 @@
+// Package jobs runs the service's periodic background work.
+package jobs
+
+import (
+	"petclinic/utils"
+	"time"
+)
+
+// every runs fn immediately and then once per interval, forever, in its own goroutine
+func every(name string, interval time.Duration, fn func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := fn(); err != nil {
+				utils.Error("Job %s failed: %v", name, err)
+			}
+			<-ticker.C
+		}
+	}()
+}
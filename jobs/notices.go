@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"petclinic/models"
+	"petclinic/notify"
+	"petclinic/utils"
+)
+
+// noticeOutcome records how sending a notice to an owner went
+type noticeOutcome struct {
+	Sent      func(via []string) error // delivered over at least one channel
+	Failed    func(err error) error    // no channel delivered it; retried until MaxReminderAttempts
+	NoContact func() error             // the owner has no channel turned on, so staff should call them
+}
+
+// sendNotice words a notice of the kind with data in the owner's language and sends it over every channel
+// they have turned on: email to ownerEmail and SMS to the phone in their preferences. It counts as sent if
+// any channel delivered it. what names the notice in logs.
+func sendNotice(kind, what string, data any, ownerEmail string, contact models.ContactPreferences,
+	senders map[string]notify.Sender, outcome noticeOutcome) {
+	recipients := map[string]string{}
+	if contact.Email && ownerEmail != "" {
+		recipients[models.ChannelEmail] = ownerEmail
+	}
+	if contact.SMS && contact.Phone != "" {
+		recipients[models.ChannelSMS] = contact.Phone
+	}
+	if len(recipients) == 0 {
+		utils.Warn("Owner %d cannot be sent %s: no channel turned on", contact.OwnerID, what)
+		outcome.NoContact()
+		return
+	}
+
+	var via []string
+	var errs []error
+	for _, channel := range []string{models.ChannelEmail, models.ChannelSMS} {
+		to, ok := recipients[channel]
+		if !ok {
+			continue
+		}
+		sender, ok := senders[channel]
+		if !ok {
+			errs = append(errs, fmt.Errorf("no sender for channel %q", channel))
+			continue
+		}
+		msg, err := renderNotification(kind, channel, contact.Locale, to, data)
+		if err == nil {
+			err = sender.Send(msg)
+		}
+		if err != nil {
+			utils.Warn("Sending %s to %s failed: %v", what, to, err)
+			errs = append(errs, err)
+			continue
+		}
+		via = append(via, channel)
+	}
+	if len(via) > 0 {
+		outcome.Sent(via)
+		return
+	}
+	outcome.Failed(errors.Join(errs...))
+}
@@ -0,0 +1,19 @@
+package jobs
+
+import (
+	"petclinic/models"
+	"petclinic/utils"
+	"time"
+)
+
+// StartPurge permanently removes soft-deleted rows once they are older than retention, checking every interval
+func StartPurge(retention, interval time.Duration) {
+	utils.Info("Purging soft-deleted records older than %v every %v", retention, interval)
+	every("purge", interval, func() error {
+		n, err := models.PurgeDeleted(time.Now().Add(-retention))
+		if n > 0 {
+			utils.Info("Purged %d soft-deleted records", n)
+		}
+		return err
+	})
+}
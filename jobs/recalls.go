@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"fmt"
+	"net/url"
+	"petclinic/models"
+	"petclinic/notify"
+	"petclinic/utils"
+	"strconv"
+	"time"
+)
+
+// recallBatch caps how many recall notices one run sends
+const recallBatch = 200
+
+// StartRecalls builds the recall list from the active recall rules and sends each owner a notice, with a
+// link to bookingURL if set, through the channels they have turned on. Runs every interval.
+func StartRecalls(bookingURL string, senders map[string]notify.Sender, interval time.Duration) {
+	utils.Info("Running recall campaigns every %v", interval)
+	every("recalls", interval, func() error {
+		added, err := models.GenerateRecalls()
+		if err != nil {
+			return err
+		}
+		if added > 0 {
+			utils.Info("Added %d pets to the recall list", added)
+		}
+
+		due, err := models.PendingRecalls(recallBatch)
+		if err != nil {
+			return err
+		}
+		for _, c := range due {
+			sendRecall(c, bookingURL, senders)
+		}
+		return nil
+	})
+}
+
+// sendRecall delivers one recall over every channel the owner has turned on
+func sendRecall(c models.DueRecall, bookingURL string, senders map[string]notify.Sender) {
+	what := fmt.Sprintf("recall %d", c.ID)
+	sendNotice(notify.KindRecall, what, recallData(c, bookingURL), c.OwnerEmail, c.Contact, senders, noticeOutcome{
+		Sent:      func(via []string) error { return models.MarkRecallSent(c.ID, via) },
+		Failed:    func(err error) error { return models.MarkRecallFailed(c.ID, err) },
+		NoContact: func() error { return models.MarkRecallNoContact(c.ID) },
+	})
+}
+
+// recallLink is the booking page for the recall, prefilled with the pet and appointment type
+func recallLink(c models.DueRecall, bookingURL string) string {
+	if bookingURL == "" {
+		return ""
+	}
+	u, err := url.Parse(bookingURL)
+	if err != nil {
+		utils.Warn("Invalid booking URL %q: %v", bookingURL, err)
+		return ""
+	}
+	q := u.Query()
+	q.Set("pet_id", strconv.Itoa(c.PetID))
+	if c.TypeID != 0 {
+		q.Set("appointment_type_id", strconv.Itoa(c.TypeID))
+	}
+	q.Set("recall_id", strconv.Itoa(c.ID))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// recallData is what a recall notice is worded with
+func recallData(c models.DueRecall, bookingURL string) notify.RecallData {
+	return notify.RecallData{
+		Clinic:      notify.ClinicFromEnv(),
+		OwnerName:   c.OwnerName,
+		PetName:     c.PetName,
+		Kind:        c.Kind,
+		Vaccine:     c.Vaccine,
+		TypeName:    c.TypeName,
+		DueOn:       c.DueOn,
+		BookingLink: recallLink(c, bookingURL),
+	}
+}
@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"fmt"
+	"petclinic/models"
+	"petclinic/notify"
+	"petclinic/utils"
+	"time"
+)
+
+// reminderBatch caps how many reminders one run sends, so a backlog is worked through over several runs
+const reminderBatch = 100
+
+// StartReminders sends appointment reminders at each offset before the start (e.g. 48h and 2h), through
+// the sender for each channel, checking every interval. Failed sends are retried on later runs.
+func StartReminders(offsets []time.Duration, senders map[string]notify.Sender, interval time.Duration) {
+	utils.Info("Sending appointment reminders %v before the start, checking every %v", offsets, interval)
+	every("reminders", interval, func() error {
+		queued, err := models.QueueDueReminders(offsets)
+		if err != nil {
+			return err
+		}
+		if queued > 0 {
+			utils.Info("Queued %d appointment reminders", queued)
+		}
+
+		due, err := models.PendingReminders(reminderBatch)
+		if err != nil {
+			return err
+		}
+		for _, r := range due {
+			sender, ok := senders[r.Channel]
+			if !ok {
+				models.MarkReminderFailed(r.ID, fmt.Errorf("no sender for channel %q", r.Channel))
+				continue
+			}
+			msg, err := reminderMessage(r)
+			if err == nil {
+				err = sender.Send(msg)
+			}
+			if err != nil {
+				utils.Warn("Reminder %d to %s failed: %v", r.ID, r.Recipient, err)
+				models.MarkReminderFailed(r.ID, err)
+				continue
+			}
+			models.MarkReminderSent(r.ID)
+		}
+		return nil
+	})
+}
+
+// reminderMessage words a reminder for its channel, in the owner's language
+func reminderMessage(r models.DueReminder) (notify.Message, error) {
+	return renderNotification(notify.KindAppointmentReminder, r.Channel, r.Locale, r.Recipient, notify.ReminderData{
+		Clinic:    notify.ClinicFromEnv(),
+		OwnerName: r.OwnerName,
+		PetName:   r.PetName,
+		TypeName:  r.TypeName,
+		StartsAt:  r.AppointmentStartsAt,
+	})
+}
@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"petclinic/models"
+	"petclinic/notify"
+	"petclinic/utils"
+)
+
+// renderNotification words a notification with the template in use for the kind, channel and locale. If
+// an edited template fails to render, the built-in wording is sent instead so the owner still hears from us.
+func renderNotification(kind, channel, locale, to string, data any) (notify.Message, error) {
+	tmpl, err := models.ResolveNotificationTemplate(kind, channel, locale)
+	if err != nil {
+		return notify.Message{}, err
+	}
+	m, err := tmpl.Render(to, data)
+	if err == nil || tmpl.Version == 0 {
+		return m, err
+	}
+	utils.Warn("Template %s/%s/%s version %d failed to render, using the built-in wording: %v",
+		kind, channel, tmpl.Locale, tmpl.Version, err)
+	builtin, _ := notify.Default(kind, channel)
+	return builtin.Render(to, data)
+}
@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"fmt"
+	"petclinic/models"
+	"petclinic/notify"
+	"petclinic/utils"
+	"time"
+)
+
+// offerNoticeBatch caps how many offer notices one run sends
+const offerNoticeBatch = 100
+
+// StartWaitlist expires waitlist offers and entries that have run out of time, checking every interval.
+// Expired offers pass to the next entry in line. Owners are told of new offers through the channels they
+// have turned on.
+func StartWaitlist(senders map[string]notify.Sender, interval time.Duration) {
+	utils.Info("Expiring waitlist offers every %v", interval)
+	every("waitlist", interval, func() error {
+		n, err := models.ExpireWaitlist()
+		if n > 0 {
+			utils.Info("Expired %d waitlist offers and entries", n)
+		}
+		if err != nil {
+			return err
+		}
+
+		due, err := models.PendingOfferNotices(offerNoticeBatch)
+		if err != nil {
+			return err
+		}
+		for _, o := range due {
+			sendOfferNotice(o, senders)
+		}
+		return nil
+	})
+}
+
+// sendOfferNotice tells the owner of an offer over every channel they have turned on. Owners who cannot
+// be reached are marked notified over no channel, for staff to phone.
+func sendOfferNotice(o models.DueOfferNotice, senders map[string]notify.Sender) {
+	data := notify.WaitlistOfferData{
+		Clinic:    notify.ClinicFromEnv(),
+		OwnerName: o.OwnerName,
+		PetName:   o.PetName,
+		TypeName:  o.TypeName,
+		StartsAt:  o.StartsAt,
+		ExpiresAt: o.ExpiresAt.In(models.ClinicLocation),
+	}
+	what := fmt.Sprintf("waitlist offer %d", o.ID)
+	sendNotice(notify.KindWaitlistOffer, what, data, o.OwnerEmail, o.Contact, senders, noticeOutcome{
+		Sent:      func(via []string) error { return models.MarkOfferNotified(o.ID, via) },
+		Failed:    func(err error) error { return models.MarkOfferNoticeFailed(o.ID, err) },
+		NoContact: func() error { return models.MarkOfferNotified(o.ID, nil) },
+	})
+}
@@ -3,52 +3,211 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
 	"petclinic/db"
 	"petclinic/handlers"
+	"petclinic/jobs"
 	"petclinic/middleware"
+	"petclinic/models"
+	"petclinic/notify"
+	"petclinic/utils"
+	"time"
+	_ "time/tzdata" // CLINIC_TIMEZONE must resolve even on hosts without a zoneinfo database
 )
 
+// protected wraps a handler with request logging and JWT authentication.
+// If roles are given, only users with one of those roles get through.
+func protected(h http.HandlerFunc, roles ...string) http.Handler {
+	var next http.Handler = h
+	if len(roles) > 0 {
+		next = middleware.RoleBasedAccess(roles...)(next)
+	}
+	return middleware.Logging(middleware.AuthMiddleware(next))
+}
+
 func main() {
 	// Initialize database connection
 	db.InitDB()
 
+	if name := os.Getenv("CLINIC_TIMEZONE"); name != "" {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			utils.Warn("Unknown CLINIC_TIMEZONE %q, using UTC: %v", name, err)
+		} else {
+			models.ClinicLocation = loc
+		}
+	}
+
+	models.Rules = models.BookingRules{
+		MinNotice:          time.Duration(utils.EnvInt("BOOKING_MIN_NOTICE_HOURS", 24)) * time.Hour,
+		Horizon:            time.Duration(utils.EnvInt("BOOKING_HORIZON_DAYS", 90)) * 24 * time.Hour,
+		CancellationCutoff: time.Duration(utils.EnvInt("CANCELLATION_CUTOFF_HOURS", 24)) * time.Hour,
+	}
+	models.OfferTTL = time.Duration(utils.EnvInt("WAITLIST_OFFER_HOURS", 2)) * time.Hour
+	if prefix := os.Getenv("INVOICE_PREFIX"); prefix != "" {
+		models.InvoicePrefix = prefix
+	}
+	models.InvoiceDueDays = utils.EnvInt("INVOICE_DUE_DAYS", 30)
+	models.InvoiceTaxRate = utils.EnvFloat("INVOICE_TAX_RATE", 0)
+
+	mux := http.NewServeMux()
+
 	// Register API endpoints
-	http.HandleFunc("/login", handlers.LoginHandler)
+	mux.HandleFunc("/login", handlers.LoginHandler)
+
+	// Pets: any logged in user; owners are limited to their own pets by the handlers
+	mux.Handle("GET /pets", protected(handlers.ListPets))
+	mux.Handle("POST /pets", protected(handlers.CreatePet))
+	mux.Handle("GET /pets/{id}", protected(handlers.GetPet))
+	mux.Handle("PUT /pets/{id}", protected(handlers.UpdatePet))
+	mux.Handle("PATCH /pets/{id}", protected(handlers.PatchPet))
+	mux.Handle("DELETE /pets/{id}", protected(handlers.DeletePet))
+	mux.Handle("GET /pets/{id}/appointments", protected(handlers.ListPetAppointments))
 
-	// Pets: Only staff/admin can access
-	http.Handle("/pets",
-		middleware.Logging(
-			middleware.AuthMiddleware(
-				http.HandlerFunc(handlers.PetsHandler),
-			),
-		),
-	)
+	// Alerts: visible wherever the pet is, editable only by staff/admin
+	mux.Handle("GET /pets/{id}/alerts", protected(handlers.ListPetAlerts))
+	mux.Handle("POST /pets/{id}/alerts", protected(handlers.CreatePetAlert, "staff", "admin"))
+	mux.Handle("PATCH /pets/{id}/alerts/{aid}", protected(handlers.PatchPetAlert, "staff", "admin"))
+	mux.Handle("DELETE /pets/{id}/alerts/{aid}", protected(handlers.DeletePetAlert, "staff", "admin"))
+
+	// Vaccinations: owners can read their pets' records, only staff/admin can change them
+	mux.Handle("GET /pets/{id}/vaccinations", protected(handlers.ListPetVaccinations))
+	mux.Handle("POST /pets/{id}/vaccinations", protected(handlers.CreatePetVaccination, "staff", "admin"))
+	mux.Handle("GET /pets/{id}/vaccinations/{vid}", protected(handlers.GetPetVaccination))
+	mux.Handle("PUT /pets/{id}/vaccinations/{vid}", protected(handlers.UpdatePetVaccination, "staff", "admin"))
+	mux.Handle("PATCH /pets/{id}/vaccinations/{vid}", protected(handlers.PatchPetVaccination, "staff", "admin"))
+	mux.Handle("DELETE /pets/{id}/vaccinations/{vid}", protected(handlers.DeletePetVaccination, "staff", "admin"))
+	mux.Handle("GET /vaccinations/due", protected(handlers.ListDueVaccinations, "staff", "admin"))
+
+	// Medical records: append-only SOAP entries written by staff, readable by the pet's owner
+	mux.Handle("GET /pets/{id}/records", protected(handlers.ListPetRecords))
+	mux.Handle("POST /pets/{id}/records", protected(handlers.CreatePetRecord, "staff", "admin"))
+	mux.Handle("GET /pets/{id}/records/{rid}", protected(handlers.GetPetRecord))
+	mux.Handle("POST /pets/{id}/records/{rid}/amendments", protected(handlers.AmendPetRecord, "staff", "admin"))
+
+	// Vitals: recorded by staff, readable by the pet's owner
+	mux.Handle("GET /pets/{id}/vitals", protected(handlers.ListPetVitals))
+	mux.Handle("POST /pets/{id}/vitals", protected(handlers.CreatePetVitals, "staff", "admin"))
+	mux.Handle("GET /pets/{id}/vitals/{vid}", protected(handlers.GetPetVitals))
+	mux.Handle("GET /pets/{id}/vitals/trend", protected(handlers.GetPetVitalsTrend))
+
+	// Prescriptions: staff prescribe, renew and discontinue; owners can read and print their pets' current ones
+	mux.Handle("GET /pets/{id}/prescriptions", protected(handlers.ListPetPrescriptions))
+	mux.Handle("POST /pets/{id}/prescriptions", protected(handlers.CreatePetPrescription, "staff", "admin"))
+	mux.Handle("GET /prescriptions/{id}", protected(handlers.GetPrescription))
+	mux.Handle("GET /prescriptions/{id}/print", protected(handlers.PrintPrescription))
+	mux.Handle("POST /prescriptions/{id}/renew", protected(handlers.RenewPrescription, "staff", "admin"))
+	mux.Handle("POST /prescriptions/{id}/discontinue", protected(handlers.DiscontinuePrescription, "staff", "admin"))
 
 	// Owners: staff, admin, and owner can access
-	http.Handle("/owners",
-		middleware.Logging(
-			middleware.AuthMiddleware(
-				middleware.RoleBasedAccess("staff", "admin", "owner")(
-					http.HandlerFunc(handlers.OwnersHandler),
-				),
-			),
-		),
-	)
+	mux.Handle("GET /owners", protected(handlers.ListOwners, "staff", "admin", "owner"))
+	mux.Handle("POST /owners", protected(handlers.CreateOwner, "staff", "admin", "owner"))
+	mux.Handle("GET /owners/{id}", protected(handlers.GetOwner, "staff", "admin", "owner"))
+	mux.Handle("PUT /owners/{id}", protected(handlers.UpdateOwner, "staff", "admin", "owner"))
+	mux.Handle("PATCH /owners/{id}", protected(handlers.PatchOwner, "staff", "admin", "owner"))
+	mux.Handle("DELETE /owners/{id}", protected(handlers.DeleteOwner, "staff", "admin", "owner"))
+	mux.Handle("GET /owners/{id}/dependencies", protected(handlers.GetOwnerDependencies, "staff", "admin"))
+	mux.Handle("GET /owners/{id}/pets", protected(handlers.ListOwnerPets, "staff", "admin", "owner"))
+	mux.Handle("GET /owners/{id}/appointments", protected(handlers.ListOwnerAppointments, "staff", "admin", "owner"))
+	mux.Handle("GET /owners/{id}/contact-preferences", protected(handlers.GetContactPreferences, "staff", "admin", "owner"))
+	mux.Handle("PUT /owners/{id}/contact-preferences", protected(handlers.UpdateContactPreferences, "staff", "admin", "owner"))
 
 	// Appointments: staff, admin, and owner can access
-	http.Handle("/appointments",
-		middleware.Logging(
-			middleware.AuthMiddleware(
-				middleware.RoleBasedAccess("staff", "admin", "owner")(
-					http.HandlerFunc(handlers.AppointmentsHandler),
-				),
-			),
-		),
-	)
-
-	http.HandleFunc("/upload", handlers.UploadFileHandler)
-	http.HandleFunc("/download", handlers.DownloadFileHandler)
+	mux.Handle("GET /appointments", protected(handlers.ListAppointments, "staff", "admin", "owner"))
+	mux.Handle("POST /appointments", protected(handlers.CreateAppointment, "staff", "admin", "owner"))
+	mux.Handle("GET /appointments/{id}", protected(handlers.GetAppointment, "staff", "admin", "owner"))
+	mux.Handle("PUT /appointments/{id}", protected(handlers.UpdateAppointment, "staff", "admin", "owner"))
+	mux.Handle("PATCH /appointments/{id}", protected(handlers.PatchAppointment, "staff", "admin", "owner"))
+	mux.Handle("DELETE /appointments/{id}", protected(handlers.DeleteAppointment, "staff", "admin", "owner"))
+	mux.Handle("POST /appointments/{id}/status", protected(handlers.ChangeAppointmentStatus, "staff", "admin", "owner"))
+	mux.Handle("POST /appointments/{id}/approve", protected(handlers.ApproveAppointment, "staff", "admin"))
+	mux.Handle("GET /appointments/{id}/history", protected(handlers.GetAppointmentHistory, "staff", "admin", "owner"))
+	mux.Handle("GET /appointments/{id}/reminders", protected(handlers.ListAppointmentReminders, "staff", "admin", "owner"))
+	mux.Handle("GET /reminders", protected(handlers.ListReminders, "staff", "admin"))
+	mux.Handle("GET /queue", protected(handlers.GetQueue, "staff", "admin"))
+
+	// Recurring appointments: staff only
+	mux.Handle("POST /appointment-series", protected(handlers.CreateAppointmentSeries, "staff", "admin"))
+	mux.Handle("GET /appointment-series/{id}", protected(handlers.GetAppointmentSeries, "staff", "admin"))
+	mux.Handle("PATCH /appointment-series/{id}", protected(handlers.PatchAppointmentSeries, "staff", "admin"))
+	mux.Handle("POST /appointment-series/{id}/cancel", protected(handlers.CancelAppointmentSeries, "staff", "admin"))
+
+	// Scheduling: appointment types are set up by admins, vet schedules by staff; anyone can search for open slots
+	mux.Handle("GET /appointment-types", protected(handlers.ListAppointmentTypes))
+	mux.Handle("POST /appointment-types", protected(handlers.CreateAppointmentType, "admin"))
+	mux.Handle("PUT /appointment-types/{id}", protected(handlers.UpdateAppointmentType, "admin"))
+	mux.Handle("GET /vets/{id}/schedule", protected(handlers.GetVetSchedule, "staff", "admin"))
+	mux.Handle("PUT /vets/{id}/schedule", protected(handlers.UpdateVetSchedule, "staff", "admin"))
+	mux.Handle("POST /vets/{id}/days-off", protected(handlers.CreateVetDayOff, "staff", "admin"))
+	mux.Handle("DELETE /vets/{id}/days-off/{did}", protected(handlers.DeleteVetDayOff, "staff", "admin"))
+	mux.Handle("GET /availability", protected(handlers.GetAvailability))
+
+	// Waitlist: staff manage it, owners can join, withdraw and answer offers for their own pets
+	mux.Handle("GET /waitlist", protected(handlers.ListWaitlist, "staff", "admin", "owner"))
+	mux.Handle("POST /waitlist", protected(handlers.CreateWaitlistEntry, "staff", "admin", "owner"))
+	mux.Handle("GET /waitlist/{id}", protected(handlers.GetWaitlistEntry, "staff", "admin", "owner"))
+	mux.Handle("DELETE /waitlist/{id}", protected(handlers.WithdrawWaitlistEntry, "staff", "admin", "owner"))
+	mux.Handle("POST /waitlist/{id}/offer/accept", protected(handlers.AcceptWaitlistOffer, "staff", "admin", "owner"))
+	mux.Handle("POST /waitlist/{id}/offer/decline", protected(handlers.DeclineWaitlistOffer, "staff", "admin", "owner"))
+
+	// Invoices: staff bill owners, who can read and print their own once issued
+	mux.Handle("GET /invoices", protected(handlers.ListInvoices))
+	mux.Handle("POST /invoices", protected(handlers.CreateInvoice, "staff", "admin"))
+	mux.Handle("POST /appointments/{id}/invoice", protected(handlers.InvoiceAppointment, "staff", "admin"))
+	mux.Handle("GET /invoices/{id}", protected(handlers.GetInvoice))
+	mux.Handle("PUT /invoices/{id}", protected(handlers.UpdateInvoice, "staff", "admin"))
+	mux.Handle("DELETE /invoices/{id}", protected(handlers.DeleteInvoice, "staff", "admin"))
+	mux.Handle("GET /invoices/{id}/print", protected(handlers.PrintInvoice))
+	mux.Handle("POST /invoices/{id}/issue", protected(handlers.IssueInvoice, "staff", "admin"))
+	mux.Handle("POST /invoices/{id}/pay", protected(handlers.PayInvoice, "staff", "admin"))
+	mux.Handle("POST /invoices/{id}/void", protected(handlers.VoidInvoice, "staff", "admin"))
+
+	// Notification templates: admins edit the wording of reminders and recall notices
+	mux.Handle("GET /notification-templates", protected(handlers.ListNotificationTemplates, "admin"))
+	mux.Handle("GET /notification-templates/{kind}/{channel}/{locale}", protected(handlers.GetNotificationTemplate, "admin"))
+	mux.Handle("PUT /notification-templates/{kind}/{channel}/{locale}", protected(handlers.UpdateNotificationTemplate, "admin"))
+	mux.Handle("GET /notification-templates/{kind}/{channel}/{locale}/versions", protected(handlers.ListNotificationTemplateVersions, "admin"))
+	mux.Handle("POST /notification-templates/{kind}/{channel}/{locale}/rollback", protected(handlers.RollbackNotificationTemplate, "admin"))
+	mux.Handle("POST /notification-templates/{kind}/{channel}/{locale}/preview", protected(handlers.PreviewNotificationTemplate, "admin"))
+
+	// Recall campaigns: rules are set up by admins, staff follow the recall list
+	mux.Handle("GET /recall-rules", protected(handlers.ListRecallRules, "staff", "admin"))
+	mux.Handle("POST /recall-rules", protected(handlers.CreateRecallRule, "admin"))
+	mux.Handle("PUT /recall-rules/{id}", protected(handlers.UpdateRecallRule, "admin"))
+	mux.Handle("GET /recalls", protected(handlers.ListRecalls, "staff", "admin"))
+
+	// Calendar feeds: any logged in user can get a secret iCalendar URL; the feed itself is fetched
+	// with the token instead of a login and is not logged, to keep the token out of the logs
+	mux.Handle("POST /me/calendar-feed", protected(handlers.IssueCalendarFeed))
+	mux.Handle("DELETE /me/calendar-feed", protected(handlers.RevokeCalendarFeed))
+	mux.HandleFunc("GET /calendar/{file}", handlers.CalendarFeed)
+
+	// New client intake: owner, first pet and first appointment in one transaction
+	mux.Handle("POST /intake", protected(handlers.CreateIntake, "staff", "admin"))
+
+	// Trash: admin only
+	mux.Handle("GET /admin/trash/{kind}", protected(handlers.ListTrash, "admin"))
+	mux.Handle("POST /admin/trash/{kind}/{id}/restore", protected(handlers.RestoreFromTrash, "admin"))
+
+	// Appointments whose old free-text time could not be converted: admin only
+	mux.Handle("GET /admin/appointment-time-issues", protected(handlers.ListAppointmentTimeIssues, "admin"))
+
+	// Files: any logged in user; owners can only link and fetch files of their own records
+	mux.Handle("/upload", protected(handlers.UploadFileHandler))
+	mux.Handle("/download", protected(handlers.DownloadFileHandler))
+
+	// Background jobs
+	retentionDays := utils.EnvInt("SOFT_DELETE_RETENTION_DAYS", 90)
+	jobs.StartPurge(time.Duration(retentionDays)*24*time.Hour, time.Hour)
+	senders := map[string]notify.Sender{
+		models.ChannelEmail: notify.EmailSenderFromEnv(),
+		models.ChannelSMS:   notify.SMSSenderFromEnv(),
+	}
+	reminderOffsets := utils.EnvDurations("REMINDER_OFFSETS", []time.Duration{48 * time.Hour, 2 * time.Hour})
+	jobs.StartReminders(reminderOffsets, senders, time.Minute)
+	jobs.StartRecalls(os.Getenv("BOOKING_URL"), senders, time.Hour)
+	jobs.StartWaitlist(senders, time.Minute)
 
 	log.Println("Server running on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Fatal(http.ListenAndServe(":8080", mux))
 }
@@ -7,66 +7,277 @@ import (
 	"time"
 )
 
+// DefaultAppointmentMinutes is the duration of an appointment booked without one
+const DefaultAppointmentMinutes = 30
+
 type Appointment struct {
-	ID      int       `json:"id"`
-	Date    time.Time `json:"date"`
-	Time    string    `json:"time"`
-	PetID   int       `json:"pet_id"`
-	Reason  string    `json:"reason"`
-	OwnerID int       `json:"owner_id"` // Add owner ID field for ownership tracking
+	ID              int       `json:"id"`
+	StartsAt        time.Time `json:"starts_at"`
+	EndsAt          time.Time `json:"ends_at"`
+	DurationMinutes int       `json:"duration_minutes"` // derived from starts_at and ends_at; may be sent instead of ends_at
+
+	// Date and Time are the start in the clinic's time zone, for clients written before starts_at.
+	// They are filled in on every response and accepted in its place (see ResolveTimes).
+	Date time.Time `json:"date"`
+	Time string    `json:"time"`
+
+	TypeID   int    `json:"appointment_type_id,omitempty"`
+	VetID    int    `json:"vet_id,omitempty"` // staff user seeing the pet
+	Room     string `json:"room,omitempty"`
+	PetID    int    `json:"pet_id"`
+	Reason   string `json:"reason"`
+	SeriesID int    `json:"series_id,omitempty"` // set for occurrences of a recurring series
+	Status   string `json:"status"`              // see appointment_status.go; changed only through status transitions
+	OwnerID  int    `json:"owner_id"`            // owner of the pet, used for ownership checks
+	Version  int    `json:"version"`             // incremented on every update, exposed as the ETag
+
+	PetAlerts []PetAlert `json:"pet_alerts,omitempty"` // read-only; filled in by AttachAppointmentAlerts
 }
 
-func GetAllAppointments() []Appointment {
-	rows, err := db.DB.Query("SELECT id, date, time, pet_id, reason FROM appointments")
-	if err != nil {
-		utils.Error("Failed to fetch appointments: %v", err)
-		return nil
+// Validate checks the fields required to store an appointment
+func (a Appointment) Validate() error {
+	var v ValidationError
+	v.check(!a.StartsAt.IsZero(), "starts_at", "is required")
+	v.check(a.EndsAt.After(a.StartsAt), "ends_at", "must be after starts_at")
+	v.check(a.PetID > 0, "pet_id", "is required")
+	return v.err()
+}
+
+// ScheduleConflictError is returned when an appointment overlaps another live booking for the same
+// vet or room. Conflict is the appointment already holding the slot, if it could be found.
+type ScheduleConflictError struct {
+	Conflict *Appointment
+}
+
+func (e *ScheduleConflictError) Error() string {
+	return "appointment overlaps another booking for the same vet or room"
+}
+
+// scheduleConflict turns a violation of the overlap constraints into a *ScheduleConflictError
+// carrying the appointment that already holds the slot
+func scheduleConflict(err error, a Appointment) error {
+	if !isExclusionViolation(err) {
+		return err
+	}
+	conflict := &ScheduleConflictError{}
+	// The failed statement may have aborted a transaction, so look the other booking up outside it
+	var found Appointment
+	row := db.DB.QueryRow(appointmentColumns+` WHERE `+appointmentLive+` AND `+appointmentHoldsSlot+` AND a.id <> $1
+         AND ((a.vet_id = $2) OR (a.room <> '' AND a.room = $3))
+         AND a.slot && tstzrange($4, $5)
+         ORDER BY a.starts_at LIMIT 1`,
+		a.ID, a.VetID, a.Room, a.StartsAt, a.EndsAt)
+	if scanErr := scanAppointment(row, &found); scanErr == nil {
+		conflict.Conflict = &found
+	} else {
+		utils.Warn("Could not find the appointment conflicting with %d: %v", a.ID, scanErr)
 	}
+	return conflict
+}
+
+// appointmentColumns selects an appointment joined with its pet so OwnerID reflects the pet's owner
+const appointmentColumns = `SELECT a.id, a.starts_at, a.ends_at, COALESCE(a.appointment_type_id, 0), COALESCE(a.vet_id, 0), a.room,
+                a.pet_id, a.reason, COALESCE(a.series_id, 0), a.status, p.owner_id, a.version
+         FROM appointments a
+         JOIN pets p ON a.pet_id = p.id`
+
+// appointmentLive hides soft-deleted appointments and those of soft-deleted pets
+const appointmentLive = "a.deleted_at IS NULL AND p.deleted_at IS NULL"
+
+func scanAppointment(row interface{ Scan(...interface{}) error }, a *Appointment) error {
+	err := row.Scan(&a.ID, &a.StartsAt, &a.EndsAt, &a.TypeID, &a.VetID, &a.Room,
+		&a.PetID, &a.Reason, &a.SeriesID, &a.Status, &a.OwnerID, &a.Version)
+	a.fillLegacyTimes()
+	return err
+}
+
+func scanAppointments(rows *sql.Rows, caller string) []Appointment {
 	defer rows.Close()
 
 	var appointments []Appointment
 	for rows.Next() {
 		var a Appointment
-		err := rows.Scan(&a.ID, &a.Date, &a.Time, &a.PetID, &a.Reason)
+		err := scanAppointment(rows, &a)
 		if err != nil {
 			utils.Warn("Failed to scan appointment row: %v", err)
 			continue
 		}
 		appointments = append(appointments, a)
 	}
-	if err = rows.Err(); err != nil {
-		utils.Error("Rows error in GetAllAppointments: %v", err)
+	if err := rows.Err(); err != nil {
+		utils.Error("Rows error in %s: %v", caller, err)
 	}
 	return appointments
 }
 
-func AddAppointment(a Appointment) error {
-	_, err := db.DB.Exec("INSERT INTO appointments (date, time, pet_id, reason, owner_id) VALUES ($1, $2, $3, $4, $5)", a.Date, a.Time, a.PetID, a.Reason, a.OwnerID)
+// AppointmentFilter narrows ListAppointments; zero-valued fields are ignored
+type AppointmentFilter struct {
+	PetID   int
+	OwnerID int
+	VetID   int
+	Status  string
+	From    time.Time // inclusive start date, in the clinic's time zone
+	To      time.Time // inclusive end date, in the clinic's time zone
+	Reason  string    // substring match
+}
+
+var appointmentSortColumns = map[string]string{
+	"id":        "a.id",
+	"starts_at": "a.starts_at",
+	"date":      "a.starts_at", // legacy name
+	"pet_id":    "a.pet_id",
+	"reason":    "a.reason",
+}
+
+// ListAppointments returns one page of appointments matching the filter, sorted by opts.Sort (default starts_at)
+func ListAppointments(f AppointmentFilter, opts ListOptions) (Page[Appointment], error) {
+	opts = opts.normalize()
+	page := Page[Appointment]{Items: []Appointment{}, Limit: opts.Limit, Offset: opts.Offset}
+	order, err := opts.orderBy(appointmentSortColumns, "a.id", "starts_at")
+	if err != nil {
+		return page, err
+	}
+
+	var where whereBuilder
+	where.addExpr(appointmentLive)
+	if f.PetID != 0 {
+		where.add("a.pet_id = ?", f.PetID)
+	}
+	if f.OwnerID != 0 {
+		where.add("p.owner_id = ?", f.OwnerID)
+	}
+	if f.VetID != 0 {
+		where.add("a.vet_id = ?", f.VetID)
+	}
+	if f.Status != "" {
+		where.add("a.status = ?", f.Status)
+	}
+	if !f.From.IsZero() {
+		where.add("a.starts_at >= ?", clinicDay(f.From))
+	}
+	if !f.To.IsZero() {
+		where.add("a.starts_at < ?", clinicDay(f.To).AddDate(0, 0, 1))
+	}
+	if f.Reason != "" {
+		where.add("a.reason ILIKE ?", containsPattern(f.Reason))
+	}
+
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM appointments a JOIN pets p ON a.pet_id = p.id"+where.String(), where.args...).
+		Scan(&page.Total)
+	if err != nil {
+		utils.Error("Failed to count appointments: %v", err)
+		return page, err
+	}
+
+	limit, args := where.limitOffset(opts)
+	rows, err := db.DB.Query(appointmentColumns+where.String()+order+limit, args...)
+	if err != nil {
+		utils.Error("Failed to fetch appointments: %v", err)
+		return page, err
+	}
+	if items := scanAppointments(rows, "ListAppointments"); items != nil {
+		page.Items = items
+	}
+	return page, nil
+}
+
+// AddAppointment inserts an appointment and returns it with the ID assigned by the database.
+// The stored owner_id is taken from the pet. Returns a *ScheduleConflictError if the vet or room
+// is already booked for an overlapping time.
+func AddAppointment(a Appointment) (Appointment, error) {
+	created := a
+	err := db.WithTx(func(tx *sql.Tx) error {
+		var err error
+		created, err = AddAppointmentTx(tx, a)
+		return err
+	})
+	return created, err
+}
+
+// AddAppointmentTx is AddAppointment run on q, which may be a transaction
+func AddAppointmentTx(q db.Querier, a Appointment) (Appointment, error) {
+	if a.Status == "" {
+		a.Status = StatusConfirmed
+	}
+	err := q.QueryRow(
+		`INSERT INTO appointments (starts_at, ends_at, appointment_type_id, vet_id, room, pet_id, reason, series_id, status, owner_id)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, (SELECT owner_id FROM pets WHERE id = $6))
+         RETURNING id, COALESCE(owner_id, 0), version`,
+		a.StartsAt, a.EndsAt, nullID(a.TypeID), nullID(a.VetID), a.Room, a.PetID, a.Reason,
+		nullID(a.SeriesID), a.Status).
+		Scan(&a.ID, &a.OwnerID, &a.Version)
 	if err != nil {
 		utils.Error("AddAppointment DB error: %v", err)
+		return a, scheduleConflict(err, a)
 	}
-	return err
+	if err := recordStatusChange(q, a.ID, "", a.Status, 0, ""); err != nil {
+		utils.Error("AddAppointment DB error: %v", err)
+		return a, err
+	}
+	if err := creditRecalls(q, a); err != nil {
+		utils.Error("AddAppointment DB error: %v", err)
+		return a, err
+	}
+	return a, nil
 }
 
-func UpdateAppointment(id int, a Appointment) error {
-	_, err := db.DB.Exec("UPDATE appointments SET date=$1, time=$2, pet_id=$3, reason=$4 WHERE id=$5", a.Date, a.Time, a.PetID, a.Reason, id)
+// UpdateAppointment overwrites the appointment if it is still at a.Version and returns it with its new version.
+// A change of status is recorded in the status history against changedBy.
+// Returns ErrVersionConflict if someone else updated it first, or a *ScheduleConflictError if the
+// new time overlaps another booking for the same vet or room.
+func UpdateAppointment(id int, a Appointment, changedBy int) (Appointment, error) {
+	a.ID = id
+	err := db.WithTx(func(tx *sql.Tx) error {
+		var oldStatus string
+		err := tx.QueryRow(
+			`UPDATE appointments SET starts_at=$1, ends_at=$2, appointment_type_id=$3, vet_id=$4, room=$5,
+                    pet_id=$6, reason=$7, status=$8, time_unresolved=false, version=version+1
+             FROM (SELECT status FROM appointments WHERE id=$9) old
+             WHERE appointments.id=$9 AND version=$10 AND deleted_at IS NULL
+             RETURNING version, (SELECT owner_id FROM pets WHERE id = $6), old.status`,
+			a.StartsAt, a.EndsAt, nullID(a.TypeID), nullID(a.VetID), a.Room, a.PetID, a.Reason, a.Status,
+			id, a.Version).
+			Scan(&a.Version, &a.OwnerID, &oldStatus)
+		if err != nil {
+			return err
+		}
+		// Saving the appointment settles any time the migration could not parse, giving it a slot
+		if _, err := tx.Exec("DELETE FROM appointment_time_migration_issues WHERE appointment_id=$1", id); err != nil {
+			return err
+		}
+		if oldStatus == a.Status {
+			return nil
+		}
+		return recordStatusChange(tx, id, oldStatus, a.Status, changedBy, "rescheduled")
+	})
 	if err != nil {
 		utils.Error("UpdateAppointment DB error: %v", err)
+		return a, scheduleConflict(versionConflict(err), a)
 	}
-	return err
+	return a, nil
 }
 
-func DeleteAppointment(id int) error {
-	_, err := db.DB.Exec("DELETE FROM appointments WHERE id=$1", id)
+// DeleteAppointment soft-deletes the appointment if it is still at the given version, otherwise returns
+// ErrVersionConflict. The row stays in the trash until restored or purged. A slot it was still holding
+// is offered to the waitlist.
+func DeleteAppointment(id, version, deletedBy int) error {
+	var status string
+	err := db.DB.QueryRow("UPDATE appointments SET deleted_at=now(), deleted_by=$3, version=version+1 WHERE id=$1 AND version=$2 AND deleted_at IS NULL RETURNING status",
+		id, version, deletedBy).Scan(&status)
 	if err != nil {
+		err = versionConflict(err)
 		utils.Error("DeleteAppointment DB error: %v", err)
+		return err
 	}
-	return err
+	if holdsSlot(status) {
+		offerFreedSlot(id)
+	}
+	return nil
 }
 
 func GetAppointmentByID(id int) *Appointment {
 	var a Appointment
-	err := db.DB.QueryRow("SELECT id, date, time, pet_id, reason FROM appointments WHERE id=$1", id).Scan(&a.ID, &a.Date, &a.Time, &a.PetID, &a.Reason)
+	err := scanAppointment(db.DB.QueryRow(appointmentColumns+" WHERE a.id=$1 AND "+appointmentLive, id), &a)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			utils.Warn("No appointment found with id: %d", id)
@@ -77,31 +288,3 @@ func GetAppointmentByID(id int) *Appointment {
 	}
 	return &a
 }
-
-func GetAppointmentsByOwnerID(ownerID int) []Appointment {
-	rows, err := db.DB.Query(
-		`SELECT a.id, a.date, a.time, a.pet_id, a.reason
-         FROM appointments a
-         JOIN pets p ON a.pet_id = p.id
-         WHERE p.owner_id = $1`, ownerID)
-	if err != nil {
-		utils.Error("Failed to fetch appointments for owner %d: %v", ownerID, err)
-		return nil
-	}
-	defer rows.Close()
-
-	var appointments []Appointment
-	for rows.Next() {
-		var a Appointment
-		err := rows.Scan(&a.ID, &a.Date, &a.Time, &a.PetID, &a.Reason)
-		if err != nil {
-			utils.Warn("Failed to scan appointment row: %v", err)
-			continue
-		}
-		appointments = append(appointments, a)
-	}
-	if err = rows.Err(); err != nil {
-		utils.Error("Rows error in GetAppointmentsByOwnerID: %v", err)
-	}
-	return appointments
-}
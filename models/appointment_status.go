@@ -0,0 +1,229 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"petclinic/db"
+	"petclinic/utils"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Appointment statuses
+const (
+	StatusRequested  = "requested" // booked by an owner, waiting for staff approval
+	StatusConfirmed  = "confirmed"
+	StatusCheckedIn  = "checked_in"
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+	StatusCancelled  = "cancelled"
+	StatusNoShow     = "no_show"
+)
+
+// statusTransitions lists the statuses each status may move to; completed, cancelled and no_show are final.
+// A confirmed appointment also goes back to requested when an owner reschedules it into a type needing
+// approval, but only through the reschedule itself, never as a status change of its own.
+var statusTransitions = map[string][]string{
+	StatusRequested:  {StatusConfirmed, StatusCancelled},
+	StatusConfirmed:  {StatusCheckedIn, StatusCancelled, StatusNoShow},
+	StatusCheckedIn:  {StatusInProgress, StatusCancelled},
+	StatusInProgress: {StatusCompleted},
+}
+
+// appointmentHoldsSlot is true for appointments that still occupy their vet and room
+const appointmentHoldsSlot = "a.status NOT IN ('cancelled', 'no_show')"
+
+// holdsSlot is the Go counterpart of appointmentHoldsSlot
+func holdsSlot(status string) bool {
+	return status != StatusCancelled && status != StatusNoShow
+}
+
+// IsStatus reports whether s is one of the appointment statuses
+func IsStatus(s string) bool {
+	switch s {
+	case StatusRequested, StatusConfirmed, StatusCheckedIn, StatusInProgress, StatusCompleted, StatusCancelled, StatusNoShow:
+		return true
+	}
+	return false
+}
+
+// IsUpcoming reports whether an appointment in status s has not happened yet and can still be rescheduled
+func IsUpcoming(s string) bool {
+	return s == StatusRequested || s == StatusConfirmed
+}
+
+// CanTransition reports whether an appointment may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionError is returned for a status change the lifecycle does not allow
+type TransitionError struct {
+	From, To string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot change appointment status from %s to %s", e.From, e.To)
+}
+
+// StatusChange is one entry in an appointment's status history
+type StatusChange struct {
+	ID            int       `json:"id"`
+	AppointmentID int       `json:"appointment_id"`
+	FromStatus    string    `json:"from_status,omitempty"` // empty for the status it was created with
+	ToStatus      string    `json:"to_status"`
+	ChangedBy     int       `json:"changed_by,omitempty"`
+	Note          string    `json:"note"`
+	ChangedAt     time.Time `json:"changed_at"`
+}
+
+// recordStatusChange appends to the appointment's status history
+func recordStatusChange(q db.Querier, appointmentID int, from, to string, by int, note string) error {
+	var fromStatus sql.NullString
+	if from != "" {
+		fromStatus = sql.NullString{String: from, Valid: true}
+	}
+	_, err := q.Exec("INSERT INTO appointment_status_changes (appointment_id, from_status, to_status, changed_by, note) VALUES ($1, $2, $3, $4, $5)",
+		appointmentID, fromStatus, to, nullID(by), note)
+	return err
+}
+
+// TransitionAppointment moves the appointment to a new status if the lifecycle allows it, recording who did it
+// and when, and returns the new version. A slot freed by cancelling is offered to the waitlist.
+// Returns a *TransitionError for a disallowed change.
+func TransitionAppointment(id int, to string, by int, note string) (int, error) {
+	var version int
+	err := db.WithTx(func(tx *sql.Tx) error {
+		var from string
+		err := tx.QueryRow("SELECT status FROM appointments WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&from)
+		if err != nil {
+			return versionConflict(err)
+		}
+		if !CanTransition(from, to) {
+			return &TransitionError{From: from, To: to}
+		}
+		err = tx.QueryRow("UPDATE appointments SET status=$1, version=version+1 WHERE id=$2 RETURNING version", to, id).Scan(&version)
+		if err != nil {
+			return err
+		}
+		return recordStatusChange(tx, id, from, to, by, note)
+	})
+	if err != nil {
+		utils.Error("TransitionAppointment DB error: %v", err)
+		return version, err
+	}
+	if !holdsSlot(to) {
+		offerFreedSlot(id)
+	}
+	return version, nil
+}
+
+// GetStatusHistory returns an appointment's status changes, oldest first
+func GetStatusHistory(appointmentID int) ([]StatusChange, error) {
+	history := []StatusChange{}
+	rows, err := db.DB.Query(
+		`SELECT id, appointment_id, COALESCE(from_status, ''), to_status, COALESCE(changed_by, 0), note, changed_at
+         FROM appointment_status_changes WHERE appointment_id=$1 ORDER BY changed_at, id`, appointmentID)
+	if err != nil {
+		utils.Error("Failed to fetch status history: %v", err)
+		return history, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c StatusChange
+		if err := rows.Scan(&c.ID, &c.AppointmentID, &c.FromStatus, &c.ToStatus, &c.ChangedBy, &c.Note, &c.ChangedAt); err != nil {
+			utils.Warn("Failed to scan status change row: %v", err)
+			continue
+		}
+		history = append(history, c)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in GetStatusHistory: %v", err)
+	}
+	return history, err
+}
+
+// QueueEntry is an appointment on the front desk's queue for the day
+type QueueEntry struct {
+	Appointment
+	CheckedInAt    *time.Time `json:"checked_in_at,omitempty"`
+	WaitingMinutes int        `json:"waiting_minutes"` // since check-in, for checked-in pets
+}
+
+// GetQueue returns the clinic day's appointments that are still to be dealt with: pets being seen first, then
+// pets waiting in order of arrival, then expected arrivals in appointment order
+func GetQueue(day time.Time) ([]QueueEntry, error) {
+	queue := []QueueEntry{}
+	from := clinicDay(day)
+	rows, err := db.DB.Query(appointmentColumns+" WHERE "+appointmentLive+
+		" AND a.starts_at >= $1 AND a.starts_at < $2 AND a.status IN ('confirmed', 'checked_in', 'in_progress') ORDER BY a.starts_at, a.id",
+		from, from.AddDate(0, 0, 1))
+	if err != nil {
+		utils.Error("Failed to fetch queue: %v", err)
+		return queue, err
+	}
+	apts := scanAppointments(rows, "GetQueue")
+	if len(apts) == 0 {
+		return queue, nil
+	}
+
+	ids := make([]int, len(apts))
+	for i, a := range apts {
+		ids[i] = a.ID
+	}
+	checkIns := map[int]time.Time{}
+	rows, err = db.DB.Query(
+		`SELECT appointment_id, max(changed_at) FROM appointment_status_changes
+         WHERE appointment_id = ANY($1) AND to_status = 'checked_in' GROUP BY appointment_id`, pq.Array(ids))
+	if err != nil {
+		utils.Error("Failed to fetch check-in times: %v", err)
+		return queue, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			utils.Warn("Failed to scan check-in row: %v", err)
+			continue
+		}
+		checkIns[id] = at
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in GetQueue: %v", err)
+		return queue, err
+	}
+
+	now := time.Now()
+	for _, a := range apts {
+		e := QueueEntry{Appointment: a}
+		if at, ok := checkIns[a.ID]; ok {
+			e.CheckedInAt = &at
+			if a.Status == StatusCheckedIn {
+				e.WaitingMinutes = int(now.Sub(at).Minutes())
+			}
+		}
+		queue = append(queue, e)
+	}
+
+	rank := map[string]int{StatusInProgress: 0, StatusCheckedIn: 1, StatusConfirmed: 2}
+	sort.SliceStable(queue, func(i, j int) bool {
+		if rank[queue[i].Status] != rank[queue[j].Status] {
+			return rank[queue[i].Status] < rank[queue[j].Status]
+		}
+		ci, cj := queue[i].CheckedInAt, queue[j].CheckedInAt
+		if queue[i].Status == StatusCheckedIn && ci != nil && cj != nil {
+			return ci.Before(*cj)
+		}
+		return false
+	})
+	return queue, nil
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"petclinic/db"
+	"petclinic/utils"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClinicLocation is the clinic's time zone. Dates and clock times without a zone (legacy appointment
+// date/time, schedules, date filters) are read in it. Set from CLINIC_TIMEZONE at startup.
+var ClinicLocation = time.UTC
+
+// clinicDay is midnight at the start of d's calendar date in the clinic's time zone
+func clinicDay(d time.Time) time.Time {
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, ClinicLocation)
+}
+
+// atClock is the given minutes past midnight on d's calendar date in the clinic's time zone
+func atClock(d time.Time, minutes int) time.Time {
+	return time.Date(d.Year(), d.Month(), d.Day(), minutes/60, minutes%60, 0, 0, ClinicLocation)
+}
+
+// legacyClock matches the free-form times older clients sent, e.g. "09:00", "9am", "9:30 PM", "9.30"
+var legacyClock = regexp.MustCompile(`^(\d{1,2})(?:[:.](\d{2}))?(?::(\d{2}))?(?: ?([ap])\.? ?m\.?)?$`)
+
+// ParseClock parses a legacy clock time into minutes after midnight, accepting 24-hour times, 12-hour
+// times with am/pm, and "noon". Seconds are checked but dropped. It matches the parsing the database
+// migration applied to stored times.
+func ParseClock(s string) (int, bool) {
+	s = strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	if s == "noon" || s == "midday" || s == "12 noon" {
+		return 12 * 60, true
+	}
+	m := legacyClock.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	h, _ := strconv.Atoi(m[1])
+	mi := 0
+	if m[2] != "" {
+		mi, _ = strconv.Atoi(m[2])
+	}
+	sec := 0
+	if m[3] != "" {
+		sec, _ = strconv.Atoi(m[3])
+	}
+	if m[4] != "" {
+		if h < 1 || h > 12 {
+			return 0, false
+		}
+		if m[4] == "p" && h < 12 {
+			h += 12
+		} else if m[4] == "a" && h == 12 {
+			h = 0
+		}
+	}
+	if h > 23 || mi > 59 || sec > 59 {
+		return 0, false
+	}
+	return h*60 + mi, true
+}
+
+// fillLegacyTimes derives the clinic-local date and HH:MM time and the duration from starts_at and ends_at
+func (a *Appointment) fillLegacyTimes() {
+	if a.StartsAt.IsZero() {
+		return
+	}
+	a.StartsAt = a.StartsAt.In(ClinicLocation)
+	a.EndsAt = a.EndsAt.In(ClinicLocation)
+	a.Date = clinicDay(a.StartsAt)
+	a.Time = a.StartsAt.Format("15:04")
+	a.DurationMinutes = int(a.EndsAt.Sub(a.StartsAt).Minutes())
+}
+
+// ResolveTimes settles starts_at and ends_at from whichever fields the client sent, then refreshes the
+// derived date, time and duration. prev is the stored appointment when updating, nil when creating.
+//
+// The start comes from starts_at, or from the legacy date and time when starts_at is missing or, on an
+// update, when the client changed date or time but left starts_at alone. The end comes from ends_at if
+// the client set or changed it, otherwise from the start plus duration_minutes, so moving the start keeps
+// the length. Unparseable legacy times are returned as a *ValidationError.
+func (a *Appointment) ResolveTimes(prev *Appointment) error {
+	legacyChanged := a.StartsAt.IsZero() && !a.Date.IsZero()
+	if prev != nil && a.StartsAt.Equal(prev.StartsAt) {
+		legacyChanged = !a.Date.Equal(prev.Date) || a.Time != prev.Time
+	}
+	if legacyChanged {
+		minutes, ok := ParseClock(a.Time)
+		if !ok {
+			return &ValidationError{Fields: map[string]string{"time": "must be a clock time such as 09:30 or 9:30 am"}}
+		}
+		a.StartsAt = atClock(a.Date, minutes)
+	}
+	if a.StartsAt.IsZero() {
+		return &ValidationError{Fields: map[string]string{"starts_at": "is required"}}
+	}
+
+	endSet := !a.EndsAt.IsZero()
+	if prev != nil && a.EndsAt.Equal(prev.EndsAt) {
+		endSet = false
+	}
+	if !endSet {
+		if a.DurationMinutes <= 0 {
+			return &ValidationError{Fields: map[string]string{"duration_minutes": "must be positive"}}
+		}
+		a.EndsAt = a.StartsAt.Add(time.Duration(a.DurationMinutes) * time.Minute)
+	}
+	a.fillLegacyTimes()
+	return nil
+}
+
+// TimeMigrationIssue is an appointment whose legacy time could not be read when dates and times were
+// merged into starts_at. It was given a placeholder start at midnight and stays listed until it is updated.
+type TimeMigrationIssue struct {
+	AppointmentID int       `json:"appointment_id"`
+	LegacyDate    time.Time `json:"legacy_date"`
+	LegacyTime    string    `json:"legacy_time"`
+	Problem       string    `json:"problem"`
+	StartsAt      time.Time `json:"starts_at"` // the placeholder start
+	ReportedAt    time.Time `json:"reported_at"`
+}
+
+// ListTimeMigrationIssues returns the appointments still awaiting a corrected time, oldest date first
+func ListTimeMigrationIssues() ([]TimeMigrationIssue, error) {
+	issues := []TimeMigrationIssue{}
+	rows, err := db.DB.Query(
+		`SELECT i.appointment_id, i.legacy_date, i.legacy_time, i.problem, a.starts_at, i.reported_at
+         FROM appointment_time_migration_issues i JOIN appointments a ON a.id = i.appointment_id
+         WHERE a.deleted_at IS NULL ORDER BY i.legacy_date, i.appointment_id`)
+	if err != nil {
+		utils.Error("Failed to fetch time migration issues: %v", err)
+		return issues, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i TimeMigrationIssue
+		if err := rows.Scan(&i.AppointmentID, &i.LegacyDate, &i.LegacyTime, &i.Problem, &i.StartsAt, &i.ReportedAt); err != nil {
+			utils.Warn("Failed to scan time migration issue row: %v", err)
+			continue
+		}
+		i.StartsAt = i.StartsAt.In(ClinicLocation)
+		issues = append(issues, i)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListTimeMigrationIssues: %v", err)
+	}
+	return issues, err
+}
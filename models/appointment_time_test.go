@@ -0,0 +1,38 @@
+package models
+
+import "testing"
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"09:00", 9 * 60, true},
+		{"9", 9 * 60, true},
+		{"9.30", 9*60 + 30, true},
+		{"17:45", 17*60 + 45, true},
+		{"09:00:30", 9 * 60, true},
+		{"9am", 9 * 60, true},
+		{"9 AM", 9 * 60, true},
+		{"9:30 p.m.", 21*60 + 30, true},
+		{"12am", 0, true},
+		{"12pm", 12 * 60, true},
+		{" Noon ", 12 * 60, true},
+		{"midday", 12 * 60, true},
+		{"", 0, false},
+		{"morning", 0, false},
+		{"24:00", 0, false},
+		{"9:60", 0, false},
+		{"09:00:60", 0, false},
+		{"13pm", 0, false},
+		{"0am", 0, false},
+		{"9:5", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseClock(tt.in)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("ParseClock(%q) = %d, %v; want %d, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package models
+
+import (
+	"petclinic/db"
+	"petclinic/utils"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SlotStepMinutes is the spacing of candidate start times within a vet's working hours
+const SlotStepMinutes = 15
+
+// MaxAvailabilityDays caps the date range a single availability search may cover
+const MaxAvailabilityDays = 31
+
+// Slot is an open start time for an appointment of a given type with a given vet
+type Slot struct {
+	VetID           int       `json:"vet_id"`
+	StartsAt        time.Time `json:"starts_at"`
+	EndsAt          time.Time `json:"ends_at"`
+	Date            time.Time `json:"date"` // clinic-local start date and HH:MM time, for older clients
+	Time            string    `json:"time"`
+	DurationMinutes int       `json:"duration_minutes"`
+}
+
+// AvailabilityQuery asks for open slots of one appointment type between two clinic dates inclusive,
+// optionally with a single vet
+type AvailabilityQuery struct {
+	AppointmentTypeID int
+	From              time.Time
+	To                time.Time
+	VetID             int
+
+	ExcludeAppointmentID int // treat this appointment's slot as free, for rescheduling
+}
+
+// Validate checks the query names a type and a date range of at most MaxAvailabilityDays
+func (q AvailabilityQuery) Validate() error {
+	var v ValidationError
+	v.check(q.AppointmentTypeID > 0, "type_id", "is required")
+	v.check(!q.From.IsZero(), "from", "is required")
+	v.check(!q.To.IsZero(), "to", "is required")
+	if !q.From.IsZero() && !q.To.IsZero() {
+		v.check(!q.To.Before(q.From), "to", "must not be before from")
+		v.check(q.To.Sub(q.From) < MaxAvailabilityDays*24*time.Hour, "to", "must be within 31 days of from")
+	}
+	return v.err()
+}
+
+// interval is a half-open span of time
+type interval struct {
+	start, end time.Time
+}
+
+func (i interval) overlaps(o interval) bool {
+	return i.start.Before(o.end) && o.start.Before(i.end)
+}
+
+// FindAvailability computes the open slots for the query: each offering vet's working hours on each day,
+// minus breaks, days off and their existing appointments. Slots in the past are left out.
+// Returns ErrUnknownAppointmentType if the type does not exist.
+func FindAvailability(q AvailabilityQuery) ([]Slot, error) {
+	slots := []Slot{}
+	apptType, err := GetAppointmentTypeByID(q.AppointmentTypeID)
+	if err != nil {
+		return slots, err
+	}
+	if apptType == nil {
+		return slots, ErrUnknownAppointmentType
+	}
+	length := time.Duration(apptType.DurationMinutes) * time.Minute
+
+	vetIDs, err := vetsOffering(q.AppointmentTypeID, q.VetID)
+	if err != nil || len(vetIDs) == 0 {
+		return slots, err
+	}
+	blocks, err := scheduleBlocks(vetIDs)
+	if err != nil {
+		return slots, err
+	}
+	from := clinicDay(q.From)
+	rangeEnd := clinicDay(q.To).AddDate(0, 0, 1)
+	daysOff, err := daysOffBetween(vetIDs, from, clinicDay(q.To))
+	if err != nil {
+		return slots, err
+	}
+	booked, err := bookedIntervals(vetIDs, from, rangeEnd, q.ExcludeAppointmentID)
+	if err != nil {
+		return slots, err
+	}
+
+	now := time.Now()
+
+	for day := from; day.Before(rangeEnd); day = day.AddDate(0, 0, 1) {
+		for _, vetID := range vetIDs {
+			if daysOff[vetID][day.Format("2006-01-02")] {
+				continue
+			}
+			var working, breaks []interval
+			for _, b := range blocks[vetID] {
+				if b.Weekday != day.Weekday() {
+					continue
+				}
+				starts, _ := clockMinutes(b.Starts)
+				ends, _ := clockMinutes(b.Ends)
+				iv := interval{atClock(day, starts), atClock(day, ends)}
+				if b.Kind == BlockBreak {
+					breaks = append(breaks, iv)
+				} else {
+					working = append(working, iv)
+				}
+			}
+			busy := append(breaks, booked[vetID]...)
+
+			for _, w := range working {
+				for start := w.start; !start.Add(length).After(w.end); start = start.Add(SlotStepMinutes * time.Minute) {
+					candidate := interval{start, start.Add(length)}
+					if !start.After(now) || overlapsAny(candidate, busy) {
+						continue
+					}
+					slots = append(slots, Slot{
+						VetID:           vetID,
+						StartsAt:        start,
+						EndsAt:          candidate.end,
+						Date:            day,
+						Time:            start.Format("15:04"),
+						DurationMinutes: apptType.DurationMinutes,
+					})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		return slots[i].StartsAt.Before(slots[j].StartsAt)
+	})
+	return slots, nil
+}
+
+func overlapsAny(iv interval, others []interval) bool {
+	for _, o := range others {
+		if iv.overlaps(o) {
+			return true
+		}
+	}
+	return false
+}
+
+// vetsOffering lists the vets set up for the appointment type, limited to onlyVet if non-zero
+func vetsOffering(typeID, onlyVet int) ([]int, error) {
+	var where whereBuilder
+	where.add("appointment_type_id = ?", typeID)
+	if onlyVet != 0 {
+		where.add("vet_id = ?", onlyVet)
+	}
+	rows, err := db.DB.Query("SELECT vet_id FROM vet_appointment_types"+where.String()+" ORDER BY vet_id", where.args...)
+	if err != nil {
+		utils.Error("Failed to fetch vets offering type %d: %v", typeID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			utils.Warn("Failed to scan vet row: %v", err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// daysOffBetween returns, per vet, the set of YYYY-MM-DD dates they are off between from and to inclusive
+func daysOffBetween(vetIDs []int, from, to time.Time) (map[int]map[string]bool, error) {
+	off := map[int]map[string]bool{}
+	rows, err := db.DB.Query("SELECT vet_id, to_char(day, 'YYYY-MM-DD') FROM vet_days_off WHERE vet_id = ANY($1) AND day BETWEEN $2 AND $3",
+		pq.Array(vetIDs), from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		utils.Error("Failed to fetch days off: %v", err)
+		return off, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vetID int
+		var day string
+		if err := rows.Scan(&vetID, &day); err != nil {
+			utils.Warn("Failed to scan day off row: %v", err)
+			continue
+		}
+		if off[vetID] == nil {
+			off[vetID] = map[string]bool{}
+		}
+		off[vetID][day] = true
+	}
+	return off, rows.Err()
+}
+
+// bookedIntervals returns, per vet, the time taken by their live appointments overlapping [from, to),
+// other than excludeID
+func bookedIntervals(vetIDs []int, from, to time.Time, excludeID int) (map[int][]interval, error) {
+	booked := map[int][]interval{}
+	rows, err := db.DB.Query(
+		`SELECT a.vet_id, lower(a.slot), upper(a.slot) FROM appointments a
+         WHERE a.deleted_at IS NULL AND `+appointmentHoldsSlot+` AND a.vet_id = ANY($1) AND a.slot && tstzrange($2, $3) AND a.id <> $4`,
+		pq.Array(vetIDs), from, to, excludeID)
+	if err != nil {
+		utils.Error("Failed to fetch booked appointments: %v", err)
+		return booked, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vetID int
+		var iv interval
+		if err := rows.Scan(&vetID, &iv.start, &iv.end); err != nil {
+			utils.Warn("Failed to scan booked appointment row: %v", err)
+			continue
+		}
+		booked[vetID] = append(booked[vetID], iv)
+	}
+	return booked, rows.Err()
+}
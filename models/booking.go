@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+)
+
+// BookingRules are the limits on owners booking, rescheduling and cancelling their own appointments
+type BookingRules struct {
+	MinNotice          time.Duration // earliest booking, measured from now
+	Horizon            time.Duration // latest booking, measured from now
+	CancellationCutoff time.Duration // owners cannot cancel or reschedule closer to the start than this
+}
+
+// Rules are the clinic's booking rules, set from the environment at startup
+var Rules = BookingRules{
+	MinNotice:          24 * time.Hour,
+	Horizon:            90 * 24 * time.Hour,
+	CancellationCutoff: 24 * time.Hour,
+}
+
+// CanChange reports whether an owner may still cancel or reschedule the appointment
+func (r BookingRules) CanChange(a Appointment) bool {
+	return time.Until(a.StartsAt) >= r.CancellationCutoff
+}
+
+// PrepareOwnerBooking checks an owner's booking against the clinic rules and the vets' availability and
+// fills in what the owner does not choose: the vet (if left open), the duration of the appointment type,
+// no room, and a status of requested or confirmed depending on whether the type needs approval.
+// The start must already be resolved (see ResolveTimes). excludeID is the appointment being
+// rescheduled, whose current slot counts as free. Rule and availability failures are returned as a
+// *ValidationError.
+func (r BookingRules) PrepareOwnerBooking(a *Appointment, excludeID int) error {
+	var v ValidationError
+	v.check(a.TypeID > 0, "appointment_type_id", "is required")
+	v.check(!a.StartsAt.IsZero(), "starts_at", "is required")
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	v.check(!a.StartsAt.Before(now.Add(r.MinNotice)), "starts_at", "is too soon; book at least "+r.MinNotice.String()+" ahead")
+	v.check(!a.StartsAt.After(now.Add(r.Horizon)), "starts_at", "is too far ahead; book at most "+r.Horizon.String()+" ahead")
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	apptType, err := GetAppointmentTypeByID(a.TypeID)
+	if err != nil {
+		return err
+	}
+	if apptType == nil {
+		return &ValidationError{Fields: map[string]string{"appointment_type_id": "does not exist"}}
+	}
+
+	day := clinicDay(a.StartsAt.In(ClinicLocation))
+	slots, err := FindAvailability(AvailabilityQuery{
+		AppointmentTypeID:    a.TypeID,
+		From:                 day,
+		To:                   day,
+		VetID:                a.VetID,
+		ExcludeAppointmentID: excludeID,
+	})
+	if err != nil {
+		return err
+	}
+	vetID := 0
+	for _, s := range slots {
+		if s.StartsAt.Equal(a.StartsAt) {
+			vetID = s.VetID
+			break
+		}
+	}
+	if vetID == 0 {
+		return &ValidationError{Fields: map[string]string{"starts_at": "is not an available slot"}}
+	}
+
+	a.VetID = vetID
+	a.Room = ""
+	a.EndsAt = a.StartsAt.Add(time.Duration(apptType.DurationMinutes) * time.Minute)
+	a.Status = StatusConfirmed
+	if apptType.RequiresApproval {
+		a.Status = StatusRequested
+	}
+	a.fillLegacyTimes()
+	return nil
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"petclinic/db"
+	"petclinic/utils"
+	"time"
+)
+
+// FeedPastDays is how far back a calendar feed reaches; later appointments are always included
+const FeedPastDays = 30
+
+// FeedEvent is an appointment as it appears in a calendar feed
+type FeedEvent struct {
+	Appointment
+	PetName   string
+	TypeName  string
+	Cancelled bool // cancelled, or deleted along with the appointment or its pet
+}
+
+func hashFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueFeedToken creates a new secret calendar feed token for the user, replacing any earlier one
+func IssueFeedToken(userID int) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	_, err := db.DB.Exec(
+		`INSERT INTO calendar_feed_tokens (user_id, token_hash) VALUES ($1, $2)
+         ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = now()`,
+		userID, hashFeedToken(token))
+	if err != nil {
+		utils.Error("IssueFeedToken DB error: %v", err)
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeFeedToken disables the user's calendar feed
+func RevokeFeedToken(userID int) error {
+	_, err := db.DB.Exec("DELETE FROM calendar_feed_tokens WHERE user_id=$1", userID)
+	if err != nil {
+		utils.Error("RevokeFeedToken DB error: %v", err)
+	}
+	return err
+}
+
+// GetUserByFeedToken returns the user a calendar feed token belongs to, or nil if it is unknown or revoked
+func GetUserByFeedToken(token string) (*User, error) {
+	var u User
+	err := db.DB.QueryRow(
+		`SELECT u.id, u.email, u.role FROM calendar_feed_tokens t JOIN users u ON u.id = t.user_id WHERE t.token_hash=$1`,
+		hashFeedToken(token)).Scan(&u.ID, &u.Email, &u.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		utils.Error("GetUserByFeedToken DB error: %v", err)
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ListFeedEvents returns the appointments for a calendar feed from FeedPastDays ago on, for one owner's pets
+// or, with ownerID 0, for every pet. Cancelled and deleted appointments are included so calendars drop them.
+func ListFeedEvents(ownerID int) ([]FeedEvent, error) {
+	events := []FeedEvent{}
+	var where whereBuilder
+	where.add("a.starts_at >= ?", time.Now().AddDate(0, 0, -FeedPastDays))
+	if ownerID != 0 {
+		where.add("p.owner_id = ?", ownerID)
+	}
+	rows, err := db.DB.Query(
+		`SELECT a.id, a.starts_at, a.ends_at, COALESCE(a.appointment_type_id, 0), COALESCE(a.vet_id, 0), a.room,
+                a.pet_id, a.reason, a.status, COALESCE(p.owner_id, 0), a.version, p.name, COALESCE(t.name, ''),
+                a.deleted_at IS NOT NULL OR p.deleted_at IS NOT NULL
+         FROM appointments a JOIN pets p ON p.id = a.pet_id
+         LEFT JOIN appointment_types t ON t.id = a.appointment_type_id`+where.String()+` ORDER BY a.starts_at, a.id`,
+		where.args...)
+	if err != nil {
+		utils.Error("Failed to fetch calendar feed appointments: %v", err)
+		return events, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e FeedEvent
+		a := &e.Appointment
+		err := rows.Scan(&a.ID, &a.StartsAt, &a.EndsAt, &a.TypeID, &a.VetID, &a.Room, &a.PetID, &a.Reason, &a.Status,
+			&a.OwnerID, &a.Version, &e.PetName, &e.TypeName, &e.Cancelled)
+		if err != nil {
+			utils.Warn("Failed to scan calendar feed row: %v", err)
+			continue
+		}
+		a.fillLegacyTimes()
+		e.Cancelled = e.Cancelled || a.Status == StatusCancelled
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListFeedEvents: %v", err)
+	}
+	return events, err
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"database/sql"
+	"petclinic/db"
+	"petclinic/utils"
+	"regexp"
+)
+
+// ContactPreferences say how, and in which language, an owner wants to be reminded of appointments
+type ContactPreferences struct {
+	OwnerID int    `json:"owner_id"`
+	Email   bool   `json:"email"` // to the owner's email address
+	SMS     bool   `json:"sms"`
+	Phone   string `json:"phone"`  // mobile number for SMS, in E.164 form such as +447700900123
+	Locale  string `json:"locale"` // language to write in, such as "fr" or "pt-BR"; empty for the clinic's default
+}
+
+// e164 matches an international phone number such as +447700900123
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Validate checks that SMS reminders have a number to go to
+func (p ContactPreferences) Validate() error {
+	var v ValidationError
+	if p.Phone != "" {
+		v.check(e164.MatchString(p.Phone), "phone", "must be in international form such as +447700900123")
+	}
+	v.check(!p.SMS || p.Phone != "", "phone", "is required for SMS reminders")
+	v.check(p.Locale == "" || localePattern.MatchString(p.Locale), "locale", "must be a language tag such as en or pt-BR")
+	return v.err()
+}
+
+// GetContactPreferences returns the owner's preferences, or the defaults (email only) if they have set none
+func GetContactPreferences(ownerID int) (ContactPreferences, error) {
+	p := ContactPreferences{OwnerID: ownerID, Email: true}
+	err := db.DB.QueryRow("SELECT email, sms, phone, locale FROM owner_contact_preferences WHERE owner_id=$1", ownerID).
+		Scan(&p.Email, &p.SMS, &p.Phone, &p.Locale)
+	if err == sql.ErrNoRows {
+		return p, nil
+	}
+	if err != nil {
+		utils.Error("GetContactPreferences DB error: %v", err)
+	}
+	return p, err
+}
+
+// SaveContactPreferences stores the owner's preferences, replacing any earlier ones
+func SaveContactPreferences(p ContactPreferences) error {
+	_, err := db.DB.Exec(
+		`INSERT INTO owner_contact_preferences (owner_id, email, sms, phone, locale) VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT (owner_id) DO UPDATE SET email = EXCLUDED.email, sms = EXCLUDED.sms, phone = EXCLUDED.phone,
+                                              locale = EXCLUDED.locale`,
+		p.OwnerID, p.Email, p.SMS, p.Phone, p.Locale)
+	if err != nil {
+		utils.Error("SaveContactPreferences DB error: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// ErrVersionConflict is returned when a row changed (or vanished) since the caller read the version it passed in
+var ErrVersionConflict = errors.New("resource was modified by another request")
+
+// versionConflict turns "no row matched id and version" into ErrVersionConflict
+func versionConflict(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrVersionConflict
+	}
+	return err
+}
+
+// expectOneRow returns ErrVersionConflict if a versioned write did not touch exactly one row
+func expectOneRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is a Postgres unique violation on the named constraint or index
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+// isForeignKeyViolation reports whether err is a Postgres foreign key violation
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// isExclusionViolation reports whether err is a Postgres exclusion constraint violation
+func isExclusionViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23P01"
+}
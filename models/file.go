@@ -0,0 +1,71 @@
+package models
+
+import (
+	"database/sql"
+	"os"
+	"petclinic/db"
+	"petclinic/utils"
+	"time"
+)
+
+// File is an uploaded document, optionally linked to an owner and/or pet
+type File struct {
+	ID         int       `json:"id"`
+	Filename   string    `json:"filename"`
+	Path       string    `json:"path"`
+	OwnerID    int       `json:"owner_id,omitempty"`
+	PetID      int       `json:"pet_id,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// nullID maps the zero ID onto SQL NULL for optional foreign keys
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// AddFile records an uploaded file and returns it with its ID and upload time
+func AddFile(f File) (File, error) {
+	err := db.DB.QueryRow("INSERT INTO files (filename, path, owner_id, pet_id) VALUES ($1, $2, $3, $4) RETURNING id, uploaded_at",
+		f.Filename, f.Path, nullID(f.OwnerID), nullID(f.PetID)).
+		Scan(&f.ID, &f.UploadedAt)
+	if err != nil {
+		utils.Error("AddFile DB error: %v", err)
+	}
+	return f, err
+}
+
+// GetFileByPath returns the most recent live file stored at path, or nil if none is recorded
+func GetFileByPath(path string) (*File, error) {
+	var f File
+	var ownerID, petID sql.NullInt64
+	err := db.DB.QueryRow(
+		`SELECT id, filename, path, owner_id, pet_id, uploaded_at FROM files
+         WHERE path=$1 AND deleted_at IS NULL ORDER BY uploaded_at DESC, id DESC LIMIT 1`, path).
+		Scan(&f.ID, &f.Filename, &f.Path, &ownerID, &petID, &f.UploadedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		utils.Error("GetFileByPath DB error: %v", err)
+		return nil, err
+	}
+	f.OwnerID, f.PetID = int(ownerID.Int64), int(petID.Int64)
+	return &f, nil
+}
+
+// removeStoredFiles deletes purged uploads from disk, unless another file record still points at the same path
+func removeStoredFiles(paths []string) {
+	for _, path := range paths {
+		var referenced bool
+		if err := db.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM files WHERE path=$1)", path).Scan(&referenced); err != nil {
+			utils.Error("Failed to check references to %s: %v", path, err)
+			continue
+		}
+		if referenced {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			utils.Error("Failed to remove purged file %s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"database/sql"
+	"petclinic/db"
+	"petclinic/utils"
+)
+
+// Intake is a new client registration: an owner, their first pet and optionally a first appointment
+type Intake struct {
+	Owner       Owner        `json:"owner"`
+	Pet         Pet          `json:"pet"`
+	Appointment *Appointment `json:"appointment,omitempty"`
+}
+
+// CreateIntake stores the owner, pet and appointment together, linking each to the one before.
+// Either everything is created or nothing is; validation failures return a *ValidationError.
+func CreateIntake(in Intake) (Intake, error) {
+	err := db.WithTx(func(tx *sql.Tx) error {
+		if err := in.Owner.Validate(); err != nil {
+			return prefixFields(err, "owner.")
+		}
+		owner, err := AddOwnerTx(tx, in.Owner)
+		if err != nil {
+			return err
+		}
+		in.Owner = owner
+
+		in.Pet.OwnerID = owner.ID
+		if err := in.Pet.Validate(); err != nil {
+			return prefixFields(err, "pet.")
+		}
+		pet, err := AddPetTx(tx, in.Pet)
+		if err != nil {
+			return err
+		}
+		in.Pet = pet
+
+		if in.Appointment == nil {
+			return nil
+		}
+		// A first appointment is booked like any other staff booking: confirmed, and not part of a series
+		in.Appointment.PetID = pet.ID
+		in.Appointment.Status = StatusConfirmed
+		in.Appointment.SeriesID = 0
+		if err := FillDuration(in.Appointment); err != nil {
+			return prefixFields(err, "appointment.")
+		}
+		if err := in.Appointment.ResolveTimes(nil); err != nil {
+			return prefixFields(err, "appointment.")
+		}
+		if err := in.Appointment.Validate(); err != nil {
+			return prefixFields(err, "appointment.")
+		}
+		apt, err := AddAppointmentTx(tx, *in.Appointment)
+		if err != nil {
+			return err
+		}
+		in.Appointment = &apt
+		return nil
+	})
+	if err != nil {
+		utils.Warn("CreateIntake rolled back: %v", err)
+	}
+	return in, err
+}
@@ -0,0 +1,499 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"petclinic/db"
+	"petclinic/utils"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Invoice statuses
+const (
+	InvoiceDraft  = "draft"  // still being put together; owners cannot see it
+	InvoiceIssued = "issued" // numbered and sent to the owner; no longer editable
+	InvoicePaid   = "paid"
+	InvoiceVoid   = "void" // cancelled after issue; keeps its number
+)
+
+// Invoice line kinds
+const (
+	LineService    = "service"
+	LineMedication = "medication"
+	LineDiscount   = "discount" // its amount is taken off the total
+	LineOther      = "other"
+)
+
+// InvoicePrefix starts every invoice number, as in INV-2026-00042
+var InvoicePrefix = "INV"
+
+// InvoiceDueDays is how long after issue an invoice falls due
+var InvoiceDueDays = 30
+
+// InvoiceTaxRate is the tax rate, in percent, of the lines filled in when invoicing an appointment
+var InvoiceTaxRate float64
+
+var (
+	// ErrInvoiceNotDraft is returned when changing an invoice that has been issued
+	ErrInvoiceNotDraft = errors.New("invoice has been issued and can no longer be changed")
+	// ErrInvoiceNotIssued is returned when paying or voiding an invoice that is not awaiting payment
+	ErrInvoiceNotIssued = errors.New("only issued invoices can be paid or voided")
+	// ErrAppointmentInvoiced is returned when an appointment already has an invoice that is not void
+	ErrAppointmentInvoiced = errors.New("appointment already has an invoice")
+)
+
+// InvoiceLine is one charge or discount on an invoice. Amounts are in minor units (cents).
+type InvoiceLine struct {
+	ID             int     `json:"id"`
+	Kind           string  `json:"kind"`
+	Description    string  `json:"description"`
+	Quantity       int     `json:"quantity"`
+	UnitPriceCents int64   `json:"unit_price_cents"`
+	TaxRate        float64 `json:"tax_rate"` // percent, e.g. 20 for 20%
+	PrescriptionID int     `json:"prescription_id,omitempty"`
+
+	// Read-only, worked out from the above
+	NetCents   int64 `json:"net_cents"` // quantity × unit price, negative for discounts
+	TaxCents   int64 `json:"tax_cents"`
+	TotalCents int64 `json:"total_cents"`
+}
+
+// Invoice bills an owner, optionally for one appointment
+type Invoice struct {
+	ID               int           `json:"id"`
+	Number           string        `json:"number,omitempty"` // given when issued
+	OwnerID          int           `json:"owner_id"`
+	AppointmentID    int           `json:"appointment_id,omitempty"`
+	Status           string        `json:"status"`
+	Notes            string        `json:"notes"`
+	Lines            []InvoiceLine `json:"lines"`
+	IssuedOn         *time.Time    `json:"issued_on,omitempty"`
+	DueOn            *time.Time    `json:"due_on,omitempty"`
+	PaidAt           *time.Time    `json:"paid_at,omitempty"`
+	PaymentMethod    string        `json:"payment_method,omitempty"`
+	PaymentReference string        `json:"payment_reference,omitempty"`
+	VoidedAt         *time.Time    `json:"voided_at,omitempty"`
+	VoidReason       string        `json:"void_reason,omitempty"`
+	CreatedBy        int           `json:"created_by,omitempty"`
+	CreatedAt        time.Time     `json:"created_at"`
+	Version          int           `json:"version"` // incremented on every change, exposed as the ETag
+
+	// Read-only totals
+	SubtotalCents int64 `json:"subtotal_cents"` // charges before discounts and tax
+	DiscountCents int64 `json:"discount_cents"`
+	TaxCents      int64 `json:"tax_cents"`
+	TotalCents    int64 `json:"total_cents"`
+}
+
+// computeTotals works out each line's amounts and the invoice totals. Tax is charged per line, rounded
+// to the nearest cent, and discounts reduce the tax of their rate.
+func (inv *Invoice) computeTotals() {
+	inv.SubtotalCents, inv.DiscountCents, inv.TaxCents, inv.TotalCents = 0, 0, 0, 0
+	for i := range inv.Lines {
+		l := &inv.Lines[i]
+		l.NetCents = int64(l.Quantity) * l.UnitPriceCents
+		if l.Kind == LineDiscount {
+			l.NetCents = -l.NetCents
+			inv.DiscountCents -= l.NetCents
+		} else {
+			inv.SubtotalCents += l.NetCents
+		}
+		l.TaxCents = int64(math.Round(float64(l.NetCents) * l.TaxRate / 100))
+		l.TotalCents = l.NetCents + l.TaxCents
+		inv.TaxCents += l.TaxCents
+		inv.TotalCents += l.TotalCents
+	}
+}
+
+// Validate checks the owner and every line, and that discounts do not exceed the charges
+func (inv Invoice) Validate() error {
+	var v ValidationError
+	v.check(inv.OwnerID > 0, "owner_id", "is required")
+	for i, l := range inv.Lines {
+		field := fmt.Sprintf("lines[%d].", i)
+		v.check(l.Kind == LineService || l.Kind == LineMedication || l.Kind == LineDiscount || l.Kind == LineOther,
+			field+"kind", "must be service, medication, discount or other")
+		v.check(strings.TrimSpace(l.Description) != "", field+"description", "is required")
+		v.check(l.Quantity > 0, field+"quantity", "must be positive")
+		v.check(l.UnitPriceCents >= 0, field+"unit_price_cents", "must not be negative")
+		v.check(l.TaxRate >= 0 && l.TaxRate <= 100, field+"tax_rate", "must be between 0 and 100")
+	}
+	inv.computeTotals()
+	v.check(inv.TotalCents >= 0, "lines", "discounts must not exceed the charges")
+	return v.err()
+}
+
+// InvoiceFilter narrows ListInvoices; zero values are ignored
+type InvoiceFilter struct {
+	OwnerID       int
+	AppointmentID int
+	Status        string
+	ExcludeDrafts bool // what owners see
+}
+
+var invoiceSortColumns = map[string]string{
+	"number":     "number",
+	"created_at": "created_at",
+	"issued_on":  "issued_on",
+	"due_on":     "due_on",
+}
+
+const invoiceColumns = `SELECT id, COALESCE(number, ''), owner_id, COALESCE(appointment_id, 0), status, notes,
+                issued_on, due_on, paid_at, payment_method, payment_reference, voided_at, void_reason,
+                COALESCE(created_by, 0), created_at, version
+         FROM invoices`
+
+func scanInvoice(row interface{ Scan(...interface{}) error }) (Invoice, error) {
+	var inv Invoice
+	var issuedOn, dueOn, paidAt, voidedAt sql.NullTime
+	err := row.Scan(&inv.ID, &inv.Number, &inv.OwnerID, &inv.AppointmentID, &inv.Status, &inv.Notes,
+		&issuedOn, &dueOn, &paidAt, &inv.PaymentMethod, &inv.PaymentReference, &voidedAt, &inv.VoidReason,
+		&inv.CreatedBy, &inv.CreatedAt, &inv.Version)
+	for _, t := range []struct {
+		src sql.NullTime
+		dst **time.Time
+	}{{issuedOn, &inv.IssuedOn}, {dueOn, &inv.DueOn}, {paidAt, &inv.PaidAt}, {voidedAt, &inv.VoidedAt}} {
+		if t.src.Valid {
+			v := t.src.Time
+			*t.dst = &v
+		}
+	}
+	inv.Lines = []InvoiceLine{}
+	return inv, err
+}
+
+// attachInvoiceLines loads the lines of the invoices and works out their totals
+func attachInvoiceLines(invoices []Invoice) error {
+	if len(invoices) == 0 {
+		return nil
+	}
+	index := map[int]int{}
+	ids := make([]int64, len(invoices))
+	for i, inv := range invoices {
+		index[inv.ID] = i
+		ids[i] = int64(inv.ID)
+	}
+
+	rows, err := db.DB.Query(
+		`SELECT invoice_id, id, kind, description, quantity, unit_price_cents, tax_rate, COALESCE(prescription_id, 0)
+         FROM invoice_lines WHERE invoice_id = ANY($1) ORDER BY invoice_id, position`, pq.Array(ids))
+	if err != nil {
+		utils.Error("Failed to fetch invoice lines: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var invoiceID int
+		var l InvoiceLine
+		err := rows.Scan(&invoiceID, &l.ID, &l.Kind, &l.Description, &l.Quantity, &l.UnitPriceCents, &l.TaxRate, &l.PrescriptionID)
+		if err != nil {
+			utils.Warn("Failed to scan invoice line row: %v", err)
+			continue
+		}
+		inv := &invoices[index[invoiceID]]
+		inv.Lines = append(inv.Lines, l)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in attachInvoiceLines: %v", err)
+		return err
+	}
+	for i := range invoices {
+		invoices[i].computeTotals()
+	}
+	return nil
+}
+
+// ListInvoices returns one page of invoices matching the filter, newest first by default
+func ListInvoices(f InvoiceFilter, opts ListOptions) (Page[Invoice], error) {
+	opts = opts.normalize()
+	page := Page[Invoice]{Items: []Invoice{}, Limit: opts.Limit, Offset: opts.Offset}
+	order, err := opts.orderBy(invoiceSortColumns, "id", "-created_at")
+	if err != nil {
+		return page, err
+	}
+
+	var where whereBuilder
+	if f.OwnerID != 0 {
+		where.add("owner_id = ?", f.OwnerID)
+	}
+	if f.AppointmentID != 0 {
+		where.add("appointment_id = ?", f.AppointmentID)
+	}
+	if f.Status != "" {
+		where.add("status = ?", f.Status)
+	}
+	if f.ExcludeDrafts {
+		where.addExpr("status <> 'draft'")
+	}
+
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM invoices"+where.String(), where.args...).Scan(&page.Total)
+	if err != nil {
+		utils.Error("Failed to count invoices: %v", err)
+		return page, err
+	}
+
+	limit, args := where.limitOffset(opts)
+	rows, err := db.DB.Query(invoiceColumns+where.String()+order+limit, args...)
+	if err != nil {
+		utils.Error("Failed to fetch invoices: %v", err)
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			utils.Warn("Failed to scan invoice row: %v", err)
+			continue
+		}
+		page.Items = append(page.Items, inv)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListInvoices: %v", err)
+		return page, err
+	}
+	return page, attachInvoiceLines(page.Items)
+}
+
+// GetInvoice returns the invoice with its lines, or nil if there is none
+func GetInvoice(id int) (*Invoice, error) {
+	inv, err := scanInvoice(db.DB.QueryRow(invoiceColumns+" WHERE id=$1", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		utils.Error("GetInvoice DB error: %v", err)
+		return nil, err
+	}
+	invoices := []Invoice{inv}
+	if err := attachInvoiceLines(invoices); err != nil {
+		return nil, err
+	}
+	return &invoices[0], nil
+}
+
+// insertInvoiceLines stores the lines of an invoice in order
+func insertInvoiceLines(tx *sql.Tx, invoiceID int, lines []InvoiceLine) error {
+	for i, l := range lines {
+		_, err := tx.Exec(
+			`INSERT INTO invoice_lines (invoice_id, position, kind, description, quantity, unit_price_cents, tax_rate, prescription_id)
+             VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			invoiceID, i+1, l.Kind, l.Description, l.Quantity, l.UnitPriceCents, l.TaxRate, nullID(l.PrescriptionID))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddInvoice stores a new draft invoice with its lines. Returns ErrAppointmentInvoiced if the appointment
+// already has an invoice that is not void.
+func AddInvoice(inv Invoice, createdBy int) (*Invoice, error) {
+	var id int
+	err := db.WithTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			`INSERT INTO invoices (owner_id, appointment_id, notes, created_by) VALUES ($1, $2, $3, $4) RETURNING id`,
+			inv.OwnerID, nullID(inv.AppointmentID), inv.Notes, createdBy).Scan(&id)
+		if err != nil {
+			return err
+		}
+		return insertInvoiceLines(tx, id, inv.Lines)
+	})
+	if isUniqueViolation(err, "invoices_appointment_idx") {
+		return nil, ErrAppointmentInvoiced
+	}
+	if err != nil {
+		utils.Error("AddInvoice DB error: %v", err)
+		return nil, err
+	}
+	return GetInvoice(id)
+}
+
+// UpdateInvoice replaces a draft's owner, appointment, notes and lines if it is still at inv.Version.
+// Returns ErrVersionConflict if it changed or was issued in the meantime.
+func UpdateInvoice(inv Invoice) (*Invoice, error) {
+	err := db.WithTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			`UPDATE invoices SET owner_id=$1, appointment_id=$2, notes=$3, version=version+1
+             WHERE id=$4 AND version=$5 AND status='draft' RETURNING version`,
+			inv.OwnerID, nullID(inv.AppointmentID), inv.Notes, inv.ID, inv.Version).Scan(&inv.Version)
+		if err != nil {
+			return versionConflict(err)
+		}
+		if _, err := tx.Exec("DELETE FROM invoice_lines WHERE invoice_id=$1", inv.ID); err != nil {
+			return err
+		}
+		return insertInvoiceLines(tx, inv.ID, inv.Lines)
+	})
+	if isUniqueViolation(err, "invoices_appointment_idx") {
+		return nil, ErrAppointmentInvoiced
+	}
+	if err != nil {
+		utils.Error("UpdateInvoice DB error: %v", err)
+		return nil, err
+	}
+	return GetInvoice(inv.ID)
+}
+
+// DeleteInvoice removes a draft if it is still at the given version, otherwise returns ErrVersionConflict.
+// Issued invoices are voided instead, so their numbers stay accounted for.
+func DeleteInvoice(id, version int) error {
+	res, err := db.DB.Exec("DELETE FROM invoices WHERE id=$1 AND version=$2 AND status='draft'", id, version)
+	if err != nil {
+		utils.Error("DeleteInvoice DB error: %v", err)
+		return err
+	}
+	return expectOneRow(res)
+}
+
+// changeInvoiceStatus locks the invoice and runs update if it is in status from, returning errWrongStatus otherwise
+func changeInvoiceStatus(id int, from string, errWrongStatus error, update func(tx *sql.Tx) error) (*Invoice, error) {
+	err := db.WithTx(func(tx *sql.Tx) error {
+		var status string
+		err := tx.QueryRow("SELECT status FROM invoices WHERE id=$1 FOR UPDATE", id).Scan(&status)
+		if err != nil {
+			return versionConflict(err)
+		}
+		if status != from {
+			return errWrongStatus
+		}
+		return update(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetInvoice(id)
+}
+
+// IssueInvoice gives a draft the next number of the year and makes it due InvoiceDueDays from today.
+// Numbers are handed out inside the transaction, so they run without gaps.
+func IssueInvoice(id int) (*Invoice, error) {
+	inv, err := changeInvoiceStatus(id, InvoiceDraft, ErrInvoiceNotDraft, func(tx *sql.Tx) error {
+		var lines int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM invoice_lines WHERE invoice_id=$1", id).Scan(&lines); err != nil {
+			return err
+		}
+		if lines == 0 {
+			return &ValidationError{Fields: map[string]string{"lines": "an invoice needs at least one line to be issued"}}
+		}
+		if err := checkLinesPriced(tx, id); err != nil {
+			return err
+		}
+
+		today := clinicDay(time.Now().In(ClinicLocation))
+		var n int
+		err := tx.QueryRow(
+			`INSERT INTO invoice_counters (year, last) VALUES ($1, 1)
+             ON CONFLICT (year) DO UPDATE SET last = invoice_counters.last + 1 RETURNING last`, today.Year()).Scan(&n)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			`UPDATE invoices SET status='issued', number=$2, issued_on=$3, due_on=$4, version=version+1 WHERE id=$1`,
+			id, fmt.Sprintf("%s-%d-%05d", InvoicePrefix, today.Year(), n),
+			today.Format("2006-01-02"), today.AddDate(0, 0, InvoiceDueDays).Format("2006-01-02"))
+		return err
+	})
+	if err != nil {
+		utils.Error("IssueInvoice DB error: %v", err)
+	}
+	return inv, err
+}
+
+// checkLinesPriced refuses to issue an invoice while any charge is still at zero, such as a medication line
+// drafted from a prescription that staff have not priced yet. Free items are charged and then discounted.
+func checkLinesPriced(tx *sql.Tx, id int) error {
+	rows, err := tx.Query(
+		`SELECT position FROM invoice_lines WHERE invoice_id=$1 AND kind <> 'discount' AND unit_price_cents = 0 ORDER BY position`, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var v ValidationError
+	for rows.Next() {
+		var position int
+		if err := rows.Scan(&position); err != nil {
+			return err
+		}
+		v.check(false, fmt.Sprintf("lines[%d].unit_price_cents", position-1),
+			"must be priced before the invoice is issued; take free items off with a discount line")
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return v.err()
+}
+
+// PayInvoice records payment of an issued invoice
+func PayInvoice(id int, method, reference string) (*Invoice, error) {
+	inv, err := changeInvoiceStatus(id, InvoiceIssued, ErrInvoiceNotIssued, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`UPDATE invoices SET status='paid', paid_at=now(), payment_method=$2, payment_reference=$3, version=version+1 WHERE id=$1`,
+			id, method, reference)
+		return err
+	})
+	if err != nil {
+		utils.Error("PayInvoice DB error: %v", err)
+	}
+	return inv, err
+}
+
+// VoidInvoice cancels an issued invoice that will not be paid. It keeps its number.
+func VoidInvoice(id int, reason string) (*Invoice, error) {
+	inv, err := changeInvoiceStatus(id, InvoiceIssued, ErrInvoiceNotIssued, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE invoices SET status='void', voided_at=now(), void_reason=$2, version=version+1 WHERE id=$1`, id, reason)
+		return err
+	})
+	if err != nil {
+		utils.Error("VoidInvoice DB error: %v", err)
+	}
+	return inv, err
+}
+
+// InvoiceForAppointment drafts an invoice for an appointment: a service line for its type at the type's
+// price, and a medication line for each prescription written during it, priced for staff to fill in
+func InvoiceForAppointment(a Appointment) (Invoice, error) {
+	inv := Invoice{OwnerID: a.OwnerID, AppointmentID: a.ID, Lines: []InvoiceLine{}}
+	service := InvoiceLine{Kind: LineService, Description: a.Reason, Quantity: 1, TaxRate: InvoiceTaxRate}
+	if a.TypeID != 0 {
+		t, err := GetAppointmentTypeByID(a.TypeID)
+		if err != nil {
+			return inv, err
+		}
+		if t != nil {
+			service.Description = t.Name
+			service.UnitPriceCents = t.PriceCents
+		}
+	}
+	if strings.TrimSpace(service.Description) == "" {
+		service.Description = "Consultation"
+	}
+	inv.Lines = append(inv.Lines, service)
+
+	rows, err := db.DB.Query("SELECT id, drug, dose FROM prescriptions WHERE appointment_id=$1 ORDER BY id", a.ID)
+	if err != nil {
+		utils.Error("Failed to fetch appointment prescriptions: %v", err)
+		return inv, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var drug, dose string
+		if err := rows.Scan(&id, &drug, &dose); err != nil {
+			utils.Warn("Failed to scan prescription row: %v", err)
+			continue
+		}
+		inv.Lines = append(inv.Lines, InvoiceLine{Kind: LineMedication, Description: drug + " " + dose, Quantity: 1,
+			TaxRate: InvoiceTaxRate, PrescriptionID: id})
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in InvoiceForAppointment: %v", err)
+	}
+	return inv, err
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInvoiceTotals(t *testing.T) {
+	service := func(qty int, cents int64, rate float64) InvoiceLine {
+		return InvoiceLine{Kind: LineService, Description: "Consultation", Quantity: qty, UnitPriceCents: cents, TaxRate: rate}
+	}
+	discount := func(cents int64, rate float64) InvoiceLine {
+		return InvoiceLine{Kind: LineDiscount, Description: "Discount", Quantity: 1, UnitPriceCents: cents, TaxRate: rate}
+	}
+	tests := []struct {
+		name                           string
+		lines                          []InvoiceLine
+		subtotal, discount, tax, total int64
+		valid                          bool
+	}{
+		{"no lines", nil, 0, 0, 0, 0, true},
+		{"quantity and tax", []InvoiceLine{service(2, 1000, 20)}, 2000, 0, 400, 2400, true},
+		{"tax rounds half away from zero", []InvoiceLine{service(1, 1025, 10)}, 1025, 0, 103, 1128, true},
+		{"tax rounds down", []InvoiceLine{service(1, 1024, 10)}, 1024, 0, 102, 1126, true},
+		{"tax rounded per line", []InvoiceLine{service(1, 333, 5), service(1, 333, 5), service(1, 333, 5)}, 999, 0, 51, 1050, true},
+		{"discount takes its tax off", []InvoiceLine{service(1, 5000, 20), discount(1000, 20)}, 5000, 1000, 800, 4800, true},
+		{"discount tax rounds away from zero", []InvoiceLine{service(1, 2000, 10), discount(1025, 10)}, 2000, 1025, 97, 1072, true},
+		{"discount equal to the charges", []InvoiceLine{service(1, 1000, 0), discount(1000, 0)}, 1000, 1000, 0, 0, true},
+		{"negative total", []InvoiceLine{service(1, 1000, 0), discount(1500, 0)}, 1000, 1500, 0, -500, false},
+		{"negative total from tax", []InvoiceLine{service(1, 1000, 0), discount(1000, 20)}, 1000, 1000, -200, -200, false},
+	}
+	for _, tt := range tests {
+		inv := Invoice{OwnerID: 1, Lines: tt.lines}
+		inv.computeTotals()
+		if inv.SubtotalCents != tt.subtotal || inv.DiscountCents != tt.discount || inv.TaxCents != tt.tax || inv.TotalCents != tt.total {
+			t.Errorf("%s: subtotal, discount, tax, total = %d, %d, %d, %d; want %d, %d, %d, %d", tt.name,
+				inv.SubtotalCents, inv.DiscountCents, inv.TaxCents, inv.TotalCents, tt.subtotal, tt.discount, tt.tax, tt.total)
+		}
+		var sum int64
+		for _, l := range inv.Lines {
+			if l.TotalCents != l.NetCents+l.TaxCents {
+				t.Errorf("%s: line %q total %d is not net %d plus tax %d", tt.name, l.Description, l.TotalCents, l.NetCents, l.TaxCents)
+			}
+			sum += l.TotalCents
+		}
+		if sum != inv.TotalCents {
+			t.Errorf("%s: lines add up to %d, invoice total is %d", tt.name, sum, inv.TotalCents)
+		}
+
+		err := inv.Validate()
+		var verr *ValidationError
+		switch {
+		case tt.valid && err != nil:
+			t.Errorf("%s: Validate() = %v; want nil", tt.name, err)
+		case !tt.valid && (!errors.As(err, &verr) || verr.Fields["lines"] == ""):
+			t.Errorf("%s: Validate() = %v; want an error on lines", tt.name, err)
+		}
+	}
+}
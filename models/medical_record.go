@@ -0,0 +1,130 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"petclinic/db"
+	"petclinic/utils"
+	"strings"
+	"time"
+)
+
+// MedicalRecord is one append-only SOAP entry in a pet's medical record.
+// Corrections never change an entry; they add a new one whose AmendsID points at it.
+type MedicalRecord struct {
+	ID            int       `json:"id"`
+	PetID         int       `json:"pet_id"`
+	AppointmentID int       `json:"appointment_id,omitempty"`
+	AuthorID      int       `json:"author_id"`
+	Subjective    string    `json:"subjective"`
+	Objective     string    `json:"objective"`
+	Assessment    string    `json:"assessment"`
+	Plan          string    `json:"plan"`
+	AmendsID      int       `json:"amends_id,omitempty"`
+	SupersededBy  int       `json:"superseded_by,omitempty"` // ID of the amendment that replaced this entry
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ErrAlreadyAmended is returned when amending an entry that has already been superseded
+var ErrAlreadyAmended = errors.New("entry has already been amended; amend the latest version instead")
+
+// Validate checks that the entry has some clinical content
+func (m MedicalRecord) Validate() error {
+	var v ValidationError
+	empty := strings.TrimSpace(m.Subjective+m.Objective+m.Assessment+m.Plan) == ""
+	v.check(!empty, "subjective", "at least one of subjective, objective, assessment or plan is required")
+	v.check(m.PetID > 0, "pet_id", "is required")
+	return v.err()
+}
+
+const medicalRecordColumns = `SELECT m.id, m.pet_id, COALESCE(m.appointment_id, 0), COALESCE(m.author_id, 0),
+                m.subjective, m.objective, m.assessment, m.plan, COALESCE(m.amends_id, 0),
+                COALESCE((SELECT s.id FROM medical_records s WHERE s.amends_id = m.id), 0), m.created_at
+         FROM medical_records m`
+
+func scanMedicalRecord(row interface{ Scan(...interface{}) error }) (MedicalRecord, error) {
+	var m MedicalRecord
+	err := row.Scan(&m.ID, &m.PetID, &m.AppointmentID, &m.AuthorID, &m.Subjective, &m.Objective,
+		&m.Assessment, &m.Plan, &m.AmendsID, &m.SupersededBy, &m.CreatedAt)
+	return m, err
+}
+
+var medicalRecordSortColumns = map[string]string{
+	"id":         "m.id",
+	"created_at": "m.created_at",
+}
+
+// ListMedicalRecords returns one page of a pet's record entries, newest first by default.
+// If currentOnly is set, entries that have been amended are left out.
+func ListMedicalRecords(petID int, currentOnly bool, opts ListOptions) (Page[MedicalRecord], error) {
+	opts = opts.normalize()
+	page := Page[MedicalRecord]{Items: []MedicalRecord{}, Limit: opts.Limit, Offset: opts.Offset}
+	order, err := opts.orderBy(medicalRecordSortColumns, "m.id", "-created_at")
+	if err != nil {
+		return page, err
+	}
+
+	var where whereBuilder
+	where.add("m.pet_id = ?", petID)
+	if currentOnly {
+		where.addExpr("NOT EXISTS (SELECT 1 FROM medical_records s WHERE s.amends_id = m.id)")
+	}
+
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM medical_records m"+where.String(), where.args...).Scan(&page.Total)
+	if err != nil {
+		utils.Error("Failed to count medical records: %v", err)
+		return page, err
+	}
+
+	limit, args := where.limitOffset(opts)
+	rows, err := db.DB.Query(medicalRecordColumns+where.String()+order+limit, args...)
+	if err != nil {
+		utils.Error("Failed to fetch medical records: %v", err)
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanMedicalRecord(rows)
+		if err != nil {
+			utils.Warn("Failed to scan medical record row: %v", err)
+			continue
+		}
+		page.Items = append(page.Items, m)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListMedicalRecords: %v", err)
+	}
+	return page, err
+}
+
+// GetMedicalRecordByID returns the pet's record entry with the given ID, or nil if there is none
+func GetMedicalRecordByID(petID, id int) (*MedicalRecord, error) {
+	m, err := scanMedicalRecord(db.DB.QueryRow(medicalRecordColumns+" WHERE m.id=$1 AND m.pet_id=$2", id, petID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.Warn("No medical record %d found for pet %d", id, petID)
+			return nil, nil
+		}
+		utils.Error("GetMedicalRecordByID DB error: %v", err)
+		return nil, err
+	}
+	return &m, nil
+}
+
+// AddMedicalRecord appends an entry to a pet's record. If m.AmendsID is set the entry amends
+// that one, which must not already have been amended (ErrAlreadyAmended).
+func AddMedicalRecord(m MedicalRecord) (MedicalRecord, error) {
+	err := db.DB.QueryRow(
+		`INSERT INTO medical_records (pet_id, appointment_id, author_id, subjective, objective, assessment, plan, amends_id)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`,
+		m.PetID, nullID(m.AppointmentID), nullID(m.AuthorID), m.Subjective, m.Objective, m.Assessment, m.Plan, nullID(m.AmendsID)).
+		Scan(&m.ID, &m.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err, "medical_records_amends_id_idx") {
+			return m, ErrAlreadyAmended
+		}
+		utils.Error("AddMedicalRecord DB error: %v", err)
+	}
+	return m, err
+}
@@ -0,0 +1,242 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"petclinic/db"
+	"petclinic/notify"
+	"petclinic/utils"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// localePattern matches a language tag such as "en", "fr" or "pt-BR"
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// NotificationTemplate is one version of the wording of a kind of notification over a channel in a language.
+// Version 0 is the built-in wording, used until an admin saves a version of their own.
+type NotificationTemplate struct {
+	ID      int    `json:"id,omitempty"`
+	Kind    string `json:"kind"`
+	Channel string `json:"channel"`
+	Locale  string `json:"locale"`
+	Version int    `json:"version"`
+	notify.Template
+	RolledBackFrom *int       `json:"rolled_back_from,omitempty"` // the version this one restored
+	CreatedBy      *int       `json:"created_by,omitempty"`
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+}
+
+// Validate checks the template is for a known kind and channel and that it renders against sample data
+func (t NotificationTemplate) Validate() error {
+	var v ValidationError
+	_, known := notify.Default(t.Kind, t.Channel)
+	v.check(known, "kind", "must be a notification kind with templates for the channel")
+	v.check(localePattern.MatchString(t.Locale), "locale", "must be a language tag such as en or pt-BR")
+	v.check(strings.TrimSpace(t.Text) != "", "text", "is required")
+	if t.Channel == ChannelSMS {
+		v.check(t.Subject == "", "subject", "is not used by text messages")
+		v.check(t.HTML == "", "html", "is not used by text messages")
+	} else {
+		v.check(strings.TrimSpace(t.Subject) != "", "subject", "is required")
+	}
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	if _, err := t.Render("", notify.SampleData(t.Kind)); err != nil {
+		var terr *notify.TemplateError
+		if errors.As(err, &terr) {
+			v.check(false, terr.Field, terr.Err.Error())
+			return v.err()
+		}
+		return err
+	}
+	return nil
+}
+
+// builtinTemplate is version 0 of a kind, channel and locale
+func builtinTemplate(kind, channel, locale string) (NotificationTemplate, bool) {
+	t, ok := notify.Default(kind, channel)
+	return NotificationTemplate{Kind: kind, Channel: channel, Locale: locale, Template: t}, ok
+}
+
+const notificationTemplateColumns = `SELECT id, kind, channel, locale, version, subject, text_body, html_body,
+                rolled_back_from, created_by, created_at
+         FROM notification_templates`
+
+func scanNotificationTemplate(row interface{ Scan(...interface{}) error }, t *NotificationTemplate) error {
+	var rolledBackFrom, createdBy sql.NullInt64
+	var createdAt time.Time
+	err := row.Scan(&t.ID, &t.Kind, &t.Channel, &t.Locale, &t.Version, &t.Subject, &t.Text, &t.HTML,
+		&rolledBackFrom, &createdBy, &createdAt)
+	if rolledBackFrom.Valid {
+		v := int(rolledBackFrom.Int64)
+		t.RolledBackFrom = &v
+	}
+	if createdBy.Valid {
+		v := int(createdBy.Int64)
+		t.CreatedBy = &v
+	}
+	t.CreatedAt = &createdAt
+	return err
+}
+
+func queryNotificationTemplates(query string, args ...interface{}) ([]NotificationTemplate, error) {
+	templates := []NotificationTemplate{}
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		utils.Error("Failed to fetch notification templates: %v", err)
+		return templates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t NotificationTemplate
+		if err := scanNotificationTemplate(rows, &t); err != nil {
+			utils.Warn("Failed to scan notification template row: %v", err)
+			continue
+		}
+		templates = append(templates, t)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in queryNotificationTemplates: %v", err)
+	}
+	return templates, err
+}
+
+// ListNotificationTemplates returns the version in use of every template: those saved by admins in each
+// language, and the built-in wording for the default language where none has been saved
+func ListNotificationTemplates() ([]NotificationTemplate, error) {
+	saved, err := queryNotificationTemplates(
+		notificationTemplateColumns + ` t WHERE version = (SELECT max(version) FROM notification_templates
+                                                            WHERE kind = t.kind AND channel = t.channel AND locale = t.locale)
+         ORDER BY kind, channel, locale`)
+	if err != nil {
+		return saved, err
+	}
+
+	locale := utils.DefaultLocale()
+	var templates []NotificationTemplate
+	for _, kind := range notify.Kinds() {
+		for _, channel := range []string{ChannelEmail, ChannelSMS} {
+			found := false
+			for _, t := range saved {
+				if t.Kind == kind && t.Channel == channel && t.Locale == locale {
+					found = true
+				}
+			}
+			if builtin, ok := builtinTemplate(kind, channel, locale); ok && !found {
+				templates = append(templates, builtin)
+			}
+			for _, t := range saved {
+				if t.Kind == kind && t.Channel == channel {
+					templates = append(templates, t)
+				}
+			}
+		}
+	}
+	return templates, nil
+}
+
+// GetNotificationTemplate returns the version in use for exactly this kind, channel and locale: the latest
+// saved, or the built-in wording for the default language. Returns nil if there is neither.
+func GetNotificationTemplate(kind, channel, locale string) (*NotificationTemplate, error) {
+	var t NotificationTemplate
+	err := scanNotificationTemplate(db.DB.QueryRow(
+		notificationTemplateColumns+` WHERE kind=$1 AND channel=$2 AND locale=$3 ORDER BY version DESC LIMIT 1`,
+		kind, channel, locale), &t)
+	if err == sql.ErrNoRows {
+		if builtin, ok := builtinTemplate(kind, channel, locale); ok && locale == utils.DefaultLocale() {
+			return &builtin, nil
+		}
+		return nil, nil
+	}
+	if err != nil {
+		utils.Error("GetNotificationTemplate DB error: %v", err)
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListNotificationTemplateVersions returns every saved version for the kind, channel and locale, newest first
+func ListNotificationTemplateVersions(kind, channel, locale string) ([]NotificationTemplate, error) {
+	return queryNotificationTemplates(
+		notificationTemplateColumns+` WHERE kind=$1 AND channel=$2 AND locale=$3 ORDER BY version DESC`,
+		kind, channel, locale)
+}
+
+// GetNotificationTemplateVersion returns one version, the built-in wording for version 0, or nil if there is no such version
+func GetNotificationTemplateVersion(kind, channel, locale string, version int) (*NotificationTemplate, error) {
+	if version == 0 {
+		builtin, ok := builtinTemplate(kind, channel, locale)
+		if !ok {
+			return nil, nil
+		}
+		return &builtin, nil
+	}
+	var t NotificationTemplate
+	err := scanNotificationTemplate(db.DB.QueryRow(
+		notificationTemplateColumns+` WHERE kind=$1 AND channel=$2 AND locale=$3 AND version=$4`,
+		kind, channel, locale, version), &t)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		utils.Error("GetNotificationTemplateVersion DB error: %v", err)
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SaveNotificationTemplate adds t as the version after current, the version the caller edited. Returns
+// ErrVersionConflict if another version was saved in the meantime.
+func SaveNotificationTemplate(t NotificationTemplate, current, createdBy int) (*NotificationTemplate, error) {
+	var rolledBackFrom interface{}
+	if t.RolledBackFrom != nil {
+		rolledBackFrom = *t.RolledBackFrom
+	}
+	err := scanNotificationTemplate(db.DB.QueryRow(
+		`INSERT INTO notification_templates (kind, channel, locale, version, subject, text_body, html_body, rolled_back_from, created_by)
+         SELECT $1, $2, $3, $4 + 1, $5, $6, $7, $8, $9
+         WHERE COALESCE((SELECT max(version) FROM notification_templates WHERE kind=$1 AND channel=$2 AND locale=$3), 0) = $4
+         RETURNING id, kind, channel, locale, version, subject, text_body, html_body, rolled_back_from, created_by, created_at`,
+		t.Kind, t.Channel, t.Locale, current, t.Subject, t.Text, t.HTML, rolledBackFrom, createdBy), &t)
+	if err == sql.ErrNoRows || isUniqueViolation(err, "notification_templates_version_unique") {
+		return nil, ErrVersionConflict
+	}
+	if err != nil {
+		utils.Error("SaveNotificationTemplate DB error: %v", err)
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ResolveNotificationTemplate picks the wording to send in the locale: the latest version saved for the
+// locale, then for its language without the region, then for the default language, and otherwise the
+// built-in wording
+func ResolveNotificationTemplate(kind, channel, locale string) (NotificationTemplate, error) {
+	var candidates []string
+	for _, l := range []string{locale, strings.SplitN(locale, "-", 2)[0], utils.DefaultLocale()} {
+		if l != "" && (len(candidates) == 0 || candidates[len(candidates)-1] != l) {
+			candidates = append(candidates, l)
+		}
+	}
+
+	var t NotificationTemplate
+	err := scanNotificationTemplate(db.DB.QueryRow(
+		notificationTemplateColumns+` WHERE kind=$1 AND channel=$2 AND locale = ANY($3)
+         ORDER BY array_position($3, locale), version DESC LIMIT 1`,
+		kind, channel, pq.Array(candidates)), &t)
+	if err == sql.ErrNoRows {
+		builtin, _ := builtinTemplate(kind, channel, utils.DefaultLocale())
+		return builtin, nil
+	}
+	if err != nil {
+		utils.Error("ResolveNotificationTemplate DB error: %v", err)
+	}
+	return t, err
+}
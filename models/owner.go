@@ -2,8 +2,10 @@ package models
 
 import (
 	"database/sql"
+	"net/mail"
 	"petclinic/db"
 	"petclinic/utils"
+	"strings"
 )
 
 type Owner struct {
@@ -11,59 +13,115 @@ type Owner struct {
 	Name    string `json:"name"`
 	Contact string `json:"contact"`
 	Email   string `json:"email"`
+	Version int    `json:"version"` // incremented on every update, exposed as the ETag
 }
 
-func GetAllOwners() []Owner {
-	rows, err := db.DB.Query("SELECT id, name, contact, email FROM owners")
+// Validate checks the fields required to store an owner
+func (o Owner) Validate() error {
+	var v ValidationError
+	v.check(strings.TrimSpace(o.Name) != "", "name", "is required")
+	if o.Email != "" {
+		_, err := mail.ParseAddress(o.Email)
+		v.check(err == nil, "email", "is not a valid address")
+	}
+	return v.err()
+}
+
+// OwnerFilter narrows ListOwners; zero-valued fields are ignored
+type OwnerFilter struct {
+	ID    int
+	Name  string // substring match
+	Email string // substring match
+}
+
+var ownerSortColumns = map[string]string{
+	"id":    "id",
+	"name":  "name",
+	"email": "email",
+}
+
+// ListOwners returns one page of owners matching the filter, sorted by opts.Sort (default id)
+func ListOwners(f OwnerFilter, opts ListOptions) (Page[Owner], error) {
+	opts = opts.normalize()
+	page := Page[Owner]{Items: []Owner{}, Limit: opts.Limit, Offset: opts.Offset}
+	order, err := opts.orderBy(ownerSortColumns, "id", "id")
+	if err != nil {
+		return page, err
+	}
+
+	var where whereBuilder
+	where.addExpr("deleted_at IS NULL")
+	if f.ID != 0 {
+		where.add("id = ?", f.ID)
+	}
+	if f.Name != "" {
+		where.add("name ILIKE ?", containsPattern(f.Name))
+	}
+	if f.Email != "" {
+		where.add("email ILIKE ?", containsPattern(f.Email))
+	}
+
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM owners"+where.String(), where.args...).Scan(&page.Total)
+	if err != nil {
+		utils.Error("Failed to count owners: %v", err)
+		return page, err
+	}
+
+	limit, args := where.limitOffset(opts)
+	rows, err := db.DB.Query("SELECT id, name, contact, email, version FROM owners"+where.String()+order+limit, args...)
 	if err != nil {
 		utils.Error("Failed to fetch owners: %v", err)
-		return nil
+		return page, err
 	}
 	defer rows.Close()
-	var owners []Owner
+
 	for rows.Next() {
 		var o Owner
-		err := rows.Scan(&o.ID, &o.Name, &o.Contact, &o.Email)
+		err := rows.Scan(&o.ID, &o.Name, &o.Contact, &o.Email, &o.Version)
 		if err != nil {
 			utils.Warn("Failed to scan owner row: %v", err)
 			continue
 		}
-		owners = append(owners, o)
+		page.Items = append(page.Items, o)
 	}
 	if err = rows.Err(); err != nil {
-		utils.Error("Rows error in GetAllOwners: %v", err)
+		utils.Error("Rows error in ListOwners: %v", err)
 	}
-	return owners
+	return page, err
 }
 
-func AddOwner(o Owner) error {
-	_, err := db.DB.Exec("INSERT INTO owners (name, contact, email) VALUES ($1, $2, $3)", o.Name, o.Contact, o.Email)
-	if err != nil {
-		utils.Error("AddOwner DB error: %v", err)
-	}
-	return err
+// AddOwner inserts an owner and returns it with the ID assigned by the database
+func AddOwner(o Owner) (Owner, error) {
+	return AddOwnerTx(db.DB, o)
 }
 
-func UpdateOwner(id int, o Owner) error {
-	_, err := db.DB.Exec("UPDATE owners SET name=$1, contact=$2, email=$3 WHERE id=$4", o.Name, o.Contact, o.Email, id)
+// AddOwnerTx is AddOwner run on q, which may be a transaction
+func AddOwnerTx(q db.Querier, o Owner) (Owner, error) {
+	err := q.QueryRow("INSERT INTO owners (name, contact, email) VALUES ($1, $2, $3) RETURNING id, version", o.Name, o.Contact, o.Email).
+		Scan(&o.ID, &o.Version)
 	if err != nil {
-		utils.Error("UpdateOwner DB error: %v", err)
+		utils.Error("AddOwner DB error: %v", err)
 	}
-	return err
+	return o, err
 }
 
-func DeleteOwner(id int) error {
-	_, err := db.DB.Exec("DELETE FROM owners WHERE id=$1", id)
+// UpdateOwner overwrites the owner if it is still at o.Version and returns it with its new version.
+// Returns ErrVersionConflict if someone else updated it first.
+func UpdateOwner(id int, o Owner) (Owner, error) {
+	err := db.DB.QueryRow("UPDATE owners SET name=$1, contact=$2, email=$3, version=version+1 WHERE id=$4 AND version=$5 AND deleted_at IS NULL RETURNING version",
+		o.Name, o.Contact, o.Email, id, o.Version).
+		Scan(&o.Version)
 	if err != nil {
-		utils.Error("DeleteOwner DB error: %v", err)
+		utils.Error("UpdateOwner DB error: %v", err)
 	}
-	return err
+	o.ID = id
+	return o, versionConflict(err)
 }
 
 func GetOwnerByID(id int) (*Owner, error) {
 	var o Owner
-	err := db.DB.QueryRow("SELECT id, name, contact, email FROM owners WHERE id=$1", id).
-		Scan(&o.ID, &o.Name, &o.Contact, &o.Email)
+	err := db.DB.QueryRow("SELECT id, name, contact, email, version FROM owners WHERE id=$1 AND deleted_at IS NULL", id).
+		Scan(&o.ID, &o.Name, &o.Contact, &o.Email, &o.Version)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			utils.Warn("No owner found with id: %d", id)
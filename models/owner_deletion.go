@@ -0,0 +1,161 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"petclinic/db"
+	"petclinic/utils"
+)
+
+// Owner deletion strategies
+const (
+	DeleteBlock    = "block"    // refuse if the owner still has pets, appointments or files
+	DeleteCascade  = "cascade"  // soft-delete the owner's pets, their appointments and files too
+	DeleteReassign = "reassign" // move pets, appointments and files to another owner first
+)
+
+// OwnerDependencies counts the live records that hang off an owner
+type OwnerDependencies struct {
+	Pets         int `json:"pets"`
+	Appointments int `json:"appointments"`
+	Files        int `json:"files"`
+}
+
+// Empty reports whether nothing depends on the owner
+func (d OwnerDependencies) Empty() bool {
+	return d.Pets == 0 && d.Appointments == 0 && d.Files == 0
+}
+
+// OwnerDeletion says how DeleteOwner treats the owner's dependent records
+type OwnerDeletion struct {
+	Strategy   string
+	ReassignTo int // target owner for DeleteReassign
+	DeletedBy  int
+}
+
+// DependentsError is returned by the block strategy when the owner still has dependent records
+type DependentsError struct {
+	Dependencies OwnerDependencies
+}
+
+func (e *DependentsError) Error() string {
+	return fmt.Sprintf("owner has %d pets, %d appointments and %d files",
+		e.Dependencies.Pets, e.Dependencies.Appointments, e.Dependencies.Files)
+}
+
+// ErrInvalidReassignTarget is returned when pets cannot be moved to the requested owner
+var ErrInvalidReassignTarget = errors.New("reassign_to must be another existing owner")
+
+// countOwnerDependencies counts the owner's live pets, their live appointments and linked files
+func countOwnerDependencies(q db.Querier, ownerID int) (OwnerDependencies, error) {
+	var d OwnerDependencies
+	err := q.QueryRow(
+		`SELECT
+            (SELECT COUNT(*) FROM pets WHERE owner_id = $1 AND deleted_at IS NULL),
+            (SELECT COUNT(*) FROM appointments a JOIN pets p ON a.pet_id = p.id
+              WHERE p.owner_id = $1 AND a.deleted_at IS NULL AND p.deleted_at IS NULL),
+            (SELECT COUNT(*) FROM files f
+              WHERE f.deleted_at IS NULL
+                AND (f.owner_id = $1 OR f.pet_id IN (SELECT id FROM pets WHERE owner_id = $1 AND deleted_at IS NULL)))`,
+		ownerID).Scan(&d.Pets, &d.Appointments, &d.Files)
+	return d, err
+}
+
+// GetOwnerDependencies previews what deleting the owner would affect
+func GetOwnerDependencies(ownerID int) (OwnerDependencies, error) {
+	d, err := countOwnerDependencies(db.DB, ownerID)
+	if err != nil {
+		utils.Error("GetOwnerDependencies DB error: %v", err)
+	}
+	return d, err
+}
+
+// DeleteOwner soft-deletes the owner if it is still at the given version, handling dependent
+// pets, appointments and files according to opts.Strategy, all in one transaction.
+// Returns the dependencies that were found, ErrVersionConflict if the owner changed,
+// a *DependentsError if the block strategy refused, or ErrInvalidReassignTarget.
+func DeleteOwner(id, version int, opts OwnerDeletion) (OwnerDependencies, error) {
+	var deps OwnerDependencies
+	err := db.WithTx(func(tx *sql.Tx) error {
+		var err error
+		deps, err = DeleteOwnerTx(tx, id, version, opts)
+		return err
+	})
+	return deps, err
+}
+
+// DeleteOwnerTx is DeleteOwner run inside the caller's transaction
+func DeleteOwnerTx(tx *sql.Tx, id, version int, opts OwnerDeletion) (OwnerDependencies, error) {
+	// Lock the owner so no pets are added or moved while we work
+	var current int
+	err := tx.QueryRow("SELECT version FROM owners WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&current)
+	if err != nil {
+		return OwnerDependencies{}, versionConflict(err)
+	}
+	if current != version {
+		return OwnerDependencies{}, ErrVersionConflict
+	}
+
+	deps, err := countOwnerDependencies(tx, id)
+	if err != nil {
+		utils.Error("DeleteOwner dependency count error: %v", err)
+		return deps, err
+	}
+
+	switch opts.Strategy {
+	case DeleteBlock, "":
+		if !deps.Empty() {
+			return deps, &DependentsError{Dependencies: deps}
+		}
+
+	case DeleteCascade:
+		steps := []string{
+			`UPDATE appointments SET deleted_at=now(), deleted_by=$2, version=version+1
+             WHERE deleted_at IS NULL AND pet_id IN (SELECT id FROM pets WHERE owner_id=$1 AND deleted_at IS NULL)`,
+			`UPDATE files SET deleted_at=now(), deleted_by=$2
+             WHERE deleted_at IS NULL AND (owner_id=$1 OR pet_id IN (SELECT id FROM pets WHERE owner_id=$1 AND deleted_at IS NULL))`,
+			`UPDATE pets SET deleted_at=now(), deleted_by=$2, version=version+1 WHERE owner_id=$1 AND deleted_at IS NULL`,
+		}
+		for _, step := range steps {
+			if _, err := tx.Exec(step, id, opts.DeletedBy); err != nil {
+				utils.Error("DeleteOwner cascade error: %v", err)
+				return deps, err
+			}
+		}
+
+	case DeleteReassign:
+		if opts.ReassignTo == id {
+			return deps, ErrInvalidReassignTarget
+		}
+		var exists bool
+		err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM owners WHERE id=$1 AND deleted_at IS NULL)", opts.ReassignTo).Scan(&exists)
+		if err != nil {
+			return deps, err
+		}
+		if !exists {
+			return deps, ErrInvalidReassignTarget
+		}
+		steps := []string{
+			`UPDATE appointments SET owner_id=$2, version=version+1
+             WHERE pet_id IN (SELECT id FROM pets WHERE owner_id=$1 AND deleted_at IS NULL)`,
+			`UPDATE files SET owner_id=$2 WHERE owner_id=$1`,
+			`UPDATE pets SET owner_id=$2, version=version+1 WHERE owner_id=$1 AND deleted_at IS NULL`,
+		}
+		for _, step := range steps {
+			if _, err := tx.Exec(step, id, opts.ReassignTo); err != nil {
+				utils.Error("DeleteOwner reassign error: %v", err)
+				return deps, err
+			}
+		}
+
+	default:
+		return deps, fmt.Errorf("unknown deletion strategy %q", opts.Strategy)
+	}
+
+	_, err = tx.Exec("UPDATE owners SET deleted_at=now(), deleted_by=$2, version=version+1 WHERE id=$1", id, opts.DeletedBy)
+	if err != nil {
+		utils.Error("DeleteOwner DB error: %v", err)
+	}
+	return deps, err
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"petclinic/db"
 	"petclinic/utils"
+	"strings"
 )
 
 type Pet struct {
@@ -12,85 +13,171 @@ type Pet struct {
 	Species string `json:"species"`
 	Breed   string `json:"breed"`
 	OwnerID int    `json:"owner_id"`
-	History string `json:"history"`
+	Version int    `json:"version"` // incremented on every update, exposed as the ETag
+
+	Alerts []PetAlert `json:"alerts,omitempty"` // read-only; filled in by AttachPetAlerts
+}
+
+// Validate checks the fields required to store a pet
+func (p Pet) Validate() error {
+	var v ValidationError
+	v.check(strings.TrimSpace(p.Name) != "", "name", "is required")
+	v.check(strings.TrimSpace(p.Species) != "", "species", "is required")
+	v.check(p.OwnerID > 0, "owner_id", "is required")
+	return v.err()
+}
+
+// PetFilter narrows ListPets; zero-valued fields are ignored
+type PetFilter struct {
+	OwnerID int
+	Species string
+	Breed   string
+	Name    string // substring match
 }
 
-func GetAllPets() []Pet {
-	rows, err := db.DB.Query("SELECT id, name, species, breed, owner_id, history FROM pets")
+var petSortColumns = map[string]string{
+	"id":       "id",
+	"name":     "name",
+	"species":  "species",
+	"breed":    "breed",
+	"owner_id": "owner_id",
+}
+
+// ListPets returns one page of pets matching the filter, sorted by opts.Sort (default id)
+func ListPets(f PetFilter, opts ListOptions) (Page[Pet], error) {
+	opts = opts.normalize()
+	page := Page[Pet]{Items: []Pet{}, Limit: opts.Limit, Offset: opts.Offset}
+	order, err := opts.orderBy(petSortColumns, "id", "id")
 	if err != nil {
-		utils.Error("Failed to fetch pets: %v", err)
-		return nil
+		return page, err
 	}
-	defer rows.Close()
 
-	var pets []Pet
-	for rows.Next() {
-		var p Pet
-		err := rows.Scan(&p.ID, &p.Name, &p.Species, &p.Breed, &p.OwnerID, &p.History)
-		if err != nil {
-			utils.Warn("Failed to scan pet row: %v", err)
-			continue
-		}
-		pets = append(pets, p)
+	var where whereBuilder
+	where.addExpr("deleted_at IS NULL")
+	if f.OwnerID != 0 {
+		where.add("owner_id = ?", f.OwnerID)
 	}
-	if err = rows.Err(); err != nil {
-		utils.Error("Rows error in GetAllPets: %v", err)
+	if f.Species != "" {
+		where.add("LOWER(species) = LOWER(?)", f.Species)
+	}
+	if f.Breed != "" {
+		where.add("LOWER(breed) = LOWER(?)", f.Breed)
+	}
+	if f.Name != "" {
+		where.add("name ILIKE ?", containsPattern(f.Name))
 	}
-	return pets
-}
 
-func GetPetsByOwnerID(ownerID int) []Pet {
-	rows, err := db.DB.Query("SELECT id, name, species, breed, owner_id, history FROM pets WHERE owner_id=$1", ownerID)
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM pets"+where.String(), where.args...).Scan(&page.Total)
 	if err != nil {
-		utils.Error("Failed to fetch pets for owner %d: %v", ownerID, err)
-		return nil
+		utils.Error("Failed to count pets: %v", err)
+		return page, err
+	}
+
+	limit, args := where.limitOffset(opts)
+	rows, err := db.DB.Query("SELECT id, name, species, breed, owner_id, version FROM pets"+where.String()+order+limit, args...)
+	if err != nil {
+		utils.Error("Failed to fetch pets: %v", err)
+		return page, err
 	}
 	defer rows.Close()
 
-	var pets []Pet
 	for rows.Next() {
 		var p Pet
-		err := rows.Scan(&p.ID, &p.Name, &p.Species, &p.Breed, &p.OwnerID, &p.History)
+		err := rows.Scan(&p.ID, &p.Name, &p.Species, &p.Breed, &p.OwnerID, &p.Version)
 		if err != nil {
 			utils.Warn("Failed to scan pet row: %v", err)
 			continue
 		}
-		pets = append(pets, p)
+		page.Items = append(page.Items, p)
 	}
 	if err = rows.Err(); err != nil {
-		utils.Error("Rows error in GetPetsByOwnerID: %v", err)
+		utils.Error("Rows error in ListPets: %v", err)
 	}
-	return pets
+	return page, err
 }
 
-func AddPet(p Pet) error {
-	_, err := db.DB.Exec("INSERT INTO pets (name, species, breed, owner_id, history) VALUES ($1, $2, $3, $4, $5)", p.Name, p.Species, p.Breed, p.OwnerID, p.History)
+// AddPet inserts a pet and returns it with the ID assigned by the database
+func AddPet(p Pet) (Pet, error) {
+	return AddPetTx(db.DB, p)
+}
+
+// AddPetTx is AddPet run on q, which may be a transaction
+func AddPetTx(q db.Querier, p Pet) (Pet, error) {
+	err := q.QueryRow("INSERT INTO pets (name, species, breed, owner_id) VALUES ($1, $2, $3, $4) RETURNING id, version", p.Name, p.Species, p.Breed, p.OwnerID).
+		Scan(&p.ID, &p.Version)
 	if err != nil {
 		utils.Error("AddPet DB error: %v", err)
 	}
-	return err
+	return p, err
 }
 
-func UpdatePet(id int, p Pet) error {
-	_, err := db.DB.Exec("UPDATE pets SET name=$1, species=$2, breed=$3, owner_id=$4, history=$5 WHERE id=$6", p.Name, p.Species, p.Breed, p.OwnerID, p.History, id)
+// UpdatePet overwrites the pet if it is still at p.Version and returns it with its new version.
+// Returns ErrVersionConflict if someone else updated it first.
+func UpdatePet(id int, p Pet) (Pet, error) {
+	err := db.DB.QueryRow("UPDATE pets SET name=$1, species=$2, breed=$3, owner_id=$4, version=version+1 WHERE id=$5 AND version=$6 AND deleted_at IS NULL RETURNING version",
+		p.Name, p.Species, p.Breed, p.OwnerID, id, p.Version).
+		Scan(&p.Version)
 	if err != nil {
 		utils.Error("UpdatePet DB error: %v", err)
 	}
-	return err
+	p.ID = id
+	return p, versionConflict(err)
 }
 
-func DeletePet(id int) error {
-	_, err := db.DB.Exec("DELETE FROM pets WHERE id=$1", id)
+// DeletePet soft-deletes the pet if it is still at the given version, otherwise returns ErrVersionConflict.
+// Its appointments and files go with it in the same transaction, as when its owner is deleted, and the
+// slots its appointments were holding are offered to the waitlist. The rows stay in the trash until
+// restored or purged.
+func DeletePet(id, version, deletedBy int) error {
+	var freedIDs []int
+	err := db.WithTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec("UPDATE pets SET deleted_at=now(), deleted_by=$3, version=version+1 WHERE id=$1 AND version=$2 AND deleted_at IS NULL", id, version, deletedBy)
+		if err == nil {
+			err = expectOneRow(res)
+		}
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(
+			`UPDATE appointments a SET deleted_at=now(), deleted_by=$2, version=version+1
+             WHERE a.pet_id=$1 AND a.deleted_at IS NULL RETURNING a.id, `+appointmentHoldsSlot, id, deletedBy)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var aptID int
+			var held bool
+			if err := rows.Scan(&aptID, &held); err != nil {
+				rows.Close()
+				return err
+			}
+			if held {
+				freedIDs = append(freedIDs, aptID)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE files SET deleted_at=now(), deleted_by=$2 WHERE pet_id=$1 AND deleted_at IS NULL", id, deletedBy)
+		return err
+	})
 	if err != nil {
 		utils.Error("DeletePet DB error: %v", err)
+		return err
+	}
+	for _, aptID := range freedIDs {
+		offerFreedSlot(aptID)
 	}
-	return err
+	return nil
 }
 
 func GetPetByID(id int) (*Pet, error) {
 	var p Pet
-	err := db.DB.QueryRow("SELECT id, name, species, breed, owner_id, history FROM pets WHERE id=$1", id).
-		Scan(&p.ID, &p.Name, &p.Species, &p.Breed, &p.OwnerID, &p.History)
+	err := db.DB.QueryRow("SELECT id, name, species, breed, owner_id, version FROM pets WHERE id=$1 AND deleted_at IS NULL", id).
+		Scan(&p.ID, &p.Name, &p.Species, &p.Breed, &p.OwnerID, &p.Version)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			utils.Warn("No pet found with id: %d", id)
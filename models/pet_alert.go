@@ -0,0 +1,162 @@
+package models
+
+import (
+	"database/sql"
+	"petclinic/db"
+	"petclinic/utils"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Alert severities, most urgent first
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// PetAlert flags something staff must know before handling a pet, e.g. "penicillin allergy" or "aggressive"
+type PetAlert struct {
+	ID        int       `json:"id"`
+	PetID     int       `json:"pet_id"`
+	Category  string    `json:"category"` // allergy, behavior, condition or other
+	Label     string    `json:"label"`
+	Severity  string    `json:"severity"`
+	Notes     string    `json:"notes"`
+	CreatedBy int       `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks the alert's label, category and severity
+func (a PetAlert) Validate() error {
+	var v ValidationError
+	v.check(a.PetID > 0, "pet_id", "is required")
+	v.check(strings.TrimSpace(a.Label) != "", "label", "is required")
+	switch a.Category {
+	case "allergy", "behavior", "condition", "other":
+	default:
+		v.check(false, "category", "must be allergy, behavior, condition or other")
+	}
+	switch a.Severity {
+	case SeverityCritical, SeverityWarning, SeverityInfo:
+	default:
+		v.check(false, "severity", "must be info, warning or critical")
+	}
+	return v.err()
+}
+
+const petAlertColumns = "SELECT id, pet_id, category, label, severity, notes, COALESCE(created_by, 0), created_at FROM pet_alerts"
+
+// petAlertOrder lists the most severe alerts first
+const petAlertOrder = " ORDER BY CASE severity WHEN 'critical' THEN 0 WHEN 'warning' THEN 1 ELSE 2 END, created_at, id"
+
+func scanPetAlert(row interface{ Scan(...interface{}) error }) (PetAlert, error) {
+	var a PetAlert
+	err := row.Scan(&a.ID, &a.PetID, &a.Category, &a.Label, &a.Severity, &a.Notes, &a.CreatedBy, &a.CreatedAt)
+	return a, err
+}
+
+// GetAlertsForPets returns the alerts of each listed pet, keyed by pet ID, most severe first
+func GetAlertsForPets(petIDs []int) (map[int][]PetAlert, error) {
+	alerts := map[int][]PetAlert{}
+	if len(petIDs) == 0 {
+		return alerts, nil
+	}
+	rows, err := db.DB.Query(petAlertColumns+" WHERE pet_id = ANY($1)"+petAlertOrder, pq.Array(petIDs))
+	if err != nil {
+		utils.Error("Failed to fetch pet alerts: %v", err)
+		return alerts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanPetAlert(rows)
+		if err != nil {
+			utils.Warn("Failed to scan pet alert row: %v", err)
+			continue
+		}
+		alerts[a.PetID] = append(alerts[a.PetID], a)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in GetAlertsForPets: %v", err)
+	}
+	return alerts, err
+}
+
+// AttachPetAlerts fills in Alerts on each pet
+func AttachPetAlerts(pets []Pet) error {
+	ids := make([]int, len(pets))
+	for i, p := range pets {
+		ids[i] = p.ID
+	}
+	alerts, err := GetAlertsForPets(ids)
+	for i := range pets {
+		pets[i].Alerts = alerts[pets[i].ID]
+		if pets[i].Alerts == nil {
+			pets[i].Alerts = []PetAlert{}
+		}
+	}
+	return err
+}
+
+// AttachAppointmentAlerts fills in PetAlerts on each appointment from the alerts of its pet
+func AttachAppointmentAlerts(apts []Appointment) error {
+	ids := make([]int, len(apts))
+	for i, a := range apts {
+		ids[i] = a.PetID
+	}
+	alerts, err := GetAlertsForPets(ids)
+	for i := range apts {
+		apts[i].PetAlerts = alerts[apts[i].PetID]
+		if apts[i].PetAlerts == nil {
+			apts[i].PetAlerts = []PetAlert{}
+		}
+	}
+	return err
+}
+
+// GetPetAlertByID returns the pet's alert with the given ID, or nil if there is none
+func GetPetAlertByID(petID, id int) (*PetAlert, error) {
+	a, err := scanPetAlert(db.DB.QueryRow(petAlertColumns+" WHERE id=$1 AND pet_id=$2", id, petID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		utils.Error("GetPetAlertByID DB error: %v", err)
+		return nil, err
+	}
+	return &a, nil
+}
+
+// AddPetAlert stores a new alert on a pet
+func AddPetAlert(a PetAlert) (PetAlert, error) {
+	err := db.DB.QueryRow(
+		"INSERT INTO pet_alerts (pet_id, category, label, severity, notes, created_by) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at",
+		a.PetID, a.Category, a.Label, a.Severity, a.Notes, nullID(a.CreatedBy)).
+		Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		utils.Error("AddPetAlert DB error: %v", err)
+	}
+	return a, err
+}
+
+// UpdatePetAlert overwrites an alert's category, label, severity and notes
+func UpdatePetAlert(a PetAlert) error {
+	_, err := db.DB.Exec("UPDATE pet_alerts SET category=$1, label=$2, severity=$3, notes=$4 WHERE id=$5",
+		a.Category, a.Label, a.Severity, a.Notes, a.ID)
+	if err != nil {
+		utils.Error("UpdatePetAlert DB error: %v", err)
+	}
+	return err
+}
+
+// DeletePetAlert removes an alert that no longer applies
+func DeletePetAlert(id int) error {
+	_, err := db.DB.Exec("DELETE FROM pet_alerts WHERE id=$1", id)
+	if err != nil {
+		utils.Error("DeletePetAlert DB error: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,254 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"petclinic/db"
+	"petclinic/utils"
+	"strings"
+	"time"
+)
+
+// Prescription statuses
+const (
+	PrescriptionActive       = "active"
+	PrescriptionDiscontinued = "discontinued"
+	PrescriptionRenewed      = "renewed" // replaced by a newer prescription
+)
+
+// Prescription is medication prescribed for a pet by a vet
+type Prescription struct {
+	ID                int        `json:"id"`
+	PetID             int        `json:"pet_id"`
+	AppointmentID     int        `json:"appointment_id,omitempty"`
+	PrescribedBy      int        `json:"prescribed_by"`
+	Drug              string     `json:"drug"`
+	Dose              string     `json:"dose"`      // e.g. "250 mg"
+	Frequency         string     `json:"frequency"` // e.g. "twice daily"
+	DurationDays      int        `json:"duration_days"`
+	Refills           int        `json:"refills"`
+	Instructions      string     `json:"instructions"`
+	Status            string     `json:"status"`
+	PrescribedOn      time.Time  `json:"prescribed_on"`
+	EndsOn            *time.Time `json:"ends_on,omitempty"` // prescribed_on + duration_days, if a duration is set
+	RenewedFromID     int        `json:"renewed_from_id,omitempty"`
+	DiscontinuedAt    *time.Time `json:"discontinued_at,omitempty"`
+	DiscontinuedBy    int        `json:"discontinued_by,omitempty"`
+	DiscontinueReason string     `json:"discontinue_reason,omitempty"`
+}
+
+// ErrPrescriptionNotActive is returned when renewing or discontinuing a prescription that is no longer active
+var ErrPrescriptionNotActive = errors.New("prescription is not active")
+
+// Validate checks the fields required to store a prescription
+func (p Prescription) Validate() error {
+	var v ValidationError
+	v.check(p.PetID > 0, "pet_id", "is required")
+	v.check(strings.TrimSpace(p.Drug) != "", "drug", "is required")
+	v.check(strings.TrimSpace(p.Dose) != "", "dose", "is required")
+	v.check(strings.TrimSpace(p.Frequency) != "", "frequency", "is required")
+	v.check(p.DurationDays >= 0, "duration_days", "must not be negative")
+	v.check(p.Refills >= 0, "refills", "must not be negative")
+	return v.err()
+}
+
+// IsCurrent reports whether the prescription is active and has not run past its end date as of now
+func (p Prescription) IsCurrent(now time.Time) bool {
+	if p.Status != PrescriptionActive {
+		return false
+	}
+	if p.EndsOn == nil {
+		return true
+	}
+	y, m, d := now.Date()
+	return !p.EndsOn.Before(time.Date(y, m, d, 0, 0, 0, 0, time.UTC))
+}
+
+// prescriptionCurrent matches active prescriptions that have not run past their end date
+const prescriptionCurrent = "status = 'active' AND (duration_days = 0 OR prescribed_on + duration_days >= CURRENT_DATE)"
+
+const prescriptionColumns = `SELECT id, pet_id, COALESCE(appointment_id, 0), COALESCE(prescribed_by, 0), drug, dose, frequency,
+                duration_days, refills, instructions, status, prescribed_on,
+                CASE WHEN duration_days > 0 THEN prescribed_on + duration_days END,
+                COALESCE(renewed_from_id, 0), discontinued_at, COALESCE(discontinued_by, 0), discontinue_reason
+         FROM prescriptions`
+
+func scanPrescription(row interface{ Scan(...interface{}) error }) (Prescription, error) {
+	var p Prescription
+	var endsOn, discontinuedAt sql.NullTime
+	err := row.Scan(&p.ID, &p.PetID, &p.AppointmentID, &p.PrescribedBy, &p.Drug, &p.Dose, &p.Frequency,
+		&p.DurationDays, &p.Refills, &p.Instructions, &p.Status, &p.PrescribedOn,
+		&endsOn, &p.RenewedFromID, &discontinuedAt, &p.DiscontinuedBy, &p.DiscontinueReason)
+	if endsOn.Valid {
+		p.EndsOn = &endsOn.Time
+	}
+	if discontinuedAt.Valid {
+		p.DiscontinuedAt = &discontinuedAt.Time
+	}
+	return p, err
+}
+
+// PrescriptionFilter narrows ListPrescriptions
+type PrescriptionFilter struct {
+	PetID       int
+	Status      string
+	CurrentOnly bool // only active prescriptions that have not ended
+}
+
+var prescriptionSortColumns = map[string]string{
+	"id":            "id",
+	"drug":          "drug",
+	"prescribed_on": "prescribed_on",
+}
+
+// ListPrescriptions returns one page of prescriptions matching the filter, newest first by default
+func ListPrescriptions(f PrescriptionFilter, opts ListOptions) (Page[Prescription], error) {
+	opts = opts.normalize()
+	page := Page[Prescription]{Items: []Prescription{}, Limit: opts.Limit, Offset: opts.Offset}
+	order, err := opts.orderBy(prescriptionSortColumns, "id", "-prescribed_on")
+	if err != nil {
+		return page, err
+	}
+
+	var where whereBuilder
+	if f.PetID != 0 {
+		where.add("pet_id = ?", f.PetID)
+	}
+	if f.Status != "" {
+		where.add("status = ?", f.Status)
+	}
+	if f.CurrentOnly {
+		where.addExpr(prescriptionCurrent)
+	}
+
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM prescriptions"+where.String(), where.args...).Scan(&page.Total)
+	if err != nil {
+		utils.Error("Failed to count prescriptions: %v", err)
+		return page, err
+	}
+
+	limit, args := where.limitOffset(opts)
+	rows, err := db.DB.Query(prescriptionColumns+where.String()+order+limit, args...)
+	if err != nil {
+		utils.Error("Failed to fetch prescriptions: %v", err)
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPrescription(rows)
+		if err != nil {
+			utils.Warn("Failed to scan prescription row: %v", err)
+			continue
+		}
+		page.Items = append(page.Items, p)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListPrescriptions: %v", err)
+	}
+	return page, err
+}
+
+// GetPrescriptionByID returns the prescription, or nil if there is none
+func GetPrescriptionByID(id int) (*Prescription, error) {
+	p, err := scanPrescription(db.DB.QueryRow(prescriptionColumns+" WHERE id=$1", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.Warn("No prescription found with id: %d", id)
+			return nil, nil
+		}
+		utils.Error("GetPrescriptionByID DB error: %v", err)
+		return nil, err
+	}
+	return &p, nil
+}
+
+// AddPrescription stores a new active prescription dated today
+func AddPrescription(p Prescription) (Prescription, error) {
+	return addPrescription(db.DB, p)
+}
+
+func addPrescription(q db.Querier, p Prescription) (Prescription, error) {
+	err := q.QueryRow(
+		`INSERT INTO prescriptions (pet_id, appointment_id, prescribed_by, drug, dose, frequency, duration_days, refills, instructions, renewed_from_id)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
+		p.PetID, nullID(p.AppointmentID), nullID(p.PrescribedBy), p.Drug, p.Dose, p.Frequency,
+		p.DurationDays, p.Refills, p.Instructions, nullID(p.RenewedFromID)).
+		Scan(&p.ID)
+	if err != nil {
+		utils.Error("AddPrescription DB error: %v", err)
+		return p, err
+	}
+	created, err := scanPrescription(q.QueryRow(prescriptionColumns+" WHERE id=$1", p.ID))
+	return created, err
+}
+
+// RenewPrescription replaces an active prescription with a new one starting today, with the same
+// drug and dosing unless overridden by changes. The original is marked renewed.
+func RenewPrescription(id int, changes Prescription) (Prescription, error) {
+	var renewed Prescription
+	err := db.WithTx(func(tx *sql.Tx) error {
+		original, err := scanPrescription(tx.QueryRow(prescriptionColumns+" WHERE id=$1 FOR UPDATE", id))
+		if err != nil {
+			return err
+		}
+		if original.Status != PrescriptionActive {
+			return ErrPrescriptionNotActive
+		}
+		if _, err := tx.Exec("UPDATE prescriptions SET status=$2 WHERE id=$1", id, PrescriptionRenewed); err != nil {
+			return err
+		}
+
+		next := original
+		next.RenewedFromID = original.ID
+		next.PrescribedBy = changes.PrescribedBy
+		next.AppointmentID = changes.AppointmentID
+		if changes.Dose != "" {
+			next.Dose = changes.Dose
+		}
+		if changes.Frequency != "" {
+			next.Frequency = changes.Frequency
+		}
+		if changes.DurationDays != 0 {
+			next.DurationDays = changes.DurationDays
+		}
+		if changes.Refills != 0 {
+			next.Refills = changes.Refills
+		}
+		if changes.Instructions != "" {
+			next.Instructions = changes.Instructions
+		}
+		if err := next.Validate(); err != nil {
+			return err
+		}
+		renewed, err = addPrescription(tx, next)
+		return err
+	})
+	if err != nil && err != ErrPrescriptionNotActive {
+		utils.Error("RenewPrescription DB error: %v", err)
+	}
+	return renewed, err
+}
+
+// DiscontinuePrescription stops an active prescription, recording who stopped it and why
+func DiscontinuePrescription(id, by int, reason string) (Prescription, error) {
+	res, err := db.DB.Exec(
+		"UPDATE prescriptions SET status=$2, discontinued_at=now(), discontinued_by=$3, discontinue_reason=$4 WHERE id=$1 AND status=$5",
+		id, PrescriptionDiscontinued, nullID(by), reason, PrescriptionActive)
+	if err == nil {
+		if n, _ := res.RowsAffected(); n != 1 {
+			err = ErrPrescriptionNotActive
+		}
+	}
+	if err != nil {
+		if err != ErrPrescriptionNotActive {
+			utils.Error("DiscontinuePrescription DB error: %v", err)
+		}
+		return Prescription{}, err
+	}
+	p, err := GetPrescriptionByID(id)
+	if err != nil || p == nil {
+		return Prescription{}, err
+	}
+	return *p, nil
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// ListOptions controls paging and ordering of list queries.
+// Sort names one of the sortable fields for the resource; a leading "-" sorts descending.
+type ListOptions struct {
+	Limit  int
+	Offset int
+	Sort   string
+}
+
+// Page is one page of a list query together with the total number of matching rows
+type Page[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// InvalidSortError is returned when a list is sorted by a field that is not sortable
+type InvalidSortError struct {
+	Field string
+}
+
+func (e *InvalidSortError) Error() string {
+	return fmt.Sprintf("cannot sort by %q", e.Field)
+}
+
+// normalize clamps the paging values into the allowed range
+func (o ListOptions) normalize() ListOptions {
+	if o.Limit <= 0 {
+		o.Limit = DefaultPageSize
+	}
+	if o.Limit > MaxPageSize {
+		o.Limit = MaxPageSize
+	}
+	if o.Offset < 0 {
+		o.Offset = 0
+	}
+	return o
+}
+
+// orderBy maps the requested sort onto a whitelisted SQL ORDER BY clause.
+// columns maps sort field names to SQL expressions; the id column breaks ties so paging is stable.
+func (o ListOptions) orderBy(columns map[string]string, idColumn, defaultSort string) (string, error) {
+	sort := o.Sort
+	if sort == "" {
+		sort = defaultSort
+	}
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		direction = "DESC"
+		sort = sort[1:]
+	}
+	column, ok := columns[sort]
+	if !ok {
+		return "", &InvalidSortError{Field: sort}
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, %s %s", column, direction, idColumn, direction), nil
+}
+
+// whereBuilder accumulates AND-ed SQL conditions with numbered placeholders
+type whereBuilder struct {
+	clauses []string
+	args    []interface{}
+}
+
+// add appends a condition; the "?" in clause is replaced by the next $n placeholder for arg
+func (b *whereBuilder) add(clause string, arg interface{}) {
+	b.args = append(b.args, arg)
+	b.clauses = append(b.clauses, strings.Replace(clause, "?", fmt.Sprintf("$%d", len(b.args)), 1))
+}
+
+// addExpr appends a condition that takes no arguments
+func (b *whereBuilder) addExpr(clause string) {
+	b.clauses = append(b.clauses, clause)
+}
+
+func (b *whereBuilder) String() string {
+	if len(b.clauses) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.clauses, " AND ")
+}
+
+// limitOffset appends LIMIT/OFFSET placeholders after the filter arguments
+func (b *whereBuilder) limitOffset(o ListOptions) (string, []interface{}) {
+	n := len(b.args)
+	args := append(append([]interface{}{}, b.args...), o.Limit, o.Offset)
+	return fmt.Sprintf(" LIMIT $%d OFFSET $%d", n+1, n+2), args
+}
+
+// containsPattern builds an ILIKE pattern matching s anywhere, with LIKE wildcards in s escaped
+func containsPattern(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(s) + "%"
+}
@@ -0,0 +1,400 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"petclinic/db"
+	"petclinic/utils"
+	"strings"
+	"time"
+)
+
+// Recall rule kinds
+const (
+	RecallVaccination = "vaccination" // due when the pet's latest dose of the vaccine is
+	RecallCheckup     = "checkup"     // due IntervalMonths after the pet's last completed appointment of the type
+)
+
+// Recall statuses
+const (
+	RecallPending   = "pending"
+	RecallSent      = "sent"
+	RecallFailed    = "failed"     // gave up after MaxReminderAttempts
+	RecallNoContact = "no_contact" // the owner has no channel turned on; follow up by phone
+	RecallSkipped   = "skipped"    // the pet was booked in, or it or its owner deleted, before the notice went out
+)
+
+// RecallMaxOverdueDays stops a new or reactivated rule from recalling pets that have long been overdue
+const RecallMaxOverdueDays = 90
+
+// RecallBookedWithinDays is how long after a recall notice a booking is credited to it
+const RecallBookedWithinDays = 60
+
+// RecallRule says which pets are due back and when to tell their owners
+type RecallRule struct {
+	ID             int       `json:"id"`
+	Name           string    `json:"name"`
+	Kind           string    `json:"kind"`
+	Vaccine        string    `json:"vaccine,omitempty"`             // vaccination rules; empty matches every vaccine
+	TypeID         int       `json:"appointment_type_id,omitempty"` // what to book; for checkup rules also the visit counted
+	IntervalMonths int       `json:"interval_months"`               // checkup rules
+	LeadDays       int       `json:"lead_days"`                     // notices go out this long before the due date
+	Active         bool      `json:"active"`
+	CreatedAt      time.Time `json:"created_at"`
+
+	// Read-only campaign results
+	Sent   int `json:"sent"`
+	Booked int `json:"booked"` // sent recalls followed by a booking
+}
+
+// Validate checks the rule's kind and that it has what its kind needs
+func (r RecallRule) Validate() error {
+	var v ValidationError
+	v.check(strings.TrimSpace(r.Name) != "", "name", "is required")
+	v.check(r.Kind == RecallVaccination || r.Kind == RecallCheckup, "kind", "must be vaccination or checkup")
+	if r.Kind == RecallCheckup {
+		v.check(r.TypeID > 0, "appointment_type_id", "is required for checkup rules")
+		v.check(r.IntervalMonths > 0, "interval_months", "must be positive")
+	}
+	v.check(r.LeadDays >= 0, "lead_days", "must not be negative")
+	return v.err()
+}
+
+const recallRuleColumns = `SELECT r.id, r.name, r.kind, r.vaccine, COALESCE(r.appointment_type_id, 0), r.interval_months, r.lead_days,
+                r.active, r.created_at,
+                (SELECT COUNT(*) FROM recalls c WHERE c.rule_id = r.id AND c.status = 'sent'),
+                (SELECT COUNT(*) FROM recalls c WHERE c.rule_id = r.id AND c.booked_at IS NOT NULL)
+         FROM recall_rules r`
+
+func scanRecallRule(row interface{ Scan(...interface{}) error }, r *RecallRule) error {
+	return row.Scan(&r.ID, &r.Name, &r.Kind, &r.Vaccine, &r.TypeID, &r.IntervalMonths, &r.LeadDays, &r.Active, &r.CreatedAt,
+		&r.Sent, &r.Booked)
+}
+
+// ListRecallRules returns every recall rule with its results, by name
+func ListRecallRules() ([]RecallRule, error) {
+	rules := []RecallRule{}
+	rows, err := db.DB.Query(recallRuleColumns + " ORDER BY r.name, r.id")
+	if err != nil {
+		utils.Error("Failed to fetch recall rules: %v", err)
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r RecallRule
+		if err := scanRecallRule(rows, &r); err != nil {
+			utils.Warn("Failed to scan recall rule row: %v", err)
+			continue
+		}
+		rules = append(rules, r)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListRecallRules: %v", err)
+	}
+	return rules, err
+}
+
+// GetRecallRule returns the rule, or nil if there is none
+func GetRecallRule(id int) (*RecallRule, error) {
+	var r RecallRule
+	err := scanRecallRule(db.DB.QueryRow(recallRuleColumns+" WHERE r.id=$1", id), &r)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		utils.Error("GetRecallRule DB error: %v", err)
+		return nil, err
+	}
+	return &r, nil
+}
+
+// AddRecallRule stores a new rule. Returns ErrUnknownAppointmentType if it names a type that does not exist.
+func AddRecallRule(r RecallRule) (RecallRule, error) {
+	err := db.DB.QueryRow(
+		`INSERT INTO recall_rules (name, kind, vaccine, appointment_type_id, interval_months, lead_days, active)
+         VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`,
+		r.Name, r.Kind, r.Vaccine, nullID(r.TypeID), r.IntervalMonths, r.LeadDays, r.Active).Scan(&r.ID, &r.CreatedAt)
+	if isForeignKeyViolation(err) {
+		return r, ErrUnknownAppointmentType
+	}
+	if err != nil {
+		utils.Error("AddRecallRule DB error: %v", err)
+	}
+	return r, err
+}
+
+// UpdateRecallRule overwrites the rule. Returns ErrUnknownAppointmentType if it names a type that does not exist.
+func UpdateRecallRule(r RecallRule) error {
+	_, err := db.DB.Exec(
+		`UPDATE recall_rules SET name=$1, kind=$2, vaccine=$3, appointment_type_id=$4, interval_months=$5, lead_days=$6, active=$7
+         WHERE id=$8`,
+		r.Name, r.Kind, r.Vaccine, nullID(r.TypeID), r.IntervalMonths, r.LeadDays, r.Active, r.ID)
+	if isForeignKeyViolation(err) {
+		return ErrUnknownAppointmentType
+	}
+	if err != nil {
+		utils.Error("UpdateRecallRule DB error: %v", err)
+	}
+	return err
+}
+
+// Recall is one pet on the recall list for one rule and due date
+type Recall struct {
+	ID                  int        `json:"id"`
+	RuleID              int        `json:"rule_id"`
+	PetID               int        `json:"pet_id"`
+	OwnerID             int        `json:"owner_id"`
+	DueOn               time.Time  `json:"due_on"`
+	Status              string     `json:"status"`
+	SentVia             string     `json:"sent_via,omitempty"` // channels that delivered it, e.g. "email,sms"
+	Attempts            int        `json:"attempts"`
+	LastError           string     `json:"last_error,omitempty"`
+	SentAt              *time.Time `json:"sent_at,omitempty"`
+	BookedAppointmentID int        `json:"booked_appointment_id,omitempty"`
+	BookedAt            *time.Time `json:"booked_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// RecallFilter narrows ListRecalls; zero values are ignored
+type RecallFilter struct {
+	RuleID int
+	PetID  int
+	Status string
+	Booked *bool
+}
+
+var recallSortColumns = map[string]string{
+	"due_on":     "c.due_on",
+	"created_at": "c.created_at",
+}
+
+const recallColumns = `SELECT c.id, c.rule_id, c.pet_id, p.owner_id, c.due_on, c.status, c.sent_via, c.attempts, c.last_error,
+                c.sent_at, COALESCE(c.booked_appointment_id, 0), c.booked_at, c.created_at
+         FROM recalls c JOIN pets p ON p.id = c.pet_id`
+
+func scanRecall(row interface{ Scan(...interface{}) error }, c *Recall, extra ...interface{}) error {
+	return row.Scan(append([]interface{}{&c.ID, &c.RuleID, &c.PetID, &c.OwnerID, &c.DueOn, &c.Status, &c.SentVia, &c.Attempts,
+		&c.LastError, &c.SentAt, &c.BookedAppointmentID, &c.BookedAt, &c.CreatedAt}, extra...)...)
+}
+
+// ListRecalls returns a page of the recall list, soonest due first unless sorted otherwise
+func ListRecalls(f RecallFilter, opts ListOptions) (Page[Recall], error) {
+	opts = opts.normalize()
+	page := Page[Recall]{Items: []Recall{}, Limit: opts.Limit, Offset: opts.Offset}
+	order, err := opts.orderBy(recallSortColumns, "c.id", "due_on")
+	if err != nil {
+		return page, err
+	}
+
+	var where whereBuilder
+	where.addExpr("p.deleted_at IS NULL")
+	if f.RuleID != 0 {
+		where.add("c.rule_id = ?", f.RuleID)
+	}
+	if f.PetID != 0 {
+		where.add("c.pet_id = ?", f.PetID)
+	}
+	if f.Status != "" {
+		where.add("c.status = ?", f.Status)
+	}
+	if f.Booked != nil {
+		if *f.Booked {
+			where.addExpr("c.booked_at IS NOT NULL")
+		} else {
+			where.addExpr("c.booked_at IS NULL")
+		}
+	}
+
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM recalls c JOIN pets p ON p.id = c.pet_id"+where.String(), where.args...).Scan(&page.Total)
+	if err != nil {
+		utils.Error("Failed to count recalls: %v", err)
+		return page, err
+	}
+
+	limit, args := where.limitOffset(opts)
+	rows, err := db.DB.Query(recallColumns+where.String()+order+limit, args...)
+	if err != nil {
+		utils.Error("Failed to fetch recalls: %v", err)
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Recall
+		if err := scanRecall(rows, &c); err != nil {
+			utils.Warn("Failed to scan recall row: %v", err)
+			continue
+		}
+		page.Items = append(page.Items, c)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListRecalls: %v", err)
+	}
+	return page, err
+}
+
+// petBookedForRule is true when the recall's pet already has an upcoming appointment of the rule's type
+// (any type for rules without one)
+const petBookedForRule = `EXISTS (SELECT 1 FROM appointments a
+             WHERE a.pet_id = %s AND a.deleted_at IS NULL AND a.status IN ('requested', 'confirmed') AND a.starts_at > now()
+               AND (r.appointment_type_id IS NULL OR a.appointment_type_id = r.appointment_type_id))`
+
+// GenerateRecalls adds to the recall list every live pet that active rules find due within their lead time,
+// unless the pet is already booked in, and skips pending recalls whose pet has since been booked.
+// Returns how many recalls were added.
+func GenerateRecalls() (int, error) {
+	_, err := db.DB.Exec(
+		`UPDATE recalls c SET status='skipped' FROM recall_rules r
+         WHERE c.rule_id = r.id AND c.status = 'pending' AND ` + fmt.Sprintf(petBookedForRule, "c.pet_id"))
+	if err != nil {
+		utils.Error("Failed to skip booked recalls: %v", err)
+		return 0, err
+	}
+
+	today := clinicDay(time.Now().In(ClinicLocation)).Format("2006-01-02")
+	res, err := db.DB.Exec(
+		`WITH latest AS (
+             SELECT DISTINCT ON (v.pet_id, LOWER(v.vaccine)) v.pet_id, v.vaccine, v.next_due_on
+             FROM vaccinations v
+             WHERE v.deleted_at IS NULL
+             ORDER BY v.pet_id, LOWER(v.vaccine), v.administered_on DESC, v.id DESC
+         ),
+         last_visit AS (
+             SELECT a.pet_id, a.appointment_type_id, max((a.starts_at AT TIME ZONE $2)::date) AS visited
+             FROM appointments a
+             WHERE a.deleted_at IS NULL AND a.status = 'completed' AND a.appointment_type_id IS NOT NULL
+             GROUP BY a.pet_id, a.appointment_type_id
+         ),
+         due AS (
+             SELECT r.id AS rule_id, l.pet_id, min(l.next_due_on) AS due_on
+             FROM recall_rules r JOIN latest l ON r.vaccine = '' OR LOWER(l.vaccine) = LOWER(r.vaccine)
+             WHERE r.active AND r.kind = 'vaccination' AND l.next_due_on IS NOT NULL
+             GROUP BY r.id, l.pet_id
+             UNION ALL
+             SELECT r.id, lv.pet_id, (lv.visited + make_interval(months => r.interval_months))::date
+             FROM recall_rules r JOIN last_visit lv ON lv.appointment_type_id = r.appointment_type_id
+             WHERE r.active AND r.kind = 'checkup'
+         )
+         INSERT INTO recalls (rule_id, pet_id, due_on)
+         SELECT d.rule_id, d.pet_id, d.due_on
+         FROM due d
+         JOIN recall_rules r ON r.id = d.rule_id
+         JOIN pets p ON p.id = d.pet_id AND p.deleted_at IS NULL
+         JOIN owners ow ON ow.id = p.owner_id AND ow.deleted_at IS NULL
+         WHERE d.due_on <= $1::date + r.lead_days AND d.due_on >= $1::date - $3::int
+           AND NOT `+fmt.Sprintf(petBookedForRule, "d.pet_id")+`
+         ON CONFLICT ON CONSTRAINT recalls_unique DO NOTHING`,
+		today, ClinicLocation.String(), RecallMaxOverdueDays)
+	if err != nil {
+		utils.Error("Failed to generate recalls: %v", err)
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// DueRecall is a pending recall with what is needed to word and address it
+type DueRecall struct {
+	Recall
+	RuleName   string
+	Kind       string
+	Vaccine    string
+	TypeID     int
+	TypeName   string
+	PetName    string
+	OwnerName  string
+	OwnerEmail string
+	Contact    ContactPreferences
+}
+
+// PendingRecalls returns up to limit recalls waiting to be sent, oldest first. Recalls whose pet or owner
+// has been deleted since they were added are skipped rather than sent.
+func PendingRecalls(limit int) ([]DueRecall, error) {
+	due := []DueRecall{}
+	_, err := db.DB.Exec(
+		`UPDATE recalls c SET status='skipped' FROM pets p JOIN owners ow ON ow.id = p.owner_id
+         WHERE p.id = c.pet_id AND c.status = 'pending' AND (p.deleted_at IS NOT NULL OR ow.deleted_at IS NOT NULL)`)
+	if err != nil {
+		utils.Error("Failed to skip recalls of deleted pets: %v", err)
+		return due, err
+	}
+
+	rows, err := db.DB.Query(
+		`SELECT c.id, c.rule_id, c.pet_id, p.owner_id, c.due_on, c.status, c.sent_via, c.attempts, c.last_error,
+                c.sent_at, COALESCE(c.booked_appointment_id, 0), c.booked_at, c.created_at,
+                r.name, r.kind, r.vaccine, COALESCE(r.appointment_type_id, 0), COALESCE(t.name, ''), p.name, ow.name, ow.email,
+                COALESCE(cp.email, true), COALESCE(cp.sms, false), COALESCE(cp.phone, ''), COALESCE(cp.locale, '')
+         FROM recalls c
+         JOIN recall_rules r ON r.id = c.rule_id
+         JOIN pets p ON p.id = c.pet_id
+         JOIN owners ow ON ow.id = p.owner_id
+         LEFT JOIN appointment_types t ON t.id = r.appointment_type_id
+         LEFT JOIN owner_contact_preferences cp ON cp.owner_id = ow.id
+         WHERE c.status = 'pending' AND p.deleted_at IS NULL AND ow.deleted_at IS NULL
+         ORDER BY c.created_at, c.id LIMIT $1`, limit)
+	if err != nil {
+		utils.Error("Failed to fetch pending recalls: %v", err)
+		return due, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d DueRecall
+		err := scanRecall(rows, &d.Recall, &d.RuleName, &d.Kind, &d.Vaccine, &d.TypeID, &d.TypeName, &d.PetName,
+			&d.OwnerName, &d.OwnerEmail, &d.Contact.Email, &d.Contact.SMS, &d.Contact.Phone, &d.Contact.Locale)
+		if err != nil {
+			utils.Warn("Failed to scan pending recall row: %v", err)
+			continue
+		}
+		d.Contact.OwnerID = d.OwnerID
+		due = append(due, d)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in PendingRecalls: %v", err)
+	}
+	return due, err
+}
+
+// MarkRecallSent records that the recall went out over the given channels
+func MarkRecallSent(id int, via []string) error {
+	_, err := db.DB.Exec("UPDATE recalls SET status='sent', sent_via=$2, attempts=attempts+1, last_error='', sent_at=now() WHERE id=$1",
+		id, strings.Join(via, ","))
+	if err != nil {
+		utils.Error("MarkRecallSent DB error: %v", err)
+	}
+	return err
+}
+
+// MarkRecallFailed records a failed delivery; the recall is retried until MaxReminderAttempts
+func MarkRecallFailed(id int, sendErr error) error {
+	_, err := db.DB.Exec(
+		`UPDATE recalls SET attempts=attempts+1, last_error=$2,
+                status = CASE WHEN attempts+1 >= $3 THEN 'failed' ELSE status END
+         WHERE id=$1`, id, sendErr.Error(), MaxReminderAttempts)
+	if err != nil {
+		utils.Error("MarkRecallFailed DB error: %v", err)
+	}
+	return err
+}
+
+// MarkRecallNoContact leaves the recall for staff to follow up, as the owner cannot be reached automatically
+func MarkRecallNoContact(id int) error {
+	_, err := db.DB.Exec("UPDATE recalls SET status='no_contact' WHERE id=$1", id)
+	if err != nil {
+		utils.Error("MarkRecallNoContact DB error: %v", err)
+	}
+	return err
+}
+
+// creditRecalls marks the pet's open recalls as booked by a, if it is of the type they ask for (any type for
+// rules without one) and was made within RecallBookedWithinDays of the notice
+func creditRecalls(q db.Querier, a Appointment) error {
+	_, err := q.Exec(
+		`UPDATE recalls c SET booked_appointment_id=$1, booked_at=now() FROM recall_rules r
+         WHERE c.rule_id = r.id AND c.pet_id = $2 AND c.status IN ('sent', 'no_contact') AND c.booked_at IS NULL
+           AND COALESCE(c.sent_at, c.created_at) > now() - make_interval(days => $4)
+           AND (r.appointment_type_id IS NULL OR r.appointment_type_id = $3)`,
+		a.ID, a.PetID, nullID(a.TypeID), RecallBookedWithinDays)
+	return err
+}
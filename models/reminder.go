@@ -0,0 +1,229 @@
+package models
+
+import (
+	"petclinic/db"
+	"petclinic/utils"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Reminder channels
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// Reminder statuses
+const (
+	ReminderPending = "pending"
+	ReminderSent    = "sent"
+	ReminderFailed  = "failed"  // gave up after MaxReminderAttempts
+	ReminderSkipped = "skipped" // no longer needed: the appointment moved or was cancelled, or a later reminder superseded it
+)
+
+// MaxReminderAttempts is how many times a reminder is tried before it is marked failed
+const MaxReminderAttempts = 3
+
+// Reminder is one reminder of an appointment over one channel
+type Reminder struct {
+	ID                  int        `json:"id"`
+	AppointmentID       int        `json:"appointment_id"`
+	Channel             string     `json:"channel"`
+	Recipient           string     `json:"recipient"`
+	OffsetMinutes       int        `json:"offset_minutes"`        // how long before the start it is due
+	AppointmentStartsAt time.Time  `json:"appointment_starts_at"` // the start it reminds of
+	DueAt               time.Time  `json:"due_at"`
+	Status              string     `json:"status"`
+	Attempts            int        `json:"attempts"`
+	LastError           string     `json:"last_error,omitempty"`
+	SentAt              *time.Time `json:"sent_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// DueReminder is a pending reminder with what is needed to word it
+type DueReminder struct {
+	Reminder
+	OwnerName string
+	PetName   string
+	TypeName  string
+	Locale    string // the owner's chosen language, if any
+}
+
+// ReminderFilter narrows ListReminders; zero values are ignored
+type ReminderFilter struct {
+	AppointmentID int
+	Status        string
+	Channel       string
+}
+
+var reminderSortColumns = map[string]string{
+	"due_at":     "r.due_at",
+	"created_at": "r.created_at",
+}
+
+const reminderColumns = `SELECT r.id, r.appointment_id, r.channel, r.recipient, r.offset_minutes, r.appointment_starts_at, r.due_at,
+                r.status, r.attempts, r.last_error, r.sent_at, r.created_at
+         FROM appointment_reminders r`
+
+func scanReminder(row interface{ Scan(...interface{}) error }, r *Reminder, extra ...interface{}) error {
+	err := row.Scan(append([]interface{}{&r.ID, &r.AppointmentID, &r.Channel, &r.Recipient, &r.OffsetMinutes,
+		&r.AppointmentStartsAt, &r.DueAt, &r.Status, &r.Attempts, &r.LastError, &r.SentAt, &r.CreatedAt}, extra...)...)
+	r.AppointmentStartsAt = r.AppointmentStartsAt.In(ClinicLocation)
+	r.DueAt = r.DueAt.In(ClinicLocation)
+	return err
+}
+
+// ListReminders returns a page of reminders, most recently due first unless sorted otherwise
+func ListReminders(f ReminderFilter, opts ListOptions) (Page[Reminder], error) {
+	opts = opts.normalize()
+	page := Page[Reminder]{Items: []Reminder{}, Limit: opts.Limit, Offset: opts.Offset}
+	order, err := opts.orderBy(reminderSortColumns, "r.id", "-due_at")
+	if err != nil {
+		return page, err
+	}
+
+	var where whereBuilder
+	if f.AppointmentID != 0 {
+		where.add("r.appointment_id = ?", f.AppointmentID)
+	}
+	if f.Status != "" {
+		where.add("r.status = ?", f.Status)
+	}
+	if f.Channel != "" {
+		where.add("r.channel = ?", f.Channel)
+	}
+
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM appointment_reminders r"+where.String(), where.args...).Scan(&page.Total)
+	if err != nil {
+		utils.Error("Failed to count reminders: %v", err)
+		return page, err
+	}
+
+	limit, args := where.limitOffset(opts)
+	rows, err := db.DB.Query(reminderColumns+where.String()+order+limit, args...)
+	if err != nil {
+		utils.Error("Failed to fetch reminders: %v", err)
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r Reminder
+		if err := scanReminder(rows, &r); err != nil {
+			utils.Warn("Failed to scan reminder row: %v", err)
+			continue
+		}
+		page.Items = append(page.Items, r)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListReminders: %v", err)
+	}
+	return page, err
+}
+
+// QueueDueReminders skips pending reminders that are no longer needed and queues new ones for confirmed
+// appointments that have reached an offset before their start, over each channel the owner has turned on.
+// Offsets that had already passed when the appointment was booked are left out, and when several fall
+// due at once only the closest to the start is sent. Returns how many reminders were queued.
+func QueueDueReminders(offsets []time.Duration) (int, error) {
+	_, err := db.DB.Exec(
+		`UPDATE appointment_reminders r SET status='skipped'
+         FROM appointments a
+         WHERE r.appointment_id = a.id AND r.status = 'pending'
+           AND (a.deleted_at IS NOT NULL OR a.status <> 'confirmed' OR a.starts_at <> r.appointment_starts_at OR a.starts_at <= now())`)
+	if err != nil {
+		utils.Error("Failed to skip stale reminders: %v", err)
+		return 0, err
+	}
+
+	minutes := make([]int64, len(offsets))
+	for i, o := range offsets {
+		minutes[i] = int64(o / time.Minute)
+	}
+	res, err := db.DB.Exec(
+		`WITH due AS (
+             SELECT a.id, a.starts_at, o.minutes, a.starts_at - o.minutes * interval '1 minute' AS due_at,
+                    o.minutes > min(o.minutes) OVER (PARTITION BY a.id) AS superseded,
+                    ow.email, ow.id AS owner_id
+             FROM appointments a
+             JOIN pets p ON p.id = a.pet_id AND p.deleted_at IS NULL
+             JOIN owners ow ON ow.id = p.owner_id AND ow.deleted_at IS NULL
+             CROSS JOIN unnest($1::int[]) o(minutes)
+             WHERE a.deleted_at IS NULL AND a.status = 'confirmed' AND a.starts_at > now()
+               AND a.starts_at - o.minutes * interval '1 minute' <= now()
+               AND a.starts_at - o.minutes * interval '1 minute' >= COALESCE(
+                   (SELECT min(s.changed_at) FROM appointment_status_changes s WHERE s.appointment_id = a.id), '-infinity')
+         )
+         INSERT INTO appointment_reminders (appointment_id, channel, recipient, offset_minutes, appointment_starts_at, due_at, status)
+         SELECT d.id, c.channel, c.recipient, d.minutes, d.starts_at, d.due_at,
+                CASE WHEN d.superseded THEN 'skipped' ELSE 'pending' END
+         FROM due d
+         LEFT JOIN owner_contact_preferences cp ON cp.owner_id = d.owner_id
+         CROSS JOIN LATERAL (VALUES ('email', d.email, COALESCE(cp.email, true)),
+                                    ('sms', COALESCE(cp.phone, ''), COALESCE(cp.sms, false))) c(channel, recipient, enabled)
+         WHERE c.enabled AND c.recipient <> ''
+         ON CONFLICT ON CONSTRAINT appointment_reminders_unique DO NOTHING`,
+		pq.Array(minutes))
+	if err != nil {
+		utils.Error("Failed to queue reminders: %v", err)
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// PendingReminders returns up to limit reminders waiting to be sent, oldest due first
+func PendingReminders(limit int) ([]DueReminder, error) {
+	due := []DueReminder{}
+	rows, err := db.DB.Query(
+		`SELECT r.id, r.appointment_id, r.channel, r.recipient, r.offset_minutes, r.appointment_starts_at, r.due_at,
+                r.status, r.attempts, r.last_error, r.sent_at, r.created_at, ow.name, p.name, COALESCE(t.name, ''),
+                COALESCE(cp.locale, '')
+         FROM appointment_reminders r
+         JOIN appointments a ON a.id = r.appointment_id
+         JOIN pets p ON p.id = a.pet_id
+         JOIN owners ow ON ow.id = p.owner_id
+         LEFT JOIN appointment_types t ON t.id = a.appointment_type_id
+         LEFT JOIN owner_contact_preferences cp ON cp.owner_id = ow.id
+         WHERE r.status = 'pending' ORDER BY r.due_at, r.id LIMIT $1`, limit)
+	if err != nil {
+		utils.Error("Failed to fetch pending reminders: %v", err)
+		return due, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d DueReminder
+		if err := scanReminder(rows, &d.Reminder, &d.OwnerName, &d.PetName, &d.TypeName, &d.Locale); err != nil {
+			utils.Warn("Failed to scan pending reminder row: %v", err)
+			continue
+		}
+		due = append(due, d)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in PendingReminders: %v", err)
+	}
+	return due, err
+}
+
+// MarkReminderSent records a successful delivery
+func MarkReminderSent(id int) error {
+	_, err := db.DB.Exec("UPDATE appointment_reminders SET status='sent', attempts=attempts+1, last_error='', sent_at=now() WHERE id=$1", id)
+	if err != nil {
+		utils.Error("MarkReminderSent DB error: %v", err)
+	}
+	return err
+}
+
+// MarkReminderFailed records a failed delivery; the reminder is retried until MaxReminderAttempts
+func MarkReminderFailed(id int, sendErr error) error {
+	_, err := db.DB.Exec(
+		`UPDATE appointment_reminders SET attempts=attempts+1, last_error=$2,
+                status = CASE WHEN attempts+1 >= $3 THEN 'failed' ELSE status END
+         WHERE id=$1`, id, sendErr.Error(), MaxReminderAttempts)
+	if err != nil {
+		utils.Error("MarkReminderFailed DB error: %v", err)
+	}
+	return err
+}
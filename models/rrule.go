@@ -0,0 +1,197 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxOccurrences caps how many appointments one recurrence rule may produce
+const MaxOccurrences = 104
+
+// RRule is the subset of an RFC 5545 recurrence rule the clinic supports:
+// FREQ (DAILY, WEEKLY or MONTHLY), INTERVAL, COUNT or UNTIL, BYDAY (weekly) and BYMONTHDAY (monthly).
+type RRule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time // inclusive, date only
+	ByDay      []time.Weekday
+	ByMonthDay []int
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// ParseRRule parses a rule such as "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=8". An optional "RRULE:" prefix is allowed.
+// Exactly one of COUNT and UNTIL is required so every series ends.
+func ParseRRule(s string) (RRule, error) {
+	r := RRule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return r, fmt.Errorf("rule is empty")
+	}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return r, fmt.Errorf("malformed part %q", part)
+		}
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+			if r.Freq != "DAILY" && r.Freq != "WEEKLY" && r.Freq != "MONTHLY" {
+				return r, fmt.Errorf("FREQ must be DAILY, WEEKLY or MONTHLY")
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("INTERVAL must be a positive integer")
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("COUNT must be a positive integer")
+			}
+			r.Count = n
+		case "UNTIL":
+			// Date form (YYYYMMDD) or date-time form; only the date matters
+			if len(value) < 8 {
+				return r, fmt.Errorf("UNTIL must be YYYYMMDD")
+			}
+			d, err := time.Parse("20060102", value[:8])
+			if err != nil {
+				return r, fmt.Errorf("UNTIL must be YYYYMMDD")
+			}
+			r.Until = d
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(value), ",") {
+				wd, ok := rruleWeekdays[day]
+				if !ok {
+					return r, fmt.Errorf("BYDAY only supports plain weekdays (MO, TU, ...), got %q", day)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n < 1 || n > 31 {
+					return r, fmt.Errorf("BYMONTHDAY must be days 1 to 31")
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		default:
+			return r, fmt.Errorf("%s is not supported", name)
+		}
+	}
+
+	switch {
+	case r.Freq == "":
+		return r, fmt.Errorf("FREQ is required")
+	case (r.Count == 0) == r.Until.IsZero():
+		return r, fmt.Errorf("exactly one of COUNT and UNTIL is required")
+	case r.Count > MaxOccurrences:
+		return r, fmt.Errorf("COUNT must be at most %d", MaxOccurrences)
+	case len(r.ByDay) > 0 && r.Freq != "WEEKLY":
+		return r, fmt.Errorf("BYDAY is only supported with FREQ=WEEKLY")
+	case len(r.ByMonthDay) > 0 && r.Freq != "MONTHLY":
+		return r, fmt.Errorf("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	return r, nil
+}
+
+// Dates expands the rule from start (the first occurrence's date) into the dates of every occurrence,
+// returning an error if there would be more than MaxOccurrences
+func (r RRule) Dates(start time.Time) ([]time.Time, error) {
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	var dates []time.Time
+	// add reports whether expansion should continue after considering d
+	add := func(d time.Time) bool {
+		if d.Before(start) {
+			return true
+		}
+		if !r.Until.IsZero() && d.After(r.Until) {
+			return false
+		}
+		dates = append(dates, d)
+		return r.Count == 0 || len(dates) < r.Count
+	}
+	tooMany := fmt.Errorf("rule produces more than %d occurrences", MaxOccurrences)
+
+	switch r.Freq {
+	case "DAILY":
+		for d := start; add(d); d = d.AddDate(0, 0, r.Interval) {
+			if len(dates) > MaxOccurrences {
+				return nil, tooMany
+			}
+		}
+
+	case "WEEKLY":
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		// Weeks start on Monday (the RFC 5545 default WKST)
+		offsets := make([]int, len(days))
+		for i, wd := range days {
+			offsets[i] = (int(wd) + 6) % 7
+		}
+		sort.Ints(offsets)
+		week := start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+		for more := true; more; week = week.AddDate(0, 0, 7*r.Interval) {
+			for _, off := range offsets {
+				if more = add(week.AddDate(0, 0, off)); !more {
+					break
+				}
+			}
+			if len(dates) > MaxOccurrences {
+				return nil, tooMany
+			}
+		}
+
+	case "MONTHLY":
+		monthDays := r.ByMonthDay
+		if len(monthDays) == 0 {
+			monthDays = []int{start.Day()}
+		}
+		sort.Ints(monthDays)
+		month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+		// Months without any of the days are skipped, so give up on a rule whose days never come round,
+		// e.g. the 31st every 12 months from April, instead of looping forever
+		empty := 0
+		for more := true; more; month = month.AddDate(0, r.Interval, 0) {
+			if !r.Until.IsZero() && month.After(r.Until) {
+				break
+			}
+			found := false
+			for _, md := range monthDays {
+				d := month.AddDate(0, 0, md-1)
+				if d.Month() != month.Month() {
+					continue // e.g. the 31st in a 30-day month is skipped, as RFC 5545 does
+				}
+				found = true
+				if more = add(d); !more {
+					break
+				}
+			}
+			if len(dates) > MaxOccurrences {
+				return nil, tooMany
+			}
+			if found {
+				empty = 0
+			} else {
+				empty++
+			}
+			// The months visited repeat within 12 visits and a leap day comes round within 8 years, so 12
+			// empty months in a row means the days never will
+			if empty > 12 {
+				return nil, fmt.Errorf("BYMONTHDAY never falls in the months INTERVAL visits")
+			}
+		}
+	}
+	return dates, nil
+}
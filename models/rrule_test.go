@@ -0,0 +1,124 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestRRuleDates(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		start   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "daily count",
+			rule:  "FREQ=DAILY;INTERVAL=2;COUNT=3",
+			start: "2026-04-01",
+			want:  []string{"2026-04-01", "2026-04-03", "2026-04-05"},
+		},
+		{
+			name:  "weekly by day",
+			rule:  "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=4",
+			start: "2026-04-02", // a Thursday
+			want:  []string{"2026-04-02", "2026-04-06", "2026-04-09", "2026-04-13"},
+		},
+		{
+			name:  "every other week skips a week",
+			rule:  "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=WE;COUNT=3",
+			start: "2026-04-01",
+			want:  []string{"2026-04-01", "2026-04-15", "2026-04-29"},
+		},
+		{
+			name:  "until is inclusive",
+			rule:  "FREQ=WEEKLY;UNTIL=20260415",
+			start: "2026-04-01",
+			want:  []string{"2026-04-01", "2026-04-08", "2026-04-15"},
+		},
+		{
+			name:  "31st skips 30-day months",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=3",
+			start: "2026-03-31",
+			want:  []string{"2026-03-31", "2026-05-31", "2026-07-31"},
+		},
+		{
+			name:  "leap day every year",
+			rule:  "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=29;COUNT=2",
+			start: "2028-02-29",
+			want:  []string{"2028-02-29", "2032-02-29"},
+		},
+		{
+			name:    "month day that never comes round",
+			rule:    "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=31;COUNT=2",
+			start:   "2026-04-01",
+			wantErr: true,
+		},
+		{
+			name:    "month day that never comes round before until",
+			rule:    "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=31;UNTIL=20400101",
+			start:   "2026-04-01",
+			wantErr: true,
+		},
+		{
+			name:    "too many occurrences",
+			rule:    "FREQ=DAILY;UNTIL=20300101",
+			start:   "2026-04-01",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseRRule(tt.rule)
+			if err != nil {
+				t.Fatalf("ParseRRule(%q): %v", tt.rule, err)
+			}
+			got, err := r.Dates(date(tt.start))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Dates() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Dates(): %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Dates() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(date(tt.want[i])) {
+					t.Errorf("Dates()[%d] = %s, want %s", i, got[i].Format("2006-01-02"), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseRRuleErrors(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"FREQ=YEARLY;COUNT=2",
+		"FREQ=DAILY",
+		"FREQ=DAILY;COUNT=2;UNTIL=20260101",
+		"FREQ=DAILY;COUNT=1000",
+		"FREQ=DAILY;BYDAY=MO;COUNT=2",
+		"FREQ=WEEKLY;BYMONTHDAY=1;COUNT=2",
+		"FREQ=MONTHLY;BYMONTHDAY=32;COUNT=2",
+		"FREQ=WEEKLY;BYDAY=1MO;COUNT=2",
+		"FREQ=DAILY;INTERVAL=0;COUNT=2",
+	} {
+		if _, err := ParseRRule(rule); err == nil {
+			t.Errorf("ParseRRule(%q) succeeded, want an error", rule)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"petclinic/db"
+	"petclinic/utils"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// AppointmentType is a kind of visit, e.g. "vaccination" or "surgery consult", with its usual length
+type AppointmentType struct {
+	ID               int    `json:"id"`
+	Name             string `json:"name"`
+	DurationMinutes  int    `json:"duration_minutes"`
+	RequiresApproval bool   `json:"requires_approval"` // owner bookings wait for staff approval
+	PriceCents       int64  `json:"price_cents"`       // usual charge, used when invoicing an appointment
+}
+
+// Validate checks the appointment type's name and duration
+func (t AppointmentType) Validate() error {
+	var v ValidationError
+	v.check(strings.TrimSpace(t.Name) != "", "name", "is required")
+	v.check(t.DurationMinutes > 0, "duration_minutes", "must be positive")
+	v.check(t.PriceCents >= 0, "price_cents", "must not be negative")
+	return v.err()
+}
+
+// Kinds of weekly schedule block
+const (
+	BlockWorking = "working"
+	BlockBreak   = "break"
+)
+
+// ScheduleBlock is a recurring weekly stretch of a vet's time, either working hours or a break within them.
+// Starts and Ends are HH:MM clock times.
+type ScheduleBlock struct {
+	Weekday time.Weekday `json:"weekday"` // 0 = Sunday
+	Kind    string       `json:"kind"`
+	Starts  string       `json:"starts"`
+	Ends    string       `json:"ends"`
+}
+
+// DayOff is a date a vet is not working, e.g. holiday or training
+type DayOff struct {
+	ID     int       `json:"id"`
+	VetID  int       `json:"vet_id"`
+	Day    time.Time `json:"day"`
+	Reason string    `json:"reason"`
+}
+
+// Validate checks that the day off names a date
+func (d DayOff) Validate() error {
+	var v ValidationError
+	v.check(!d.Day.IsZero(), "day", "is required")
+	return v.err()
+}
+
+// Schedule is a vet's weekly hours and breaks, the appointment types they offer and their upcoming days off
+type Schedule struct {
+	VetID              int             `json:"vet_id"`
+	Blocks             []ScheduleBlock `json:"blocks"`
+	AppointmentTypeIDs []int           `json:"appointment_type_ids"`
+	DaysOff            []DayOff        `json:"days_off"` // read-only here; managed through the days-off endpoints
+}
+
+// Validate checks every block of the schedule
+func (s Schedule) Validate() error {
+	var v ValidationError
+	for _, b := range s.Blocks {
+		v.check(b.Weekday >= time.Sunday && b.Weekday <= time.Saturday, "blocks.weekday", "must be 0 (Sunday) to 6 (Saturday)")
+		v.check(b.Kind == BlockWorking || b.Kind == BlockBreak, "blocks.kind", "must be working or break")
+		starts, okStart := clockMinutes(b.Starts)
+		ends, okEnd := clockMinutes(b.Ends)
+		v.check(okStart, "blocks.starts", "must be HH:MM")
+		v.check(okEnd, "blocks.ends", "must be HH:MM")
+		if okStart && okEnd {
+			v.check(starts < ends, "blocks.ends", "must be after starts")
+		}
+	}
+	return v.err()
+}
+
+// clockTime matches an HH:MM or HH:MM:SS clock time
+var clockTime = regexp.MustCompile(`^([01]?[0-9]|2[0-3]):[0-5][0-9](:[0-5][0-9])?$`)
+
+// clockMinutes parses an HH:MM (or HH:MM:SS) clock time into minutes after midnight
+func clockMinutes(s string) (int, bool) {
+	if !clockTime.MatchString(s) {
+		return 0, false
+	}
+	layout := "15:04"
+	if strings.Count(s, ":") == 2 {
+		layout = "15:04:05"
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// ErrUnknownAppointmentType is returned when an appointment or schedule names an appointment type that does not exist
+var ErrUnknownAppointmentType = errors.New("unknown appointment type")
+
+// ListAppointmentTypes returns every appointment type by name
+func ListAppointmentTypes() ([]AppointmentType, error) {
+	types := []AppointmentType{}
+	rows, err := db.DB.Query("SELECT id, name, duration_minutes, requires_approval, price_cents FROM appointment_types ORDER BY name")
+	if err != nil {
+		utils.Error("Failed to fetch appointment types: %v", err)
+		return types, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t AppointmentType
+		if err := rows.Scan(&t.ID, &t.Name, &t.DurationMinutes, &t.RequiresApproval, &t.PriceCents); err != nil {
+			utils.Warn("Failed to scan appointment type row: %v", err)
+			continue
+		}
+		types = append(types, t)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListAppointmentTypes: %v", err)
+	}
+	return types, err
+}
+
+// GetAppointmentTypeByID returns the appointment type, or nil if there is none
+func GetAppointmentTypeByID(id int) (*AppointmentType, error) {
+	var t AppointmentType
+	err := db.DB.QueryRow("SELECT id, name, duration_minutes, requires_approval, price_cents FROM appointment_types WHERE id=$1", id).
+		Scan(&t.ID, &t.Name, &t.DurationMinutes, &t.RequiresApproval, &t.PriceCents)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		utils.Error("GetAppointmentTypeByID DB error: %v", err)
+		return nil, err
+	}
+	return &t, nil
+}
+
+// AddAppointmentType stores a new appointment type
+func AddAppointmentType(t AppointmentType) (AppointmentType, error) {
+	err := db.DB.QueryRow("INSERT INTO appointment_types (name, duration_minutes, requires_approval, price_cents) VALUES ($1, $2, $3, $4) RETURNING id",
+		t.Name, t.DurationMinutes, t.RequiresApproval, t.PriceCents).Scan(&t.ID)
+	if err != nil {
+		utils.Error("AddAppointmentType DB error: %v", err)
+	}
+	return t, err
+}
+
+// UpdateAppointmentType changes an appointment type's name, duration, approval requirement or price.
+// Existing appointments keep their own duration and status.
+func UpdateAppointmentType(t AppointmentType) error {
+	_, err := db.DB.Exec("UPDATE appointment_types SET name=$1, duration_minutes=$2, requires_approval=$3, price_cents=$4 WHERE id=$5",
+		t.Name, t.DurationMinutes, t.RequiresApproval, t.PriceCents, t.ID)
+	if err != nil {
+		utils.Error("UpdateAppointmentType DB error: %v", err)
+	}
+	return err
+}
+
+// FillDuration gives an appointment booked without a duration the length of its type, or
+// DefaultAppointmentMinutes if it has none. Returns a *ValidationError for an unknown type.
+func FillDuration(a *Appointment) error {
+	if a.TypeID != 0 {
+		t, err := GetAppointmentTypeByID(a.TypeID)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return &ValidationError{Fields: map[string]string{"appointment_type_id": "does not exist"}}
+		}
+		if a.DurationMinutes == 0 {
+			a.DurationMinutes = t.DurationMinutes
+		}
+	}
+	if a.DurationMinutes == 0 {
+		a.DurationMinutes = DefaultAppointmentMinutes
+	}
+	return nil
+}
+
+// VetOffersType reports whether the vet is set up to see appointments of the given type
+func VetOffersType(vetID, typeID int) (bool, error) {
+	var ok bool
+	err := db.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM vet_appointment_types WHERE vet_id=$1 AND appointment_type_id=$2)",
+		vetID, typeID).Scan(&ok)
+	if err != nil {
+		utils.Error("VetOffersType DB error: %v", err)
+	}
+	return ok, err
+}
+
+// GetSchedule returns the vet's weekly blocks, appointment types and days off from today on
+func GetSchedule(vetID int) (Schedule, error) {
+	s := Schedule{VetID: vetID, Blocks: []ScheduleBlock{}, AppointmentTypeIDs: []int{}, DaysOff: []DayOff{}}
+
+	blocks, err := scheduleBlocks([]int{vetID})
+	if err != nil {
+		return s, err
+	}
+	if blocks[vetID] != nil {
+		s.Blocks = blocks[vetID]
+	}
+
+	rows, err := db.DB.Query("SELECT appointment_type_id FROM vet_appointment_types WHERE vet_id=$1 ORDER BY appointment_type_id", vetID)
+	if err != nil {
+		utils.Error("Failed to fetch vet appointment types: %v", err)
+		return s, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			utils.Warn("Failed to scan vet appointment type row: %v", err)
+			continue
+		}
+		s.AppointmentTypeIDs = append(s.AppointmentTypeIDs, id)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in GetSchedule: %v", err)
+		return s, err
+	}
+
+	s.DaysOff, err = ListDaysOff(vetID, clinicDay(time.Now().In(ClinicLocation)), time.Time{})
+	return s, err
+}
+
+// ReplaceSchedule swaps the vet's weekly blocks and appointment types for those in s, in one transaction.
+// Returns ErrUnknownAppointmentType if s names a type that does not exist.
+func ReplaceSchedule(s Schedule) error {
+	err := db.WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM vet_hours WHERE vet_id=$1", s.VetID); err != nil {
+			return err
+		}
+		for _, b := range s.Blocks {
+			_, err := tx.Exec("INSERT INTO vet_hours (vet_id, weekday, kind, starts, ends) VALUES ($1, $2, $3, $4, $5)",
+				s.VetID, int(b.Weekday), b.Kind, b.Starts, b.Ends)
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM vet_appointment_types WHERE vet_id=$1", s.VetID); err != nil {
+			return err
+		}
+		for _, typeID := range s.AppointmentTypeIDs {
+			_, err := tx.Exec("INSERT INTO vet_appointment_types (vet_id, appointment_type_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+				s.VetID, typeID)
+			if isForeignKeyViolation(err) {
+				return ErrUnknownAppointmentType
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.Error("ReplaceSchedule DB error: %v", err)
+	}
+	return err
+}
+
+// scheduleBlocks returns the weekly blocks of each listed vet, keyed by vet ID, ordered by weekday and start
+func scheduleBlocks(vetIDs []int) (map[int][]ScheduleBlock, error) {
+	blocks := map[int][]ScheduleBlock{}
+	rows, err := db.DB.Query(
+		"SELECT vet_id, weekday, kind, to_char(starts, 'HH24:MI'), to_char(ends, 'HH24:MI') FROM vet_hours WHERE vet_id = ANY($1) ORDER BY vet_id, weekday, starts",
+		pq.Array(vetIDs))
+	if err != nil {
+		utils.Error("Failed to fetch vet hours: %v", err)
+		return blocks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vetID int
+		var b ScheduleBlock
+		if err := rows.Scan(&vetID, &b.Weekday, &b.Kind, &b.Starts, &b.Ends); err != nil {
+			utils.Warn("Failed to scan vet hours row: %v", err)
+			continue
+		}
+		blocks[vetID] = append(blocks[vetID], b)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in scheduleBlocks: %v", err)
+	}
+	return blocks, err
+}
+
+// ListDaysOff returns the vet's days off between from and to inclusive; a zero to means no upper bound
+func ListDaysOff(vetID int, from, to time.Time) ([]DayOff, error) {
+	days := []DayOff{}
+	var where whereBuilder
+	where.add("vet_id = ?", vetID)
+	where.add("day >= ?", from)
+	if !to.IsZero() {
+		where.add("day <= ?", to)
+	}
+	rows, err := db.DB.Query("SELECT id, vet_id, day, reason FROM vet_days_off"+where.String()+" ORDER BY day", where.args...)
+	if err != nil {
+		utils.Error("Failed to fetch days off: %v", err)
+		return days, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d DayOff
+		if err := rows.Scan(&d.ID, &d.VetID, &d.Day, &d.Reason); err != nil {
+			utils.Warn("Failed to scan day off row: %v", err)
+			continue
+		}
+		days = append(days, d)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListDaysOff: %v", err)
+	}
+	return days, err
+}
+
+// ErrDuplicateDayOff is returned when the vet already has that day off
+var ErrDuplicateDayOff = errors.New("vet already has that day off")
+
+// AddDayOff records a day the vet is not working
+func AddDayOff(d DayOff) (DayOff, error) {
+	err := db.DB.QueryRow("INSERT INTO vet_days_off (vet_id, day, reason) VALUES ($1, $2, $3) RETURNING id",
+		d.VetID, d.Day, d.Reason).Scan(&d.ID)
+	if isUniqueViolation(err, "vet_days_off_vet_id_day_key") {
+		return d, ErrDuplicateDayOff
+	}
+	if err != nil {
+		utils.Error("AddDayOff DB error: %v", err)
+	}
+	return d, err
+}
+
+// DeleteDayOff removes one of the vet's days off, reporting whether it existed
+func DeleteDayOff(vetID, id int) (bool, error) {
+	res, err := db.DB.Exec("DELETE FROM vet_days_off WHERE id=$1 AND vet_id=$2", id, vetID)
+	if err != nil {
+		utils.Error("DeleteDayOff DB error: %v", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
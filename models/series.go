@@ -0,0 +1,270 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"petclinic/db"
+	"petclinic/utils"
+	"time"
+)
+
+// Series is a recurring appointment: the rule it repeats by and the appointments it produced
+type Series struct {
+	ID           int           `json:"id"`
+	RRule        string        `json:"rrule"`
+	PetID        int           `json:"pet_id"`
+	CreatedBy    int           `json:"created_by"`
+	CreatedAt    time.Time     `json:"created_at"`
+	Appointments []Appointment `json:"appointments"`
+
+	Skipped []OccurrenceConflict `json:"skipped,omitempty"` // occurrences left out because their slot was taken
+}
+
+// OccurrenceConflict is an occurrence of a series that overlaps an existing booking
+type OccurrenceConflict struct {
+	StartsAt time.Time    `json:"starts_at"`
+	Date     time.Time    `json:"date"` // clinic-local start date and HH:MM time, for older clients
+	Time     string       `json:"time"`
+	Conflict *Appointment `json:"conflict,omitempty"`
+}
+
+func occurrenceConflict(a Appointment, conflict *ScheduleConflictError) OccurrenceConflict {
+	return OccurrenceConflict{StartsAt: a.StartsAt, Date: a.Date, Time: a.Time, Conflict: conflict.Conflict}
+}
+
+// SeriesConflictError is returned when occurrences of a series overlap existing bookings
+type SeriesConflictError struct {
+	Conflicts []OccurrenceConflict
+}
+
+func (e *SeriesConflictError) Error() string {
+	return fmt.Sprintf("%d occurrence(s) overlap existing bookings", len(e.Conflicts))
+}
+
+// SeriesChanges are the fields that can be changed on every upcoming occurrence of a series at once;
+// nil fields are left alone. Time is a clinic-local clock time applied to each occurrence's own date.
+type SeriesChanges struct {
+	Time            *string `json:"time"`
+	DurationMinutes *int    `json:"duration_minutes"`
+	VetID           *int    `json:"vet_id"`
+	Room            *string `json:"room"`
+	Reason          *string `json:"reason"`
+}
+
+// apply copies the changed fields onto a, keeping its date. An unparseable time is returned as a
+// *ValidationError.
+func (c SeriesChanges) apply(a *Appointment) error {
+	if c.Time != nil {
+		minutes, ok := ParseClock(*c.Time)
+		if !ok {
+			return &ValidationError{Fields: map[string]string{"time": "must be a clock time such as 09:30 or 9:30 am"}}
+		}
+		a.StartsAt = atClock(a.StartsAt.In(ClinicLocation), minutes)
+	}
+	if c.DurationMinutes != nil {
+		a.DurationMinutes = *c.DurationMinutes
+	}
+	a.EndsAt = a.StartsAt.Add(time.Duration(a.DurationMinutes) * time.Minute)
+	if c.VetID != nil {
+		a.VetID = *c.VetID
+	}
+	if c.Room != nil {
+		a.Room = *c.Room
+	}
+	if c.Reason != nil {
+		a.Reason = *c.Reason
+	}
+	a.fillLegacyTimes()
+	return nil
+}
+
+// withSavepoint runs fn so that a failure inside it can be rolled back without aborting the whole transaction
+func withSavepoint(tx *sql.Tx, fn func() error) error {
+	if _, err := tx.Exec("SAVEPOINT occurrence"); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := tx.Exec("ROLLBACK TO SAVEPOINT occurrence"); rbErr != nil {
+			return rbErr
+		}
+		return err
+	}
+	_, err := tx.Exec("RELEASE SAVEPOINT occurrence")
+	return err
+}
+
+// CreateSeries books first and its repeats under the recurrence rule, all in one transaction. Each
+// occurrence starts at the same clinic-local clock time as first, across daylight saving changes. Every
+// occurrence is checked for conflicts; if any overlap an existing booking a *SeriesConflictError lists
+// them and nothing is created, unless skipConflicts is set, in which case the free occurrences are booked
+// and the rest reported in Skipped. An invalid rule is returned as a *ValidationError.
+func CreateSeries(first Appointment, rrule string, createdBy int, skipConflicts bool) (Series, error) {
+	s := Series{RRule: rrule, PetID: first.PetID, CreatedBy: createdBy, Appointments: []Appointment{}}
+	rule, err := ParseRRule(rrule)
+	if err != nil {
+		return s, &ValidationError{Fields: map[string]string{"rrule": err.Error()}}
+	}
+	first.fillLegacyTimes()
+	start := first.StartsAt
+	length := first.EndsAt.Sub(first.StartsAt)
+	dates, err := rule.Dates(clinicDay(start))
+	if err != nil {
+		return s, &ValidationError{Fields: map[string]string{"rrule": err.Error()}}
+	}
+
+	err = db.WithTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow("INSERT INTO appointment_series (rrule, pet_id, created_by) VALUES ($1, $2, $3) RETURNING id, created_at",
+			rrule, first.PetID, nullID(createdBy)).Scan(&s.ID, &s.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range dates {
+			a := first
+			a.StartsAt = time.Date(d.Year(), d.Month(), d.Day(), start.Hour(), start.Minute(), 0, 0, ClinicLocation)
+			a.EndsAt = a.StartsAt.Add(length)
+			a.fillLegacyTimes()
+			a.SeriesID = s.ID
+			var created Appointment
+			err := withSavepoint(tx, func() error {
+				var err error
+				created, err = AddAppointmentTx(tx, a)
+				return err
+			})
+			var conflict *ScheduleConflictError
+			if errors.As(err, &conflict) {
+				s.Skipped = append(s.Skipped, occurrenceConflict(a, conflict))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			s.Appointments = append(s.Appointments, created)
+		}
+
+		if len(s.Skipped) > 0 && (!skipConflicts || len(s.Appointments) == 0) {
+			return &SeriesConflictError{Conflicts: s.Skipped}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.Warn("CreateSeries rolled back: %v", err)
+	}
+	return s, err
+}
+
+// GetSeries returns the series with its live appointments in start order, or nil if there is none
+func GetSeries(id int) (*Series, error) {
+	s := Series{Appointments: []Appointment{}}
+	err := db.DB.QueryRow("SELECT id, rrule, pet_id, COALESCE(created_by, 0), created_at FROM appointment_series WHERE id=$1", id).
+		Scan(&s.ID, &s.RRule, &s.PetID, &s.CreatedBy, &s.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		utils.Error("GetSeries DB error: %v", err)
+		return nil, err
+	}
+
+	rows, err := db.DB.Query(appointmentColumns+" WHERE a.series_id=$1 AND "+appointmentLive+" ORDER BY a.starts_at, a.id", id)
+	if err != nil {
+		utils.Error("Failed to fetch series appointments: %v", err)
+		return nil, err
+	}
+	if items := scanAppointments(rows, "GetSeries"); items != nil {
+		s.Appointments = items
+	}
+	return &s, nil
+}
+
+// upcomingOccurrences locks and returns the series' appointments from today on that have not happened yet
+func upcomingOccurrences(tx *sql.Tx, seriesID int) ([]Appointment, error) {
+	today := clinicDay(time.Now().In(ClinicLocation))
+	rows, err := tx.Query(appointmentColumns+" WHERE a.series_id=$1 AND "+appointmentLive+
+		" AND a.status IN ('requested', 'confirmed') AND a.starts_at >= $2 ORDER BY a.starts_at, a.id FOR UPDATE OF a", seriesID, today)
+	if err != nil {
+		return nil, err
+	}
+	return scanAppointments(rows, "upcomingOccurrences"), nil
+}
+
+// UpdateSeries applies the changes to every upcoming occurrence of the series in one transaction and
+// returns the updated occurrences. If any would overlap an existing booking, nothing changes and a
+// *SeriesConflictError lists them; an invalid result is returned as a *ValidationError.
+func UpdateSeries(id int, changes SeriesChanges) ([]Appointment, error) {
+	updated := []Appointment{}
+	err := db.WithTx(func(tx *sql.Tx) error {
+		occurrences, err := upcomingOccurrences(tx, id)
+		if err != nil {
+			return err
+		}
+
+		var conflicts []OccurrenceConflict
+		for _, a := range occurrences {
+			if err := changes.apply(&a); err != nil {
+				return err
+			}
+			if err := a.Validate(); err != nil {
+				return err
+			}
+			err := withSavepoint(tx, func() error {
+				return tx.QueryRow(
+					`UPDATE appointments SET starts_at=$1, ends_at=$2, vet_id=$3, room=$4, reason=$5, version=version+1
+                     WHERE id=$6 RETURNING version`,
+					a.StartsAt, a.EndsAt, nullID(a.VetID), a.Room, a.Reason, a.ID).Scan(&a.Version)
+			})
+			if isExclusionViolation(err) {
+				var conflict *ScheduleConflictError
+				errors.As(scheduleConflict(err, a), &conflict)
+				conflicts = append(conflicts, occurrenceConflict(a, conflict))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			updated = append(updated, a)
+		}
+
+		if len(conflicts) > 0 {
+			return &SeriesConflictError{Conflicts: conflicts}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.Warn("UpdateSeries rolled back: %v", err)
+	}
+	return updated, err
+}
+
+// CancelSeries cancels every upcoming occurrence of the series, recording the change against cancelledBy,
+// and returns how many were cancelled. Past and already finished occurrences are left alone. The freed
+// slots are offered to the waitlist.
+func CancelSeries(id, cancelledBy int, note string) (int, error) {
+	var cancelled []int
+	err := db.WithTx(func(tx *sql.Tx) error {
+		occurrences, err := upcomingOccurrences(tx, id)
+		if err != nil {
+			return err
+		}
+		for _, a := range occurrences {
+			_, err := tx.Exec("UPDATE appointments SET status=$1, version=version+1 WHERE id=$2", StatusCancelled, a.ID)
+			if err != nil {
+				return err
+			}
+			if err := recordStatusChange(tx, a.ID, a.Status, StatusCancelled, cancelledBy, note); err != nil {
+				return err
+			}
+			cancelled = append(cancelled, a.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		utils.Error("CancelSeries DB error: %v", err)
+		return 0, err
+	}
+	for _, aptID := range cancelled {
+		offerFreedSlot(aptID)
+	}
+	return len(cancelled), nil
+}
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"petclinic/db"
+	"petclinic/utils"
+	"strings"
+	"time"
+)
+
+// TrashItem is a soft-deleted row awaiting restore or purge
+type TrashItem struct {
+	Kind      string    `json:"kind"`
+	ID        int       `json:"id"`
+	Label     string    `json:"label"`
+	DeletedAt time.Time `json:"deleted_at"`
+	DeletedBy int       `json:"deleted_by"`
+}
+
+// trashTable describes how a soft-deletable table is shown in the trash
+type trashTable struct {
+	table     string
+	label     string // SQL expression used as the item's label
+	parent    string // kind of the row this one belongs to, which must be live for it to be restored
+	parentKey string // column referencing the parent
+}
+
+// trashTables maps the kinds accepted by the trash endpoints onto their tables
+var trashTables = map[string]trashTable{
+	"owners":       {table: "owners", label: "name"},
+	"pets":         {table: "pets", label: "name", parent: "owners", parentKey: "owner_id"},
+	"appointments": {table: "appointments", label: "to_char(starts_at, 'YYYY-MM-DD HH24:MI TZ') || ' ' || reason", parent: "pets", parentKey: "pet_id"},
+	"vaccinations": {table: "vaccinations", label: "vaccine || ' ' || to_char(administered_on, 'YYYY-MM-DD')", parent: "pets", parentKey: "pet_id"},
+}
+
+// UnknownKindError is returned for a trash kind that is not soft-deletable
+type UnknownKindError struct {
+	Kind string
+}
+
+func (e *UnknownKindError) Error() string {
+	return fmt.Sprintf("unknown kind %q", e.Kind)
+}
+
+// ParentDeletedError is returned when restoring a row whose parent (a pet's owner, an appointment's or
+// vaccination's pet) is itself still in the trash
+type ParentDeletedError struct {
+	Kind     string `json:"kind"`
+	ParentID int    `json:"id"`
+}
+
+func (e *ParentDeletedError) Error() string {
+	return fmt.Sprintf("%s %d is in the trash; restore it first", strings.TrimSuffix(e.Kind, "s"), e.ParentID)
+}
+
+// ListTrash returns the soft-deleted rows of one kind, most recently deleted first
+func ListTrash(kind string, opts ListOptions) (Page[TrashItem], error) {
+	opts = opts.normalize()
+	page := Page[TrashItem]{Items: []TrashItem{}, Limit: opts.Limit, Offset: opts.Offset}
+	t, ok := trashTables[kind]
+	if !ok {
+		return page, &UnknownKindError{Kind: kind}
+	}
+
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM " + t.table + " WHERE deleted_at IS NOT NULL").Scan(&page.Total)
+	if err != nil {
+		utils.Error("Failed to count deleted %s: %v", kind, err)
+		return page, err
+	}
+
+	rows, err := db.DB.Query(
+		"SELECT id, "+t.label+", deleted_at, COALESCE(deleted_by, 0) FROM "+t.table+
+			" WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC LIMIT $1 OFFSET $2",
+		opts.Limit, opts.Offset)
+	if err != nil {
+		utils.Error("Failed to fetch deleted %s: %v", kind, err)
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := TrashItem{Kind: kind}
+		err := rows.Scan(&item.ID, &item.Label, &item.DeletedAt, &item.DeletedBy)
+		if err != nil {
+			utils.Warn("Failed to scan trash row: %v", err)
+			continue
+		}
+		page.Items = append(page.Items, item)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListTrash: %v", err)
+	}
+	return page, err
+}
+
+// Restore undeletes a soft-deleted row. Returns false if no deleted row of that kind has the ID, and a
+// *ParentDeletedError if the row it belongs to is still deleted.
+func Restore(kind string, id int) (bool, error) {
+	t, ok := trashTables[kind]
+	if !ok {
+		return false, &UnknownKindError{Kind: kind}
+	}
+	restored := false
+	var parentErr error
+	err := db.WithTx(func(tx *sql.Tx) error {
+		if t.parent != "" {
+			// Lock the parent so it cannot be deleted while its child comes back
+			var parentID int
+			var parentDeleted bool
+			err := tx.QueryRow(
+				"SELECT p.id, p.deleted_at IS NOT NULL FROM "+t.table+" c JOIN "+trashTables[t.parent].table+" p ON p.id = c."+t.parentKey+
+					" WHERE c.id=$1 AND c.deleted_at IS NOT NULL FOR SHARE OF p", id).Scan(&parentID, &parentDeleted)
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if parentDeleted {
+				parentErr = &ParentDeletedError{Kind: t.parent, ParentID: parentID}
+				return nil
+			}
+		}
+		res, err := tx.Exec("UPDATE "+t.table+" SET deleted_at=NULL, deleted_by=NULL, version=version+1 WHERE id=$1 AND deleted_at IS NOT NULL", id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		restored = n == 1
+		return err
+	})
+	if isExclusionViolation(err) {
+		// Its slot was booked by someone else while it was in the trash
+		return false, &ScheduleConflictError{}
+	}
+	if err != nil {
+		utils.Error("Restore %s DB error: %v", kind, err)
+		return false, err
+	}
+	return restored, parentErr
+}
+
+// PurgeDeleted permanently removes rows soft-deleted before cutoff, and purged uploads from disk. Rows still
+// referenced by live children (e.g. a deleted pet with active appointments) are kept until the children go.
+func PurgeDeleted(cutoff time.Time) (int64, error) {
+	paths, err := purgeFiles(cutoff)
+	if err != nil {
+		utils.Error("PurgeDeleted DB error: %v", err)
+		return 0, err
+	}
+	removeStoredFiles(paths)
+
+	statements := []string{
+		"DELETE FROM vaccinations WHERE deleted_at < $1",
+		"DELETE FROM appointments WHERE deleted_at < $1",
+		"DELETE FROM pets WHERE deleted_at < $1 AND NOT EXISTS (SELECT 1 FROM appointments a WHERE a.pet_id = pets.id)",
+		"DELETE FROM owners WHERE deleted_at < $1 AND NOT EXISTS (SELECT 1 FROM pets p WHERE p.owner_id = owners.id)" +
+			" AND NOT EXISTS (SELECT 1 FROM invoices i WHERE i.owner_id = owners.id)",
+	}
+	total := int64(len(paths))
+	for _, stmt := range statements {
+		res, err := db.DB.Exec(stmt, cutoff)
+		if err != nil {
+			utils.Error("PurgeDeleted DB error: %v", err)
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
+
+// purgeFiles removes the file records soft-deleted before cutoff, returning where the files were stored
+func purgeFiles(cutoff time.Time) ([]string, error) {
+	var paths []string
+	rows, err := db.DB.Query("DELETE FROM files WHERE deleted_at < $1 RETURNING path", cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
@@ -28,3 +28,19 @@ func GetUserByEmail(email string) (*User, error) {
 	}
 	return &u, nil
 }
+
+// GetUserByID fetches a user by ID, returning nil if there is none
+func GetUserByID(id int) (*User, error) {
+	var u User
+	err := db.DB.QueryRow("SELECT id, email, password, role FROM users WHERE id=$1", id).
+		Scan(&u.ID, &u.Email, &u.Password, &u.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.Warn("No user found with id: %d", id)
+			return nil, nil
+		}
+		utils.Error("GetUserByID error: %v", err)
+		return nil, err
+	}
+	return &u, nil
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"database/sql"
+	"petclinic/db"
+	"petclinic/utils"
+	"strings"
+	"time"
+)
+
+// Vaccination is one vaccine dose given to a pet
+type Vaccination struct {
+	ID             int        `json:"id"`
+	PetID          int        `json:"pet_id"`
+	Vaccine        string     `json:"vaccine"`
+	LotNumber      string     `json:"lot_number"`
+	AdministeredOn time.Time  `json:"administered_on"`
+	AdministeredBy int        `json:"administered_by"` // user ID of the vet
+	NextDueOn      *time.Time `json:"next_due_on,omitempty"`
+	Notes          string     `json:"notes"`
+	Version        int        `json:"version"`
+}
+
+// Validate checks the fields required to store a vaccination
+func (v Vaccination) Validate() error {
+	var e ValidationError
+	e.check(v.PetID > 0, "pet_id", "is required")
+	e.check(strings.TrimSpace(v.Vaccine) != "", "vaccine", "is required")
+	e.check(!v.AdministeredOn.IsZero(), "administered_on", "is required")
+	if v.NextDueOn != nil {
+		e.check(v.NextDueOn.After(v.AdministeredOn), "next_due_on", "must be after administered_on")
+	}
+	return e.err()
+}
+
+const vaccinationColumns = "SELECT id, pet_id, vaccine, lot_number, administered_on, COALESCE(administered_by, 0), next_due_on, notes, version FROM vaccinations"
+
+func scanVaccination(row interface{ Scan(...interface{}) error }) (Vaccination, error) {
+	var v Vaccination
+	var next sql.NullTime
+	err := row.Scan(&v.ID, &v.PetID, &v.Vaccine, &v.LotNumber, &v.AdministeredOn, &v.AdministeredBy, &next, &v.Notes, &v.Version)
+	if next.Valid {
+		v.NextDueOn = &next.Time
+	}
+	return v, err
+}
+
+var vaccinationSortColumns = map[string]string{
+	"id":              "id",
+	"vaccine":         "vaccine",
+	"administered_on": "administered_on",
+	"next_due_on":     "next_due_on",
+}
+
+// ListVaccinations returns one page of a pet's vaccinations, most recent first by default
+func ListVaccinations(petID int, opts ListOptions) (Page[Vaccination], error) {
+	opts = opts.normalize()
+	page := Page[Vaccination]{Items: []Vaccination{}, Limit: opts.Limit, Offset: opts.Offset}
+	order, err := opts.orderBy(vaccinationSortColumns, "id", "-administered_on")
+	if err != nil {
+		return page, err
+	}
+
+	var where whereBuilder
+	where.addExpr("deleted_at IS NULL")
+	where.add("pet_id = ?", petID)
+
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM vaccinations"+where.String(), where.args...).Scan(&page.Total)
+	if err != nil {
+		utils.Error("Failed to count vaccinations: %v", err)
+		return page, err
+	}
+
+	limit, args := where.limitOffset(opts)
+	rows, err := db.DB.Query(vaccinationColumns+where.String()+order+limit, args...)
+	if err != nil {
+		utils.Error("Failed to fetch vaccinations: %v", err)
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v, err := scanVaccination(rows)
+		if err != nil {
+			utils.Warn("Failed to scan vaccination row: %v", err)
+			continue
+		}
+		page.Items = append(page.Items, v)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListVaccinations: %v", err)
+	}
+	return page, err
+}
+
+// GetVaccinationByID returns the pet's vaccination with the given ID, or nil if there is none
+func GetVaccinationByID(petID, id int) (*Vaccination, error) {
+	v, err := scanVaccination(db.DB.QueryRow(vaccinationColumns+" WHERE id=$1 AND pet_id=$2 AND deleted_at IS NULL", id, petID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.Warn("No vaccination %d found for pet %d", id, petID)
+			return nil, nil
+		}
+		utils.Error("GetVaccinationByID DB error: %v", err)
+		return nil, err
+	}
+	return &v, nil
+}
+
+// AddVaccination records a vaccination and returns it with its ID
+func AddVaccination(v Vaccination) (Vaccination, error) {
+	err := db.DB.QueryRow(
+		`INSERT INTO vaccinations (pet_id, vaccine, lot_number, administered_on, administered_by, next_due_on, notes)
+         VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, version`,
+		v.PetID, v.Vaccine, v.LotNumber, v.AdministeredOn, nullID(v.AdministeredBy), v.NextDueOn, v.Notes).
+		Scan(&v.ID, &v.Version)
+	if err != nil {
+		utils.Error("AddVaccination DB error: %v", err)
+	}
+	return v, err
+}
+
+// UpdateVaccination overwrites the vaccination if it is still at v.Version, otherwise returns ErrVersionConflict
+func UpdateVaccination(id int, v Vaccination) (Vaccination, error) {
+	err := db.DB.QueryRow(
+		`UPDATE vaccinations SET vaccine=$1, lot_number=$2, administered_on=$3, administered_by=$4, next_due_on=$5, notes=$6, version=version+1
+         WHERE id=$7 AND version=$8 AND deleted_at IS NULL RETURNING version`,
+		v.Vaccine, v.LotNumber, v.AdministeredOn, nullID(v.AdministeredBy), v.NextDueOn, v.Notes, id, v.Version).
+		Scan(&v.Version)
+	if err != nil {
+		utils.Error("UpdateVaccination DB error: %v", err)
+	}
+	v.ID = id
+	return v, versionConflict(err)
+}
+
+// DeleteVaccination soft-deletes the vaccination if it is still at the given version
+func DeleteVaccination(id, version, deletedBy int) error {
+	res, err := db.DB.Exec("UPDATE vaccinations SET deleted_at=now(), deleted_by=$3, version=version+1 WHERE id=$1 AND version=$2 AND deleted_at IS NULL", id, version, deletedBy)
+	if err == nil {
+		err = expectOneRow(res)
+	}
+	if err != nil {
+		utils.Error("DeleteVaccination DB error: %v", err)
+	}
+	return err
+}
+
+// DueVaccination is a pet whose latest dose of a vaccine is due for a booster
+type DueVaccination struct {
+	PetID       int       `json:"pet_id"`
+	PetName     string    `json:"pet_name"`
+	OwnerID     int       `json:"owner_id"`
+	Vaccine     string    `json:"vaccine"`
+	LastGivenOn time.Time `json:"last_given_on"`
+	NextDueOn   time.Time `json:"next_due_on"`
+	Overdue     bool      `json:"overdue"`
+}
+
+// ListDueVaccinations finds live pets whose most recent dose of each vaccine is overdue or falls due
+// on or before the given date. A later dose of the same vaccine supersedes earlier ones.
+func ListDueVaccinations(dueBy time.Time, opts ListOptions) (Page[DueVaccination], error) {
+	opts = opts.normalize()
+	page := Page[DueVaccination]{Items: []DueVaccination{}, Limit: opts.Limit, Offset: opts.Offset}
+
+	const latest = `WITH latest AS (
+            SELECT DISTINCT ON (v.pet_id, LOWER(v.vaccine))
+                   v.pet_id, p.name AS pet_name, p.owner_id, v.vaccine, v.administered_on, v.next_due_on
+            FROM vaccinations v
+            JOIN pets p ON p.id = v.pet_id
+            WHERE v.deleted_at IS NULL AND p.deleted_at IS NULL
+            ORDER BY v.pet_id, LOWER(v.vaccine), v.administered_on DESC, v.id DESC
+        )`
+
+	err := db.DB.QueryRow(latest+" SELECT COUNT(*) FROM latest WHERE next_due_on <= $1", dueBy).Scan(&page.Total)
+	if err != nil {
+		utils.Error("Failed to count due vaccinations: %v", err)
+		return page, err
+	}
+
+	rows, err := db.DB.Query(latest+`
+        SELECT pet_id, pet_name, owner_id, vaccine, administered_on, next_due_on, next_due_on < CURRENT_DATE
+        FROM latest WHERE next_due_on <= $1
+        ORDER BY next_due_on, pet_id LIMIT $2 OFFSET $3`, dueBy, opts.Limit, opts.Offset)
+	if err != nil {
+		utils.Error("Failed to fetch due vaccinations: %v", err)
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d DueVaccination
+		err := rows.Scan(&d.PetID, &d.PetName, &d.OwnerID, &d.Vaccine, &d.LastGivenOn, &d.NextDueOn, &d.Overdue)
+		if err != nil {
+			utils.Warn("Failed to scan due vaccination row: %v", err)
+			continue
+		}
+		page.Items = append(page.Items, d)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListDueVaccinations: %v", err)
+	}
+	return page, err
+}
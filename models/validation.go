@@ -0,0 +1,58 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidationError lists the fields of a model that failed validation, keyed by JSON field name
+type ValidationError struct {
+	Fields map[string]string `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s %s", name, e.Fields[name]))
+	}
+	return "invalid " + strings.Join(parts, ", ")
+}
+
+// check records msg against field when ok is false
+func (e *ValidationError) check(ok bool, field, msg string) {
+	if ok {
+		return
+	}
+	if e.Fields == nil {
+		e.Fields = map[string]string{}
+	}
+	e.Fields[field] = msg
+}
+
+// err returns e if any field failed, or nil
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// prefixFields namespaces the field names of a *ValidationError, e.g. "name" becomes "pet.name"
+func prefixFields(err error, prefix string) error {
+	var v *ValidationError
+	if !errors.As(err, &v) {
+		return err
+	}
+	out := &ValidationError{Fields: map[string]string{}}
+	for field, msg := range v.Fields {
+		out.Fields[prefix+field] = msg
+	}
+	return out
+}
@@ -0,0 +1,349 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"petclinic/db"
+	"petclinic/utils"
+	"time"
+)
+
+// Units accepted for weight and temperature. Values are stored in kg and °C.
+const (
+	Kilograms  = "kg"
+	Pounds     = "lb"
+	Celsius    = "C"
+	Fahrenheit = "F"
+)
+
+const poundsPerKilogram = 2.20462262
+
+// Vitals is one set of measurements taken for a pet. Every measurement is optional, but at least one
+// must be present. Weight and Temperature are expressed in WeightUnit and TemperatureUnit.
+type Vitals struct {
+	ID                 int       `json:"id"`
+	PetID              int       `json:"pet_id"`
+	MeasuredAt         time.Time `json:"measured_at"`
+	Weight             *float64  `json:"weight,omitempty"`
+	WeightUnit         string    `json:"weight_unit,omitempty"`
+	Temperature        *float64  `json:"temperature,omitempty"`
+	TemperatureUnit    string    `json:"temperature_unit,omitempty"`
+	HeartRate          *int      `json:"heart_rate,omitempty"`       // beats per minute
+	RespiratoryRate    *int      `json:"respiratory_rate,omitempty"` // breaths per minute
+	BodyConditionScore *int      `json:"body_condition_score,omitempty"`
+	RecordedBy         int       `json:"recorded_by"`
+	Notes              string    `json:"notes"`
+}
+
+// ConvertWeight converts a weight between kg and lb
+func ConvertWeight(value float64, from, to string) float64 {
+	if from == to {
+		return value
+	}
+	if from == Pounds {
+		return value / poundsPerKilogram
+	}
+	return value * poundsPerKilogram
+}
+
+// ConvertTemperature converts a temperature between °C and °F
+func ConvertTemperature(value float64, from, to string) float64 {
+	if from == to {
+		return value
+	}
+	if from == Fahrenheit {
+		return (value - 32) * 5 / 9
+	}
+	return value*9/5 + 32
+}
+
+// ValidUnits reports an error if either unit is not supported; empty means the stored unit
+func ValidUnits(weightUnit, temperatureUnit string) error {
+	if weightUnit != "" && weightUnit != Kilograms && weightUnit != Pounds {
+		return fmt.Errorf("weight unit must be %s or %s", Kilograms, Pounds)
+	}
+	if temperatureUnit != "" && temperatureUnit != Celsius && temperatureUnit != Fahrenheit {
+		return fmt.Errorf("temperature unit must be %s or %s", Celsius, Fahrenheit)
+	}
+	return nil
+}
+
+func round(value float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(value*p) / p
+}
+
+// InUnits returns a copy of the vitals with weight and temperature expressed in the given units.
+// Empty units leave the value in kg or °C.
+func (v Vitals) InUnits(weightUnit, temperatureUnit string) Vitals {
+	if weightUnit == "" {
+		weightUnit = Kilograms
+	}
+	if temperatureUnit == "" {
+		temperatureUnit = Celsius
+	}
+	if v.WeightUnit == "" {
+		v.WeightUnit = Kilograms
+	}
+	if v.TemperatureUnit == "" {
+		v.TemperatureUnit = Celsius
+	}
+	if v.Weight != nil {
+		w := round(ConvertWeight(*v.Weight, v.WeightUnit, weightUnit), 3)
+		v.Weight = &w
+	}
+	if v.Temperature != nil {
+		t := round(ConvertTemperature(*v.Temperature, v.TemperatureUnit, temperatureUnit), 1)
+		v.Temperature = &t
+	}
+	v.WeightUnit, v.TemperatureUnit = weightUnit, temperatureUnit
+	if v.Weight == nil {
+		v.WeightUnit = ""
+	}
+	if v.Temperature == nil {
+		v.TemperatureUnit = ""
+	}
+	return v
+}
+
+// Validate checks the measurements are present and plausible
+func (v Vitals) Validate() error {
+	var e ValidationError
+	e.check(v.PetID > 0, "pet_id", "is required")
+	e.check(v.Weight != nil || v.Temperature != nil || v.HeartRate != nil || v.RespiratoryRate != nil || v.BodyConditionScore != nil,
+		"weight", "at least one measurement is required")
+	if err := ValidUnits(v.WeightUnit, v.TemperatureUnit); err != nil {
+		e.check(false, "unit", err.Error())
+		return e.err()
+	}
+	metric := v.InUnits(Kilograms, Celsius)
+	if metric.Weight != nil {
+		e.check(*metric.Weight > 0, "weight", "must be positive")
+	}
+	if metric.Temperature != nil {
+		e.check(*metric.Temperature >= 25 && *metric.Temperature <= 45, "temperature", "is outside the plausible range")
+	}
+	if v.HeartRate != nil {
+		e.check(*v.HeartRate > 0, "heart_rate", "must be positive")
+	}
+	if v.RespiratoryRate != nil {
+		e.check(*v.RespiratoryRate > 0, "respiratory_rate", "must be positive")
+	}
+	if v.BodyConditionScore != nil {
+		e.check(*v.BodyConditionScore >= 1 && *v.BodyConditionScore <= 9, "body_condition_score", "must be between 1 and 9")
+	}
+	return e.err()
+}
+
+const vitalsColumns = `SELECT id, pet_id, measured_at, weight_kg, temperature_c, heart_rate, respiratory_rate,
+                body_condition_score, COALESCE(recorded_by, 0), notes
+         FROM vitals`
+
+func scanVitals(row interface{ Scan(...interface{}) error }) (Vitals, error) {
+	var v Vitals
+	var weight, temp sql.NullFloat64
+	var hr, rr, bcs sql.NullInt64
+	err := row.Scan(&v.ID, &v.PetID, &v.MeasuredAt, &weight, &temp, &hr, &rr, &bcs, &v.RecordedBy, &v.Notes)
+	if weight.Valid {
+		v.Weight, v.WeightUnit = &weight.Float64, Kilograms
+	}
+	if temp.Valid {
+		v.Temperature, v.TemperatureUnit = &temp.Float64, Celsius
+	}
+	v.HeartRate = intPtr(hr)
+	v.RespiratoryRate = intPtr(rr)
+	v.BodyConditionScore = intPtr(bcs)
+	return v, err
+}
+
+func intPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	i := int(n.Int64)
+	return &i
+}
+
+// VitalsFilter narrows ListVitals
+type VitalsFilter struct {
+	PetID int
+	From  time.Time
+	To    time.Time
+}
+
+func (f VitalsFilter) where() whereBuilder {
+	var where whereBuilder
+	where.add("pet_id = ?", f.PetID)
+	if !f.From.IsZero() {
+		where.add("measured_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		where.add("measured_at < ?", f.To)
+	}
+	return where
+}
+
+// ListVitals returns one page of a pet's measurements (in kg and °C), newest first by default
+func ListVitals(f VitalsFilter, opts ListOptions) (Page[Vitals], error) {
+	opts = opts.normalize()
+	page := Page[Vitals]{Items: []Vitals{}, Limit: opts.Limit, Offset: opts.Offset}
+	order, err := opts.orderBy(map[string]string{"measured_at": "measured_at"}, "id", "-measured_at")
+	if err != nil {
+		return page, err
+	}
+
+	where := f.where()
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM vitals"+where.String(), where.args...).Scan(&page.Total)
+	if err != nil {
+		utils.Error("Failed to count vitals: %v", err)
+		return page, err
+	}
+
+	limit, args := where.limitOffset(opts)
+	rows, err := db.DB.Query(vitalsColumns+where.String()+order+limit, args...)
+	if err != nil {
+		utils.Error("Failed to fetch vitals: %v", err)
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v, err := scanVitals(rows)
+		if err != nil {
+			utils.Warn("Failed to scan vitals row: %v", err)
+			continue
+		}
+		page.Items = append(page.Items, v)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListVitals: %v", err)
+	}
+	return page, err
+}
+
+// GetVitalsByID returns one of a pet's measurements (in kg and °C), or nil if the pet has none with the ID
+func GetVitalsByID(petID, id int) (*Vitals, error) {
+	v, err := scanVitals(db.DB.QueryRow(vitalsColumns+" WHERE id=$1 AND pet_id=$2", id, petID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		utils.Error("GetVitalsByID DB error: %v", err)
+		return nil, err
+	}
+	return &v, nil
+}
+
+// AddVitals stores a set of measurements, converting weight and temperature to kg and °C.
+// A zero MeasuredAt means now.
+func AddVitals(v Vitals) (Vitals, error) {
+	metric := v.InUnits(Kilograms, Celsius)
+	var measuredAt interface{}
+	if !v.MeasuredAt.IsZero() {
+		measuredAt = v.MeasuredAt
+	}
+	err := db.DB.QueryRow(
+		`INSERT INTO vitals (pet_id, measured_at, weight_kg, temperature_c, heart_rate, respiratory_rate, body_condition_score, recorded_by, notes)
+         VALUES ($1, COALESCE($2, now()), $3, $4, $5, $6, $7, $8, $9) RETURNING id, measured_at`,
+		v.PetID, measuredAt, metric.Weight, metric.Temperature, v.HeartRate, v.RespiratoryRate, v.BodyConditionScore,
+		nullID(v.RecordedBy), v.Notes).
+		Scan(&metric.ID, &metric.MeasuredAt)
+	if err != nil {
+		utils.Error("AddVitals DB error: %v", err)
+	}
+	return metric, err
+}
+
+// TrendPoint is one measurement of a single metric
+type TrendPoint struct {
+	MeasuredAt time.Time `json:"measured_at"`
+	Value      float64   `json:"value"`
+}
+
+// Trend is the history of one metric for a pet, oldest first, with a summary
+type Trend struct {
+	Metric string       `json:"metric"`
+	Unit   string       `json:"unit,omitempty"`
+	Points []TrendPoint `json:"points"`
+	Min    *float64     `json:"min,omitempty"`
+	Max    *float64     `json:"max,omitempty"`
+	Change *float64     `json:"change,omitempty"` // last value minus first value
+}
+
+// trendColumns maps metric names onto their column in kg/°C
+var trendColumns = map[string]string{
+	"weight":               "weight_kg",
+	"temperature":          "temperature_c",
+	"heart_rate":           "heart_rate",
+	"respiratory_rate":     "respiratory_rate",
+	"body_condition_score": "body_condition_score",
+}
+
+// UnknownMetricError is returned for a trend metric that is not tracked
+type UnknownMetricError struct {
+	Metric string
+}
+
+func (e *UnknownMetricError) Error() string {
+	return fmt.Sprintf("unknown metric %q", e.Metric)
+}
+
+// GetVitalsTrend returns every recorded value of metric for the pet within the filter's range.
+// unit selects kg/lb for weight or C/F for temperature and is ignored for other metrics.
+func GetVitalsTrend(f VitalsFilter, metric, unit string) (Trend, error) {
+	trend := Trend{Metric: metric, Points: []TrendPoint{}}
+	column, ok := trendColumns[metric]
+	if !ok {
+		return trend, &UnknownMetricError{Metric: metric}
+	}
+
+	where := f.where()
+	where.addExpr(column + " IS NOT NULL")
+	rows, err := db.DB.Query("SELECT measured_at, "+column+"::float8 FROM vitals"+where.String()+" ORDER BY measured_at, id", where.args...)
+	if err != nil {
+		utils.Error("Failed to fetch %s trend: %v", metric, err)
+		return trend, err
+	}
+	defer rows.Close()
+
+	convert := func(v float64) float64 { return v }
+	switch metric {
+	case "weight":
+		if unit == "" {
+			unit = Kilograms
+		}
+		convert = func(v float64) float64 { return round(ConvertWeight(v, Kilograms, unit), 3) }
+		trend.Unit = unit
+	case "temperature":
+		if unit == "" {
+			unit = Celsius
+		}
+		convert = func(v float64) float64 { return round(ConvertTemperature(v, Celsius, unit), 1) }
+		trend.Unit = unit
+	}
+
+	for rows.Next() {
+		var p TrendPoint
+		if err := rows.Scan(&p.MeasuredAt, &p.Value); err != nil {
+			utils.Warn("Failed to scan trend row: %v", err)
+			continue
+		}
+		p.Value = convert(p.Value)
+		trend.Points = append(trend.Points, p)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in GetVitalsTrend: %v", err)
+		return trend, err
+	}
+
+	if len(trend.Points) > 0 {
+		lo, hi := trend.Points[0].Value, trend.Points[0].Value
+		for _, p := range trend.Points {
+			lo, hi = math.Min(lo, p.Value), math.Max(hi, p.Value)
+		}
+		change := round(trend.Points[len(trend.Points)-1].Value-trend.Points[0].Value, 3)
+		trend.Min, trend.Max, trend.Change = &lo, &hi, &change
+	}
+	return trend, nil
+}
@@ -0,0 +1,598 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"petclinic/db"
+	"petclinic/utils"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Waitlist entry statuses
+const (
+	WaitlistWaiting   = "waiting"
+	WaitlistOffered   = "offered" // a freed slot is on offer, see Offer
+	WaitlistBooked    = "booked"
+	WaitlistWithdrawn = "withdrawn"
+	WaitlistExpired   = "expired" // the window passed without a booking
+)
+
+// Waitlist offer statuses
+const (
+	OfferPending  = "pending"
+	OfferAccepted = "accepted"
+	OfferDeclined = "declined"
+	OfferExpired  = "expired"
+)
+
+// OfferTTL is how long a waitlisted owner has to take up an offered slot before it passes to the next
+// entry in line. Set from WAITLIST_OFFER_HOURS at startup.
+var OfferTTL = 2 * time.Hour
+
+// ErrWaitlistClosed is returned when acting on an entry or offer that is no longer open
+var ErrWaitlistClosed = errors.New("waitlist entry or offer is no longer open")
+
+// WaitlistEntry is a pet waiting for a slot of an appointment type between two clinic dates
+type WaitlistEntry struct {
+	ID            int       `json:"id"`
+	PetID         int       `json:"pet_id"`
+	OwnerID       int       `json:"owner_id"` // owner of the pet, used for ownership checks
+	TypeID        int       `json:"appointment_type_id"`
+	VetIDs        []int     `json:"vet_ids"` // preferred vets; empty accepts any vet offering the type
+	From          time.Time `json:"from"`    // first and last date of the window, inclusive
+	To            time.Time `json:"to"`
+	Notes         string    `json:"notes"`
+	Status        string    `json:"status"`
+	AppointmentID int       `json:"appointment_id,omitempty"` // set once an offer is accepted
+	CreatedBy     int       `json:"created_by,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	Offer *WaitlistOffer `json:"offer,omitempty"` // the open offer, while the entry is offered
+}
+
+// WaitlistOffer is a freed slot held for one waitlist entry until it is accepted, declined or expires
+type WaitlistOffer struct {
+	ID                 int        `json:"id"`
+	EntryID            int        `json:"entry_id"`
+	FreedAppointmentID int        `json:"freed_appointment_id,omitempty"`
+	VetID              int        `json:"vet_id"`
+	StartsAt           time.Time  `json:"starts_at"`
+	EndsAt             time.Time  `json:"ends_at"`
+	Status             string     `json:"status"`
+	OfferedAt          time.Time  `json:"offered_at"`
+	ExpiresAt          time.Time  `json:"expires_at"`
+	RespondedAt        *time.Time `json:"responded_at,omitempty"`
+	NotifiedAt         *time.Time `json:"notified_at,omitempty"`  // when the owner was told, or found unreachable
+	NotifiedVia        string     `json:"notified_via,omitempty"` // comma-separated channels; empty if unreachable
+}
+
+// Validate checks the fields required to put a pet on the waitlist
+func (e WaitlistEntry) Validate() error {
+	var v ValidationError
+	v.check(e.PetID > 0, "pet_id", "is required")
+	v.check(e.TypeID > 0, "appointment_type_id", "is required")
+	v.check(!e.From.IsZero(), "from", "is required")
+	v.check(!e.To.IsZero(), "to", "is required")
+	if !e.From.IsZero() && !e.To.IsZero() {
+		v.check(!e.To.Before(e.From), "to", "must not be before from")
+		v.check(!clinicDay(e.To).Before(clinicDay(time.Now().In(ClinicLocation))), "to", "must not be in the past")
+	}
+	return v.err()
+}
+
+// WaitlistFilter narrows a waitlist listing; zero values are ignored
+type WaitlistFilter struct {
+	OwnerID int
+	PetID   int
+	Status  string
+}
+
+var waitlistSortColumns = map[string]string{
+	"created_at": "w.created_at",
+	"from":       "w.from_date",
+	"to":         "w.to_date",
+}
+
+// waitlistColumns selects an entry joined with its pet so OwnerID reflects the pet's owner
+const waitlistColumns = `SELECT w.id, w.pet_id, p.owner_id, w.appointment_type_id,
+                COALESCE((SELECT array_agg(v.vet_id ORDER BY v.vet_id) FROM waitlist_preferred_vets v WHERE v.entry_id = w.id), '{}'),
+                w.from_date, w.to_date, w.notes, w.status, COALESCE(w.appointment_id, 0), COALESCE(w.created_by, 0), w.created_at
+         FROM waitlist_entries w JOIN pets p ON p.id = w.pet_id`
+
+func scanWaitlistEntry(row interface{ Scan(...interface{}) error }, e *WaitlistEntry) error {
+	var vetIDs pq.Int64Array
+	err := row.Scan(&e.ID, &e.PetID, &e.OwnerID, &e.TypeID, &vetIDs, &e.From, &e.To, &e.Notes, &e.Status,
+		&e.AppointmentID, &e.CreatedBy, &e.CreatedAt)
+	e.VetIDs = make([]int, len(vetIDs))
+	for i, id := range vetIDs {
+		e.VetIDs[i] = int(id)
+	}
+	return err
+}
+
+const offerColumns = `SELECT o.id, o.entry_id, COALESCE(o.freed_appointment_id, 0), o.vet_id, o.starts_at, o.ends_at, o.status,
+                o.offered_at, o.expires_at, o.responded_at, o.notified_at, o.notified_via
+         FROM waitlist_offers o`
+
+func scanOffer(row interface{ Scan(...interface{}) error }, o *WaitlistOffer, extra ...interface{}) error {
+	err := row.Scan(append([]interface{}{&o.ID, &o.EntryID, &o.FreedAppointmentID, &o.VetID, &o.StartsAt, &o.EndsAt, &o.Status,
+		&o.OfferedAt, &o.ExpiresAt, &o.RespondedAt, &o.NotifiedAt, &o.NotifiedVia}, extra...)...)
+	o.StartsAt = o.StartsAt.In(ClinicLocation)
+	o.EndsAt = o.EndsAt.In(ClinicLocation)
+	return err
+}
+
+// attachOffers fills in the open offer of each offered entry
+func attachOffers(entries []WaitlistEntry) error {
+	ids := make([]int, 0, len(entries))
+	for _, e := range entries {
+		if e.Status == WaitlistOffered {
+			ids = append(ids, e.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	rows, err := db.DB.Query(offerColumns+" WHERE o.entry_id = ANY($1) AND o.status = 'pending'", pq.Array(ids))
+	if err != nil {
+		utils.Error("Failed to fetch waitlist offers: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	offers := map[int]*WaitlistOffer{}
+	for rows.Next() {
+		var o WaitlistOffer
+		if err := scanOffer(rows, &o); err != nil {
+			utils.Warn("Failed to scan waitlist offer row: %v", err)
+			continue
+		}
+		offers[o.EntryID] = &o
+	}
+	for i := range entries {
+		entries[i].Offer = offers[entries[i].ID]
+	}
+	return rows.Err()
+}
+
+// ListWaitlist returns a page of waitlist entries for live pets, oldest first unless sorted otherwise
+func ListWaitlist(f WaitlistFilter, opts ListOptions) (Page[WaitlistEntry], error) {
+	opts = opts.normalize()
+	page := Page[WaitlistEntry]{Items: []WaitlistEntry{}, Limit: opts.Limit, Offset: opts.Offset}
+	order, err := opts.orderBy(waitlistSortColumns, "w.id", "created_at")
+	if err != nil {
+		return page, err
+	}
+
+	var where whereBuilder
+	where.addExpr("p.deleted_at IS NULL")
+	if f.OwnerID != 0 {
+		where.add("p.owner_id = ?", f.OwnerID)
+	}
+	if f.PetID != 0 {
+		where.add("w.pet_id = ?", f.PetID)
+	}
+	if f.Status != "" {
+		where.add("w.status = ?", f.Status)
+	}
+
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM waitlist_entries w JOIN pets p ON p.id = w.pet_id"+where.String(), where.args...).Scan(&page.Total)
+	if err != nil {
+		utils.Error("Failed to count waitlist entries: %v", err)
+		return page, err
+	}
+
+	limit, args := where.limitOffset(opts)
+	rows, err := db.DB.Query(waitlistColumns+where.String()+order+limit, args...)
+	if err != nil {
+		utils.Error("Failed to fetch waitlist entries: %v", err)
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e WaitlistEntry
+		if err := scanWaitlistEntry(rows, &e); err != nil {
+			utils.Warn("Failed to scan waitlist entry row: %v", err)
+			continue
+		}
+		page.Items = append(page.Items, e)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in ListWaitlist: %v", err)
+		return page, err
+	}
+	return page, attachOffers(page.Items)
+}
+
+// GetWaitlistEntry returns the entry with its open offer, or nil if there is none for a live pet
+func GetWaitlistEntry(id int) (*WaitlistEntry, error) {
+	var e WaitlistEntry
+	err := scanWaitlistEntry(db.DB.QueryRow(waitlistColumns+" WHERE w.id=$1 AND p.deleted_at IS NULL", id), &e)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		utils.Error("GetWaitlistEntry DB error: %v", err)
+		return nil, err
+	}
+	entries := []WaitlistEntry{e}
+	if err := attachOffers(entries); err != nil {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// AddWaitlistEntry puts a pet on the waitlist behind everyone already waiting
+func AddWaitlistEntry(e WaitlistEntry, createdBy int) (WaitlistEntry, error) {
+	e.Status = WaitlistWaiting
+	e.CreatedBy = createdBy
+	if e.VetIDs == nil {
+		e.VetIDs = []int{}
+	}
+	err := db.WithTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			`INSERT INTO waitlist_entries (pet_id, appointment_type_id, from_date, to_date, notes, created_by)
+             VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, (SELECT owner_id FROM pets WHERE id = $1), created_at`,
+			e.PetID, e.TypeID, e.From.Format("2006-01-02"), e.To.Format("2006-01-02"), e.Notes, nullID(createdBy)).
+			Scan(&e.ID, &e.OwnerID, &e.CreatedAt)
+		if err != nil {
+			return err
+		}
+		for _, vetID := range e.VetIDs {
+			_, err := tx.Exec("INSERT INTO waitlist_preferred_vets (entry_id, vet_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", e.ID, vetID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.Error("AddWaitlistEntry DB error: %v", err)
+	}
+	return e, err
+}
+
+// WithdrawWaitlistEntry takes the entry off the waitlist. An open offer is declined and passed on.
+// Returns ErrWaitlistClosed if the entry is already booked, withdrawn or expired.
+func WithdrawWaitlistEntry(id int) error {
+	freedID := 0
+	err := db.WithTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec("UPDATE waitlist_entries SET status='withdrawn' WHERE id=$1 AND status IN ('waiting', 'offered')", id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			return ErrWaitlistClosed
+		}
+		err = tx.QueryRow(
+			`UPDATE waitlist_offers SET status='declined', responded_at=now() WHERE entry_id=$1 AND status='pending'
+             RETURNING COALESCE(freed_appointment_id, 0)`, id).Scan(&freedID)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		utils.Warn("WithdrawWaitlistEntry %d: %v", id, err)
+		return err
+	}
+	offerFreedSlot(freedID)
+	return nil
+}
+
+// offerFreedSlot offers the slot a cancelled or deleted appointment held to the longest-waiting entry it
+// suits: the same appointment date within the entry's window, a vet the entry accepts who offers its type,
+// and enough time for that type. Entries already offered this slot are skipped. The cancellation has
+// already happened, so failures are logged rather than returned.
+func offerFreedSlot(appointmentID int) {
+	if appointmentID == 0 {
+		return
+	}
+	var vetID, petID int
+	var start, end time.Time
+	err := db.DB.QueryRow(
+		`SELECT COALESCE(a.vet_id, 0), a.pet_id, a.starts_at, a.ends_at FROM appointments a
+         WHERE a.id=$1 AND (a.deleted_at IS NOT NULL OR NOT `+appointmentHoldsSlot+`)`, appointmentID).
+		Scan(&vetID, &petID, &start, &end)
+	if err == sql.ErrNoRows {
+		return // restored or purged since
+	}
+	if err != nil {
+		utils.Error("Failed to look up freed appointment %d: %v", appointmentID, err)
+		return
+	}
+	if vetID == 0 || !start.After(time.Now()) {
+		return
+	}
+
+	entryID := 0
+	err = db.WithTx(func(tx *sql.Tx) error {
+		// Someone may have booked the time since it was freed
+		var taken bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM appointments a WHERE a.deleted_at IS NULL AND `+appointmentHoldsSlot+`
+             AND a.vet_id=$1 AND a.slot && tstzrange($2, $3))`, vetID, start, end).Scan(&taken)
+		if err != nil || taken {
+			return err
+		}
+
+		var minutes int
+		err = tx.QueryRow(
+			`SELECT w.id, t.duration_minutes FROM waitlist_entries w
+             JOIN pets p ON p.id = w.pet_id AND p.deleted_at IS NULL
+             JOIN appointment_types t ON t.id = w.appointment_type_id
+             JOIN vet_appointment_types vt ON vt.appointment_type_id = w.appointment_type_id AND vt.vet_id = $1
+             WHERE w.status = 'waiting' AND $2::date BETWEEN w.from_date AND w.to_date
+               AND t.duration_minutes <= $3 AND w.pet_id <> $4
+               AND (NOT EXISTS (SELECT 1 FROM waitlist_preferred_vets v WHERE v.entry_id = w.id)
+                    OR EXISTS (SELECT 1 FROM waitlist_preferred_vets v WHERE v.entry_id = w.id AND v.vet_id = $1))
+               AND NOT EXISTS (SELECT 1 FROM waitlist_offers o WHERE o.entry_id = w.id AND o.freed_appointment_id = $5)
+             ORDER BY w.created_at, w.id LIMIT 1
+             FOR UPDATE OF w SKIP LOCKED`,
+			vetID, start.In(ClinicLocation).Format("2006-01-02"), int(end.Sub(start).Minutes()), petID, appointmentID).
+			Scan(&entryID, &minutes)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		expires := time.Now().Add(OfferTTL)
+		if start.Before(expires) {
+			expires = start
+		}
+		_, err = tx.Exec(
+			`INSERT INTO waitlist_offers (entry_id, freed_appointment_id, vet_id, starts_at, ends_at, expires_at)
+             VALUES ($1, $2, $3, $4, $5, $6)`,
+			entryID, appointmentID, vetID, start, start.Add(time.Duration(minutes)*time.Minute), expires)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE waitlist_entries SET status='offered' WHERE id=$1", entryID)
+		return err
+	})
+	if isUniqueViolation(err, "waitlist_offers_pending_slot_idx") {
+		return // offered concurrently
+	}
+	if err != nil {
+		utils.Error("Failed to offer slot freed by appointment %d: %v", appointmentID, err)
+		return
+	}
+	if entryID != 0 {
+		utils.Info("Offered slot freed by appointment %d to waitlist entry %d", appointmentID, entryID)
+	}
+}
+
+// AcceptOffer books the entry's open offer as a confirmed appointment and marks the entry booked.
+// Returns ErrWaitlistClosed if there is no open offer or it has expired (an expired offer is passed on),
+// or a *ScheduleConflictError if the slot was taken in the meantime, in which case the entry goes back
+// to waiting.
+func AcceptOffer(entryID int) (Appointment, error) {
+	var apt Appointment
+	var closed, expired bool
+	var bookErr error
+	freedID := 0
+	err := db.WithTx(func(tx *sql.Tx) error {
+		var o WaitlistOffer
+		var typeID, petID int
+		var notes string
+		err := tx.QueryRow(
+			`SELECT o.id, COALESCE(o.freed_appointment_id, 0), o.vet_id, o.starts_at, o.ends_at, o.expires_at,
+                    w.appointment_type_id, w.pet_id, w.notes
+             FROM waitlist_offers o JOIN waitlist_entries w ON w.id = o.entry_id
+             WHERE o.entry_id=$1 AND o.status='pending' FOR UPDATE OF o, w`, entryID).
+			Scan(&o.ID, &o.FreedAppointmentID, &o.VetID, &o.StartsAt, &o.EndsAt, &o.ExpiresAt, &typeID, &petID, &notes)
+		if err == sql.ErrNoRows {
+			closed = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		freedID = o.FreedAppointmentID
+
+		if !o.ExpiresAt.After(time.Now()) {
+			expired = true
+			return closeOffer(tx, o.ID, entryID, OfferExpired)
+		}
+
+		reason := notes
+		if reason == "" {
+			reason = "Booked from the waitlist"
+		}
+		a := Appointment{StartsAt: o.StartsAt, EndsAt: o.EndsAt, TypeID: typeID, VetID: o.VetID, PetID: petID,
+			Reason: reason, Status: StatusConfirmed}
+		bookErr = withSavepoint(tx, func() error {
+			var err error
+			apt, err = AddAppointmentTx(tx, a)
+			return err
+		})
+		var conflict *ScheduleConflictError
+		if errors.As(bookErr, &conflict) {
+			return closeOffer(tx, o.ID, entryID, OfferExpired)
+		}
+		if bookErr != nil {
+			return bookErr
+		}
+
+		if _, err := tx.Exec("UPDATE waitlist_offers SET status='accepted', responded_at=now() WHERE id=$1", o.ID); err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE waitlist_entries SET status='booked', appointment_id=$1 WHERE id=$2", apt.ID, entryID)
+		return err
+	})
+	switch {
+	case err != nil:
+		utils.Error("AcceptOffer DB error: %v", err)
+		return apt, err
+	case closed:
+		return apt, ErrWaitlistClosed
+	case expired:
+		offerFreedSlot(freedID)
+		return apt, ErrWaitlistClosed
+	case bookErr != nil:
+		return apt, bookErr
+	}
+	apt.fillLegacyTimes()
+	return apt, nil
+}
+
+// DeclineOffer turns down the entry's open offer, puts the entry back to waiting and passes the slot on.
+// Returns ErrWaitlistClosed if there is no open offer.
+func DeclineOffer(entryID int) error {
+	freedID := 0
+	err := db.WithTx(func(tx *sql.Tx) error {
+		var offerID int
+		err := tx.QueryRow(
+			"SELECT id, COALESCE(freed_appointment_id, 0) FROM waitlist_offers WHERE entry_id=$1 AND status='pending' FOR UPDATE",
+			entryID).Scan(&offerID, &freedID)
+		if err == sql.ErrNoRows {
+			return ErrWaitlistClosed
+		}
+		if err != nil {
+			return err
+		}
+		return closeOffer(tx, offerID, entryID, OfferDeclined)
+	})
+	if err != nil {
+		utils.Warn("DeclineOffer for entry %d: %v", entryID, err)
+		return err
+	}
+	offerFreedSlot(freedID)
+	return nil
+}
+
+// closeOffer ends an open offer without a booking and puts its entry back to waiting
+func closeOffer(tx *sql.Tx, offerID, entryID int, status string) error {
+	if _, err := tx.Exec("UPDATE waitlist_offers SET status=$1, responded_at=now() WHERE id=$2", status, offerID); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE waitlist_entries SET status='waiting' WHERE id=$1 AND status='offered'", entryID)
+	return err
+}
+
+// ExpireWaitlist passes on offers nobody took up in time and closes entries whose window has gone by.
+// Returns how many offers and entries it expired.
+func ExpireWaitlist() (int, error) {
+	var freedIDs []int
+	err := db.WithTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(
+			`UPDATE waitlist_offers SET status='expired' WHERE status='pending' AND expires_at <= now()
+             RETURNING entry_id, COALESCE(freed_appointment_id, 0)`)
+		if err != nil {
+			return err
+		}
+		var entryIDs []int
+		for rows.Next() {
+			var entryID, freedID int
+			if err := rows.Scan(&entryID, &freedID); err != nil {
+				rows.Close()
+				return err
+			}
+			entryIDs = append(entryIDs, entryID)
+			freedIDs = append(freedIDs, freedID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(entryIDs) == 0 {
+			return nil
+		}
+		_, err = tx.Exec("UPDATE waitlist_entries SET status='waiting' WHERE id = ANY($1) AND status='offered'", pq.Array(entryIDs))
+		return err
+	})
+	if err != nil {
+		utils.Error("ExpireWaitlist DB error: %v", err)
+		return 0, err
+	}
+	for _, id := range freedIDs {
+		offerFreedSlot(id)
+	}
+
+	today := clinicDay(time.Now().In(ClinicLocation)).Format("2006-01-02")
+	res, err := db.DB.Exec("UPDATE waitlist_entries SET status='expired' WHERE status='waiting' AND to_date < $1", today)
+	if err != nil {
+		utils.Error("ExpireWaitlist DB error: %v", err)
+		return len(freedIDs), err
+	}
+	n, _ := res.RowsAffected()
+	return len(freedIDs) + int(n), nil
+}
+
+// DueOfferNotice is an open offer whose owner has not yet been told, with what the notice needs
+type DueOfferNotice struct {
+	WaitlistOffer
+	PetName    string
+	TypeName   string
+	OwnerID    int
+	OwnerName  string
+	OwnerEmail string
+	Contact    ContactPreferences
+}
+
+// PendingOfferNotices returns up to limit open offers whose owners have not yet been told, oldest first
+func PendingOfferNotices(limit int) ([]DueOfferNotice, error) {
+	due := []DueOfferNotice{}
+	rows, err := db.DB.Query(
+		`SELECT o.id, o.entry_id, COALESCE(o.freed_appointment_id, 0), o.vet_id, o.starts_at, o.ends_at, o.status,
+                o.offered_at, o.expires_at, o.responded_at, o.notified_at, o.notified_via,
+                p.name, t.name, ow.id, ow.name, ow.email,
+                COALESCE(cp.email, true), COALESCE(cp.sms, false), COALESCE(cp.phone, ''), COALESCE(cp.locale, '')
+         FROM waitlist_offers o
+         JOIN waitlist_entries w ON w.id = o.entry_id
+         JOIN pets p ON p.id = w.pet_id
+         JOIN owners ow ON ow.id = p.owner_id
+         JOIN appointment_types t ON t.id = w.appointment_type_id
+         LEFT JOIN owner_contact_preferences cp ON cp.owner_id = ow.id
+         WHERE o.status = 'pending' AND o.notified_at IS NULL AND o.expires_at > now()
+         ORDER BY o.offered_at, o.id LIMIT $1`, limit)
+	if err != nil {
+		utils.Error("Failed to fetch pending offer notices: %v", err)
+		return due, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d DueOfferNotice
+		err := scanOffer(rows, &d.WaitlistOffer, &d.PetName, &d.TypeName, &d.OwnerID, &d.OwnerName, &d.OwnerEmail,
+			&d.Contact.Email, &d.Contact.SMS, &d.Contact.Phone, &d.Contact.Locale)
+		if err != nil {
+			utils.Warn("Failed to scan pending offer notice row: %v", err)
+			continue
+		}
+		d.Contact.OwnerID = d.OwnerID
+		due = append(due, d)
+	}
+	if err = rows.Err(); err != nil {
+		utils.Error("Rows error in PendingOfferNotices: %v", err)
+	}
+	return due, err
+}
+
+// MarkOfferNotified records that the owner was told of the offer over the given channels. With none, the
+// owner could not be reached and staff should call them.
+func MarkOfferNotified(id int, via []string) error {
+	_, err := db.DB.Exec("UPDATE waitlist_offers SET notified_at=now(), notified_via=$2, notify_attempts=notify_attempts+1, notify_error='' WHERE id=$1",
+		id, strings.Join(via, ","))
+	if err != nil {
+		utils.Error("MarkOfferNotified DB error: %v", err)
+	}
+	return err
+}
+
+// MarkOfferNoticeFailed records a failed delivery; the notice is retried until MaxReminderAttempts
+func MarkOfferNoticeFailed(id int, sendErr error) error {
+	_, err := db.DB.Exec(
+		`UPDATE waitlist_offers SET notify_attempts=notify_attempts+1, notify_error=$2,
+                notified_at = CASE WHEN notify_attempts+1 >= $3 THEN now() ELSE notified_at END
+         WHERE id=$1`, id, sendErr.Error(), MaxReminderAttempts)
+	if err != nil {
+		utils.Error("MarkOfferNoticeFailed DB error: %v", err)
+	}
+	return err
+}
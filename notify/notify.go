@@ -0,0 +1,75 @@
+// Package notify delivers messages to the clinic's clients by email and SMS.
+package notify
+
+import (
+	"fmt"
+	"os"
+	"petclinic/utils"
+)
+
+// Message is one message to one recipient. Subject and HTML are ignored by SMS senders.
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+	HTML    string // optional HTML alternative to Body
+}
+
+// Sender delivers messages over one channel
+type Sender interface {
+	Send(m Message) error
+}
+
+// LogSender is a fake sender for local development: it writes messages to the log instead of sending them
+type LogSender struct {
+	Channel string
+}
+
+func (s LogSender) Send(m Message) error {
+	utils.Info("[%s to %s] %s\n%s", s.Channel, m.To, m.Subject, m.Body)
+	return nil
+}
+
+// EmailSenderFromEnv picks the email sender named by EMAIL_SENDER: "smtp", configured by SMTP_HOST,
+// SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD and SMTP_FROM, or "log" (the default).
+func EmailSenderFromEnv() Sender {
+	switch kind := os.Getenv("EMAIL_SENDER"); kind {
+	case "smtp":
+		return SMTPSender{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     utils.EnvInt("SMTP_PORT", 587),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		}
+	case "", "log":
+		return LogSender{Channel: "email"}
+	default:
+		utils.Warn("Unknown EMAIL_SENDER %q, logging emails instead", kind)
+		return LogSender{Channel: "email"}
+	}
+}
+
+// SMSSenderFromEnv picks the SMS sender named by SMS_SENDER: "twilio", configured by TWILIO_ACCOUNT_SID,
+// TWILIO_AUTH_TOKEN and TWILIO_FROM, or "log" (the default).
+func SMSSenderFromEnv() Sender {
+	switch kind := os.Getenv("SMS_SENDER"); kind {
+	case "twilio":
+		return NewTwilioSender(os.Getenv("TWILIO_ACCOUNT_SID"), os.Getenv("TWILIO_AUTH_TOKEN"), os.Getenv("TWILIO_FROM"))
+	case "", "log":
+		return LogSender{Channel: "sms"}
+	default:
+		utils.Warn("Unknown SMS_SENDER %q, logging text messages instead", kind)
+		return LogSender{Channel: "sms"}
+	}
+}
+
+// SendError is a delivery failure reported by the provider, as opposed to a network error
+type SendError struct {
+	Status int
+	Detail string
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("provider rejected message: %d %s", e.Status, e.Detail)
+}
@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds a whole delivery, from dialling the server to QUIT, so a stalled server cannot hold up
+// the jobs that send mail
+const smtpTimeout = 30 * time.Second
+
+// SMTPSender sends email through an SMTP server, authenticating if Username is set. Messages with HTML
+// are sent as multipart/alternative so mail clients can pick either version.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (s SMTPSender) Send(m Message) error {
+	if s.Host == "" || s.From == "" {
+		return fmt.Errorf("SMTP sender is not configured: SMTP_HOST and SMTP_FROM are required")
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	if m.HTML == "" {
+		b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+		b.WriteString(crlf(m.Body))
+	} else {
+		mw := multipart.NewWriter(&b)
+		fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+		for _, part := range []struct{ contentType, body string }{{"text/plain", m.Body}, {"text/html", m.HTML}} {
+			w, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {part.contentType + "; charset=utf-8"},
+				"Content-Transfer-Encoding": {"8bit"},
+			})
+			if err != nil {
+				return err
+			}
+			io.WriteString(w, crlf(part.body))
+		}
+		mw.Close()
+	}
+
+	return s.deliver(auth, m.To, b.String())
+}
+
+// deliver hands the message to the server as smtp.SendMail would, upgrading to TLS when the server offers
+// it, but on a connection with a deadline
+func (s SMTPSender) deliver(auth smtp.Auth, to, msg string) error {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", s.Host, s.Port), smtpTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("SMTP server %s does not support authentication", s.Host)
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// crlf converts a body's line endings to the CRLF that mail requires
+func crlf(body string) string {
+	return strings.ReplaceAll(body, "\n", "\r\n")
+}
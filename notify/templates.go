@@ -0,0 +1,238 @@
+package notify
+
+import (
+	htmltemplate "html/template"
+	"os"
+	"petclinic/utils"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Notification kinds with editable templates
+const (
+	KindAppointmentReminder = "appointment_reminder"
+	KindRecall              = "recall"
+	KindWaitlistOffer       = "waitlist_offer"
+)
+
+// Clinic is the branding every template can use, from CLINIC_NAME, CLINIC_PHONE, CLINIC_WEBSITE and CLINIC_LOGO_URL
+type Clinic struct {
+	Name    string
+	Phone   string
+	Website string
+	LogoURL string
+}
+
+// ClinicFromEnv reads the clinic's branding from the environment
+func ClinicFromEnv() Clinic {
+	return Clinic{
+		Name:    utils.ClinicName(),
+		Phone:   os.Getenv("CLINIC_PHONE"),
+		Website: os.Getenv("CLINIC_WEBSITE"),
+		LogoURL: os.Getenv("CLINIC_LOGO_URL"),
+	}
+}
+
+// ReminderData is what appointment reminder templates are rendered with
+type ReminderData struct {
+	Clinic    Clinic
+	OwnerName string
+	PetName   string
+	TypeName  string    // empty for appointments without a type
+	StartsAt  time.Time // in the clinic's time zone
+}
+
+// RecallData is what recall notice templates are rendered with
+type RecallData struct {
+	Clinic      Clinic
+	OwnerName   string
+	PetName     string
+	Kind        string // "vaccination" or "checkup"
+	Vaccine     string // vaccination rules for one vaccine
+	TypeName    string // the appointment type to book, if the rule has one
+	DueOn       time.Time
+	BookingLink string // empty if online booking is not set up
+}
+
+// WaitlistOfferData is what waitlist offer templates are rendered with
+type WaitlistOfferData struct {
+	Clinic    Clinic
+	OwnerName string
+	PetName   string
+	TypeName  string
+	StartsAt  time.Time // in the clinic's time zone
+	ExpiresAt time.Time // when the offer passes to the next in line
+}
+
+// Template is the source of one notification's wording. Subject and Text are Go text templates and HTML
+// an html/template; SMS only uses Text, and email sends HTML as an alternative to Text when it is set.
+type Template struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+// TemplateError is a template that does not parse or fails to render
+type TemplateError struct {
+	Field string // "subject", "text" or "html"
+	Err   error
+}
+
+func (e *TemplateError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// Render executes the template with data into a message to the recipient
+func (t Template) Render(to string, data any) (Message, error) {
+	m := Message{To: to}
+	subject, err := renderText("subject", t.Subject, data)
+	if err != nil {
+		return m, err
+	}
+	m.Subject = strings.Join(strings.Fields(subject), " ") // headers are a single line
+	if m.Body, err = renderText("text", t.Text, data); err != nil {
+		return m, err
+	}
+	m.Body = strings.TrimSpace(m.Body) + "\n"
+	if t.HTML != "" {
+		tmpl, err := htmltemplate.New("html").Option("missingkey=error").Parse(t.HTML)
+		if err != nil {
+			return m, &TemplateError{Field: "html", Err: err}
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			return m, &TemplateError{Field: "html", Err: err}
+		}
+		m.HTML = b.String()
+	}
+	return m, nil
+}
+
+func renderText(field, src string, data any) (string, error) {
+	tmpl, err := template.New(field).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return "", &TemplateError{Field: field, Err: err}
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", &TemplateError{Field: field, Err: err}
+	}
+	return b.String(), nil
+}
+
+// Kinds lists the notification kinds with templates
+func Kinds() []string {
+	kinds := make([]string, 0, len(defaults))
+	for kind := range defaults {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Default is the built-in wording of a kind of notification over a channel, used until an admin edits it
+func Default(kind, channel string) (Template, bool) {
+	t, ok := defaults[kind][channel]
+	return t, ok
+}
+
+// SampleData is made-up data of the shape a kind of notification is rendered with, for previews and for
+// checking edited templates
+func SampleData(kind string) any {
+	clinic := ClinicFromEnv()
+	startsAt := time.Now().AddDate(0, 0, 2).Truncate(time.Hour)
+	switch kind {
+	case KindAppointmentReminder:
+		return ReminderData{Clinic: clinic, OwnerName: "Jane Doe", PetName: "Biscuit", TypeName: "Vaccination", StartsAt: startsAt}
+	case KindRecall:
+		return RecallData{Clinic: clinic, OwnerName: "Jane Doe", PetName: "Biscuit", Kind: "vaccination", Vaccine: "Rabies",
+			TypeName: "Vaccination", DueOn: startsAt, BookingLink: "https://example.com/book?pet_id=1"}
+	case KindWaitlistOffer:
+		return WaitlistOfferData{Clinic: clinic, OwnerName: "Jane Doe", PetName: "Biscuit", TypeName: "Vaccination",
+			StartsAt: startsAt, ExpiresAt: time.Now().Add(2 * time.Hour).Truncate(time.Minute)}
+	}
+	return nil
+}
+
+const (
+	textSignature = `
+{{.Clinic.Name}}{{if .Clinic.Phone}}
+{{.Clinic.Phone}}{{end}}{{if .Clinic.Website}}
+{{.Clinic.Website}}{{end}}`
+
+	htmlHeader = `<!DOCTYPE html>
+<html><body style="font-family: Arial, sans-serif; color: #222; line-height: 1.5;">
+{{if .Clinic.LogoURL}}<p><img src="{{.Clinic.LogoURL}}" alt="{{.Clinic.Name}}" height="48"></p>{{end}}
+`
+	htmlSignature = `
+<p style="color: #666;">{{.Clinic.Name}}{{if .Clinic.Phone}}<br>{{.Clinic.Phone}}{{end}}{{if .Clinic.Website}}<br><a href="{{.Clinic.Website}}">{{.Clinic.Website}}</a>{{end}}</p>
+</body></html>
+`
+
+	reminderWhat = `{{if .TypeName}}a {{.TypeName}} appointment{{else}}an appointment{{end}}`
+	reminderWhen = `{{.StartsAt.Format "Monday 2 January at 15:04"}}`
+	recallWhat   = `{{if and (eq .Kind "vaccination") .Vaccine}}their {{.Vaccine}} vaccination{{else if eq .Kind "vaccination"}}a vaccination{{else if .TypeName}}a {{.TypeName}}{{else}}a check-up{{end}}`
+	recallDue    = `{{.DueOn.Format "2 January 2006"}}`
+	offerWhen    = `{{.StartsAt.Format "Monday 2 January at 15:04"}}`
+	offerUntil   = `{{.ExpiresAt.Format "Monday 2 January at 15:04"}}`
+)
+
+var defaults = map[string]map[string]Template{
+	KindAppointmentReminder: {
+		"email": {
+			Subject: `Reminder: {{.PetName}}'s appointment on ` + reminderWhen,
+			Text: `Hello {{.OwnerName}},
+
+This is a reminder that {{.PetName}} has ` + reminderWhat + ` at {{.Clinic.Name}} on ` + reminderWhen + `.
+
+If you can no longer make it, please cancel or reschedule so we can offer the time to another pet.
+` + textSignature,
+			HTML: htmlHeader + `<p>Hello {{.OwnerName}},</p>
+<p>This is a reminder that {{.PetName}} has ` + reminderWhat + ` at {{.Clinic.Name}} on <strong>` + reminderWhen + `</strong>.</p>
+<p>If you can no longer make it, please cancel or reschedule so we can offer the time to another pet.</p>` + htmlSignature,
+		},
+		"sms": {
+			Text: `{{.Clinic.Name}}: reminder that {{.PetName}} has ` + reminderWhat + ` on ` + reminderWhen + `. Can't make it? Please cancel or reschedule.`,
+		},
+	},
+	KindRecall: {
+		"email": {
+			Subject: `{{.PetName}} is due ` + recallWhat,
+			Text: `Hello {{.OwnerName}},
+
+Our records show {{.PetName}} is due ` + recallWhat + ` on ` + recallDue + `.
+
+{{if .BookingLink}}You can book online at {{.BookingLink}}{{else}}Please get in touch to book.{{end}}
+` + textSignature,
+			HTML: htmlHeader + `<p>Hello {{.OwnerName}},</p>
+<p>Our records show {{.PetName}} is due ` + recallWhat + ` on <strong>` + recallDue + `</strong>.</p>
+<p>{{if .BookingLink}}<a href="{{.BookingLink}}">Book online</a>{{else}}Please get in touch to book.{{end}}</p>` + htmlSignature,
+		},
+		"sms": {
+			Text: `{{.Clinic.Name}}: {{.PetName}} is due ` + recallWhat + ` on ` + recallDue + `.{{if .BookingLink}} Book: {{.BookingLink}}{{end}}`,
+		},
+	},
+	KindWaitlistOffer: {
+		"email": {
+			Subject: `A {{.TypeName}} slot has opened up for {{.PetName}}`,
+			Text: `Hello {{.OwnerName}},
+
+A {{.TypeName}} slot has opened up for {{.PetName}} at {{.Clinic.Name}} on ` + offerWhen + `, and we are holding it for you until ` + offerUntil + `.
+
+Please accept or decline the offer before then. If we do not hear from you, it will go to the next pet on the waitlist.
+` + textSignature,
+			HTML: htmlHeader + `<p>Hello {{.OwnerName}},</p>
+<p>A {{.TypeName}} slot has opened up for {{.PetName}} at {{.Clinic.Name}} on <strong>` + offerWhen + `</strong>, and we are holding it for you until <strong>` + offerUntil + `</strong>.</p>
+<p>Please accept or decline the offer before then. If we do not hear from you, it will go to the next pet on the waitlist.</p>` + htmlSignature,
+		},
+		"sms": {
+			Text: `{{.Clinic.Name}}: a {{.TypeName}} slot for {{.PetName}} on ` + offerWhen + ` is held for you until ` + offerUntil + `. Please accept or decline before then.`,
+		},
+	},
+}
@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TwilioSender sends text messages through the Twilio Messages API
+type TwilioSender struct {
+	AccountSID string
+	AuthToken  string
+	From       string // a Twilio number or messaging service SID
+	Client     *http.Client
+}
+
+// NewTwilioSender returns a Twilio sender with a bounded request timeout
+func NewTwilioSender(accountSID, authToken, from string) TwilioSender {
+	return TwilioSender{AccountSID: accountSID, AuthToken: authToken, From: from, Client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+func (s TwilioSender) Send(m Message) error {
+	if s.AccountSID == "" || s.AuthToken == "" || s.From == "" {
+		return fmt.Errorf("twilio sender is not configured: TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM are required")
+	}
+	form := url.Values{"To": {m.To}, "From": {s.From}, "Body": {m.Body}}
+	endpoint := fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", url.PathEscape(s.AccountSID))
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.AccountSID, s.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &SendError{Status: resp.StatusCode, Detail: strings.TrimSpace(string(detail))}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvInt reads an integer environment variable, falling back to def if it is unset or malformed
+func EnvInt(name string, def int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		Warn("Ignoring invalid %s=%q, using %d", name, raw, def)
+		return def
+	}
+	return n
+}
+
+// EnvFloat reads a decimal environment variable, falling back to def if it is unset or malformed
+func EnvFloat(name string, def float64) float64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		Warn("Ignoring invalid %s=%q, using %v", name, raw, def)
+		return def
+	}
+	return f
+}
+
+// EnvDurations reads a comma-separated list of durations such as "48h,2h", falling back to def if it is
+// unset or any entry is malformed or not positive
+func EnvDurations(name string, def []time.Duration) []time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	var out []time.Duration
+	for _, part := range strings.Split(raw, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || d <= 0 {
+			Warn("Ignoring invalid %s=%q, using %v", name, raw, def)
+			return def
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// ClinicName is the name the clinic goes by on documents and messages, from CLINIC_NAME
+func ClinicName() string {
+	if name := os.Getenv("CLINIC_NAME"); name != "" {
+		return name
+	}
+	return "Pet Clinic"
+}
+
+// DefaultLocale is the language messages are written in when an owner has not chosen one, from DEFAULT_LOCALE
+func DefaultLocale() string {
+	if locale := os.Getenv("DEFAULT_LOCALE"); locale != "" {
+		return locale
+	}
+	return "en"
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"encoding/json"
+)
+
+// MergePatch applies an RFC 7396 JSON merge patch to the target document and returns the result.
+// Object members in the patch replace those in the target, null members remove them, and any
+// non-object patch replaces the target entirely.
+func MergePatch(target, patch []byte) ([]byte, error) {
+	var t, p interface{}
+	if len(target) > 0 {
+		if err := json.Unmarshal(target, &t); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeValue(t, p))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = mergeValue(targetObj[k], v)
+	}
+	return targetObj
+}